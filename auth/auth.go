@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password users may register with
+const MinPasswordLength = 8
+
+var (
+	ErrInvalidToken = errors.New("session token is invalid")
+	ErrExpiredToken = errors.New("session token has expired")
+)
+
+// purposes of tokens other than session tokens, so a token is only accepted for what it was issued for
+const claimPurpose = "claim"
+
+// HashPassword() returns a salted bcrypt hash of a password, to store instead of the password itself
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword() checks whether a password matches a hash from HashPassword()
+func CheckPassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// what a token vouches for
+type claims struct {
+	Username string `json:"u"`
+	Expires  int64  `json:"e"`           // unix seconds
+	Purpose  string `json:"p,omitempty"` // empty for session tokens
+}
+
+// Signer issues session tokens and checks tokens it or another signer with the same secret issued. Tokens are the
+// base64 claims followed by their HMAC-SHA256, so any server can check them without asking the one that issued them
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewSigner() creates a signer whose tokens are valid for ttl. Every server must use the same secret
+func NewSigner(secret string, ttl time.Duration) *Signer {
+	return &Signer{secret: []byte(secret), ttl: ttl}
+}
+
+// Issue() returns a new token for a user who proved who they are, and when it expires
+func (s *Signer) Issue(username string) (string, time.Time) {
+	return s.issue(username, s.ttl, "")
+}
+
+// Verify() returns the user a token was issued to, or ErrInvalidToken if it was not issued with this secret, was
+// altered or is not a session token, or ErrExpiredToken
+func (s *Signer) Verify(token string) (string, error) {
+	return s.verify(token, "")
+}
+
+// IssueClaim() returns a token that lets a user registered before passwords existed set their password, valid for
+// ttl, and when it expires. Handed to the user by an admin, as the username alone proves nothing
+func (s *Signer) IssueClaim(username string, ttl time.Duration) (string, time.Time) {
+	return s.issue(username, ttl, claimPurpose)
+}
+
+// VerifyClaim() returns the user a claim token was issued to, with the same errors as Verify()
+func (s *Signer) VerifyClaim(token string) (string, error) {
+	return s.verify(token, claimPurpose)
+}
+
+// issue() returns a token for username, valid for ttl and only for purpose
+func (s *Signer) issue(username string, ttl time.Duration, purpose string) (string, time.Time) {
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+
+	payload, _ := json.Marshal(claims{Username: username, Expires: expires.Unix(), Purpose: purpose})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded)), expires
+}
+
+// verify() checks a token was issued with this secret for purpose, and returns its user
+func (s *Signer) verify(token string, purpose string) (string, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.sign(encoded)) {
+		return "", ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil || c.Username == "" || c.Purpose != purpose {
+		return "", ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= c.Expires {
+		return "", ErrExpiredToken
+	}
+
+	return c.Username, nil
+}
+
+// sign() returns the HMAC of the encoded claims
+func (s *Signer) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
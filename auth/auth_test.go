@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// forge() returns a token for c signed with s's secret, for claims Issue() never produces
+func forge(s *Signer, c claims) string {
+	payload, _ := json.Marshal(c)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded))
+}
+
+func TestVerify(t *testing.T) {
+	s := NewSigner("secret", time.Hour)
+	other := NewSigner("other secret", time.Hour)
+	expired := NewSigner("secret", -time.Second)
+
+	token, expires := s.Issue("alice")
+	if time.Until(expires) <= 59*time.Minute {
+		t.Errorf("token expires at %v, want an hour from now", expires)
+	}
+
+	encoded, signature, _ := strings.Cut(token, ".")
+	bobPayload, _ := json.Marshal(claims{Username: "bob", Expires: expires.Unix()})
+	claim, _ := s.IssueClaim("alice", time.Hour)
+	expiredToken, _ := expired.Issue("alice")
+	otherToken, _ := other.Issue("alice")
+	later := time.Now().Add(time.Hour).Unix()
+	notJSON := base64.RawURLEncoding.EncodeToString([]byte("not json"))
+	mac, _ := base64.RawURLEncoding.DecodeString(signature)
+	mac[0] ^= 1
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+		err   error
+	}{
+		{"valid", token, "alice", nil},
+		{"expired", expiredToken, "", ErrExpiredToken},
+		{"other secret", otherToken, "", ErrInvalidToken},
+		{"claim token", claim, "", ErrInvalidToken},
+		{"empty", "", "", ErrInvalidToken},
+		{"no signature", encoded, "", ErrInvalidToken},
+		{"signature not base64", encoded + ".!!!", "", ErrInvalidToken},
+		{"signature altered", encoded + "." + base64.RawURLEncoding.EncodeToString(mac), "", ErrInvalidToken},
+		{"claims altered", base64.RawURLEncoding.EncodeToString(bobPayload) + "." + signature, "", ErrInvalidToken},
+		{"claims not JSON", notJSON + "." + base64.RawURLEncoding.EncodeToString(s.sign(notJSON)), "", ErrInvalidToken},
+		{"no username", forge(s, claims{Expires: later}), "", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		username, err := s.Verify(tt.token)
+		if username != tt.want || err != tt.err {
+			t.Errorf("%s: got %q, %v, want %q, %v", tt.name, username, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestVerifyClaim(t *testing.T) {
+	s := NewSigner("secret", time.Hour)
+
+	claim, expires := s.IssueClaim("legacy", 10*time.Minute)
+	if time.Until(expires) > 10*time.Minute {
+		t.Errorf("claim expires at %v, want at most 10 minutes from now", expires)
+	}
+	session, _ := s.Issue("legacy")
+	expired, _ := s.IssueClaim("legacy", -time.Second)
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+		err   error
+	}{
+		{"valid", claim, "legacy", nil},
+		{"session token", session, "", ErrInvalidToken},
+		{"expired", expired, "", ErrExpiredToken},
+		{"other purpose", forge(s, claims{Username: "legacy", Expires: expires.Unix(), Purpose: "reset"}), "", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		username, err := s.VerifyClaim(tt.token)
+		if username != tt.want || err != tt.err {
+			t.Errorf("%s: got %q, %v, want %q, %v", tt.name, username, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == again {
+		t.Error("hashing the same password twice gave the same hash, it is not salted")
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{"right password", hash, "correct horse", true},
+		{"right password, other hash", again, "correct horse", true},
+		{"wrong password", hash, "correct horsE", false},
+		{"empty password", hash, "", false},
+		{"no hash", "", "correct horse", false},
+	}
+
+	for _, tt := range tests {
+		if got := CheckPassword(tt.hash, tt.password); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
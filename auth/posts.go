@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sjsu-pub-sub/types"
+)
+
+// prefix of every signed post, so a post signature is never valid for anything else signed with the same key
+const postKeyLabel = "sjsu-pub-sub post signing key"
+
+var (
+	ErrInvalidSigningKey = errors.New("post signing key is not a valid base64 encoded Ed25519 seed")
+	ErrInvalidPostKey    = errors.New("post key is not a valid base64 encoded Ed25519 public key")
+	ErrUnsignedPost      = errors.New("post is not signed")
+	ErrInvalidSignature  = errors.New("post signature does not match, the post was altered or forged")
+)
+
+// PostSigner signs the posts servers send to clients, so clients can tell a post relayed unchanged through gossip from
+// one a relaying client rewrote or forged. Every server is configured with the same Ed25519 key, kept apart from the
+// session secret, so posts signed by an earlier leader still verify after a new one is elected
+type PostSigner struct {
+	key ed25519.PrivateKey
+}
+
+// NewPostSigner() creates a signer for the base64 encoded Ed25519 seed every server shares, from GeneratePostKey()
+func NewPostSigner(signingKey string) (*PostSigner, error) {
+	seed, err := base64.StdEncoding.DecodeString(signingKey)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, ErrInvalidSigningKey
+	}
+
+	return &PostSigner{key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// GeneratePostKey() creates a new post signing key for the servers, and the public key clients verify posts with,
+// both base64 encoded
+func GeneratePostKey() (string, string, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("Error generating post signing key: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(privateKey.Seed()), base64.StdEncoding.EncodeToString(publicKey), nil
+}
+
+// PublicKey() returns the key clients verify posts with, as base64
+func (s *PostSigner) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+// Sign() sets the signature of a post about to be sent to clients. The signature covers the post's id, group, author,
+// timestamp, key epoch, body and groupmates, not the fields each hop of gossip changes
+func (s *PostSigner) Sign(msg *types.GossipMessage) {
+	msg.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, signedContent(*msg)))
+}
+
+// PostVerifier checks posts were signed by a server and not changed since
+type PostVerifier struct {
+	key ed25519.PublicKey
+}
+
+// NewPostVerifier() creates a verifier for the public key from GeneratePostKey() or PostSigner.PublicKey()
+func NewPostVerifier(publicKey string) (*PostVerifier, error) {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, ErrInvalidPostKey
+	}
+
+	return &PostVerifier{key: ed25519.PublicKey(key)}, nil
+}
+
+// Verify() returns ErrUnsignedPost or ErrInvalidSignature unless a post carries a valid signature
+func (v *PostVerifier) Verify(msg types.GossipMessage) error {
+	if msg.Signature == "" {
+		return ErrUnsignedPost
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil || !ed25519.Verify(v.key, signedContent(msg), signature) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// signedContent() returns the bytes a post's signature covers. Every field is length-prefixed, so no two posts share
+// the same bytes
+func signedContent(msg types.GossipMessage) []byte {
+	content := []byte(postKeyLabel)
+	content = binary.BigEndian.AppendUint64(content, msg.Id)
+	content = binary.BigEndian.AppendUint64(content, uint64(msg.Timestamp.UnixNano()))
+	content = binary.BigEndian.AppendUint64(content, msg.KeyEpoch)
+	for _, field := range []string{msg.Group, msg.Author, msg.Body} {
+		content = binary.BigEndian.AppendUint64(content, uint64(len(field)))
+		content = append(content, field...)
+	}
+	content = binary.BigEndian.AppendUint64(content, uint64(len(msg.GroupMates)))
+	for _, mate := range msg.GroupMates {
+		content = binary.BigEndian.AppendUint64(content, uint64(len(mate)))
+		content = append(content, mate...)
+	}
+	return content
+}
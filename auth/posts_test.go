@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"encoding/base64"
+	"sjsu-pub-sub/types"
+	"testing"
+	"time"
+)
+
+// newPostKeys() returns a signer and a verifier for a newly generated post key
+func newPostKeys(t *testing.T) (*PostSigner, *PostVerifier) {
+	t.Helper()
+
+	signingKey, postKey, err := GeneratePostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewPostSigner(signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewPostVerifier(postKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.PublicKey() != postKey {
+		t.Errorf("signer's public key %s differs from the generated one %s", signer.PublicKey(), postKey)
+	}
+	return signer, verifier
+}
+
+func TestPostSignature(t *testing.T) {
+	signer, verifier := newPostKeys(t)
+	other, _ := newPostKeys(t)
+
+	post := types.GossipMessage{
+		Id:           types.PostId(5),
+		Group:        "books",
+		Author:       "alice",
+		Timestamp:    time.Unix(100, 0).UTC(),
+		Body:         "hello",
+		KeyEpoch:     1,
+		GroupMates:   []string{"10.0.0.2:9000", "10.0.0.3:9000"},
+		ConnsToWrite: []string{"10.0.0.3:9000"},
+		TTL:          3,
+	}
+	signed := post
+	signer.Sign(&signed)
+
+	forged := post
+	other.Sign(&forged)
+
+	tests := []struct {
+		name   string
+		change func(msg *types.GossipMessage)
+		want   error
+	}{
+		{"unchanged", func(msg *types.GossipMessage) {}, nil},
+		{"relayed to other peers", func(msg *types.GossipMessage) { msg.ConnsToWrite = []string{"10.0.0.2:9000"}; msg.TTL = 1 }, nil},
+		{"membership piggybacked", func(msg *types.GossipMessage) { msg.Members = []types.MemberUpdate{{}} }, nil},
+		{"body changed", func(msg *types.GossipMessage) { msg.Body = "goodbye" }, ErrInvalidSignature},
+		{"author changed", func(msg *types.GossipMessage) { msg.Author = "mallory" }, ErrInvalidSignature},
+		{"group changed", func(msg *types.GossipMessage) { msg.Group = "films" }, ErrInvalidSignature},
+		{"id changed", func(msg *types.GossipMessage) { msg.Id++ }, ErrInvalidSignature},
+		{"timestamp changed", func(msg *types.GossipMessage) { msg.Timestamp = msg.Timestamp.Add(time.Second) }, ErrInvalidSignature},
+		{"key epoch changed", func(msg *types.GossipMessage) { msg.KeyEpoch++ }, ErrInvalidSignature},
+		{"groupmate added", func(msg *types.GossipMessage) { msg.GroupMates = append(msg.GroupMates, "10.0.0.9:9000") }, ErrInvalidSignature},
+		{"author and body moved apart", func(msg *types.GossipMessage) { msg.Author = "alicehe"; msg.Body = "llo" }, ErrInvalidSignature},
+		{"signed with another key", func(msg *types.GossipMessage) { msg.Signature = forged.Signature }, ErrInvalidSignature},
+		{"signature not base64", func(msg *types.GossipMessage) { msg.Signature = "!!!" }, ErrInvalidSignature},
+		{"unsigned", func(msg *types.GossipMessage) { msg.Signature = "" }, ErrUnsignedPost},
+	}
+
+	for _, tt := range tests {
+		msg := signed
+		tt.change(&msg)
+		if err := verifier.Verify(msg); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestInvalidPostKeys(t *testing.T) {
+	signingKey, postKey, err := GeneratePostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := base64.StdEncoding.EncodeToString([]byte("too short"))
+
+	signerTests := []struct {
+		name string
+		key  string
+		want error
+	}{
+		{"valid", signingKey, nil},
+		{"empty", "", ErrInvalidSigningKey},
+		{"not base64", "!!!", ErrInvalidSigningKey},
+		{"too short", short, ErrInvalidSigningKey},
+	}
+
+	for _, tt := range signerTests {
+		if _, err := NewPostSigner(tt.key); err != tt.want {
+			t.Errorf("signer with %s key: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	verifierTests := []struct {
+		name string
+		key  string
+		want error
+	}{
+		{"valid", postKey, nil},
+		{"empty", "", ErrInvalidPostKey},
+		{"not base64", "!!!", ErrInvalidPostKey},
+		{"too short", short, ErrInvalidPostKey},
+	}
+
+	for _, tt := range verifierTests {
+		if _, err := NewPostVerifier(tt.key); err != tt.want {
+			t.Errorf("verifier with %s key: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,686 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sjsu-pub-sub/store"
+	"sjsu-pub-sub/types"
+	"slices"
+)
+
+// applyEntry() applies a committed mutation from the replicated log to the local DB, in log order
+func (b *Broker) applyEntry(entry types.LogEntry) error {
+	var cmd types.Command
+	if err := json.Unmarshal(entry.Command, &cmd); err != nil {
+		return fmt.Errorf("failed to decode command: %v", err)
+	}
+
+	var err error
+	switch cmd.Op {
+	case types.OpRegister:
+		err = b.applyRegister(cmd)
+	case types.OpClaimUser:
+		err = b.applyClaimUser(cmd)
+	case types.OpJoinGroup:
+		err = b.applyJoinGroup(cmd, entry.Index)
+	case types.OpLeaveGroup:
+		err = b.applyLeaveGroup(cmd)
+	case types.OpWritePost:
+		err = b.applyWritePost(cmd, entry.Index)
+	case types.OpCreateGroup:
+		err = b.applyCreateGroup(cmd, entry.Index)
+	case types.OpDeleteGroup:
+		err = b.applyDeleteGroup(cmd)
+	case types.OpTransferOwnership:
+		err = b.applyTransferOwnership(cmd)
+	case types.OpAckPost:
+		err = b.applyAckPost(cmd)
+	case types.OpInvite:
+		err = b.applyInvite(cmd, entry.Index)
+	case types.OpRequestJoin:
+		err = b.applyRequestJoin(cmd, entry.Index)
+	case types.OpApproveJoin:
+		err = b.applyApproveJoin(cmd, entry.Index)
+	case types.OpDeclineJoin:
+		err = b.applyDeclineJoin(cmd)
+	case types.OpSetRole:
+		err = b.applySetRole(cmd)
+	case types.OpSetVisibility:
+		err = b.applySetVisibility(cmd)
+	case types.OpPublishKey:
+		err = b.applyPublishKey(cmd)
+	case types.OpEncryptGroup:
+		err = b.applyEncryptGroup(cmd)
+	case types.OpShareGroupKey:
+		err = b.applyShareGroupKey(cmd)
+	default:
+		err = fmt.Errorf("unknown command %s", cmd.Op)
+	}
+
+	if err == nil && cmd.GroupName != "" && cmd.Op != types.OpAckPost {
+		b.refreshGroupMembers(cmd.GroupName) // gossip to new groupmates, and stop gossiping to old ones, right away
+	}
+
+	return err
+}
+
+// applyRegister() inserts a new user
+func (b *Broker) applyRegister(cmd types.Command) error {
+	_, err := b.db.GetUser(cmd.Username)
+	if err == nil {
+		return store.ErrUserExists
+	}
+	if err != store.ErrUserNotFound {
+		return err
+	}
+
+	return b.db.CreateUser(cmd.Username, cmd.PasswordHash)
+}
+
+// applyClaimUser() sets the password of a user registered before passwords existed, once
+func (b *Broker) applyClaimUser(cmd types.Command) error {
+	user, err := b.db.GetUser(cmd.Username)
+	if err != nil {
+		return err
+	}
+
+	if user.PasswordHash != "" {
+		return store.ErrUserExists
+	}
+
+	return b.db.SetPasswordHash(cmd.Username, cmd.PasswordHash)
+}
+
+// applyJoinGroup() adds a user to a public group, or to a private group they were invited to
+func (b *Broker) applyJoinGroup(cmd types.Command, index uint64) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(group.GroupMates, cmd.Username) { // already a groupmate, keep offset so missed posts are still sent
+		return nil
+	}
+
+	if group.Private() && !slices.Contains(group.ACL.Invited, cmd.Username) {
+		return errNotInvited
+	}
+
+	return b.addGroupmate(group, cmd.Username, index)
+}
+
+// applyLeaveGroup() removes a user from a group, unless they own it. In an end-to-end encrypted group their sealed
+// keys are dropped, and if they held the current key the group moves to a new epoch no one holds yet, so posts written
+// after they left are encrypted with a key they never get
+func (b *Broker) applyLeaveGroup(cmd types.Command) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if group.OwnerName() == cmd.Username {
+		return errOwnerLeft
+	}
+
+	if err := b.db.LeaveGroup(cmd.Username, cmd.GroupName); err != nil {
+		return err
+	}
+
+	if dropSealedKeys(&group.Encryption, cmd.Username) {
+		if err := b.db.SetGroupEncryption(cmd.GroupName, group.Encryption); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := group.ACL.Roles[cmd.Username]; !ok {
+		return nil
+	}
+
+	delete(group.ACL.Roles, cmd.Username) // rejoining starts over as a member
+	return b.db.SetGroupACL(cmd.GroupName, group.ACL)
+}
+
+// applyWritePost() stores a post if its author may write to the group. Posts to an end-to-end encrypted group must be
+// encrypted with its current key, which the servers check by epoch only since they cannot read the post
+func (b *Broker) applyWritePost(cmd types.Command, index uint64) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if !group.Allows(cmd.Username, types.RoleMember) { // read-only groupmates and users outside the group
+		return errForbidden
+	}
+
+	if group.Encryption.Enabled {
+		if cmd.KeyEpoch == 0 || cmd.KeyEpoch != group.Encryption.Epoch() { // in clear, or with a key replaced since
+			return errStaleKey
+		}
+	} else if cmd.KeyEpoch != 0 {
+		return errNotEncrypted
+	}
+
+	return b.db.AddPost(types.Post{
+		Id:        types.PostId(index),
+		Author:    cmd.Username,
+		Group:     cmd.GroupName,
+		Body:      cmd.Post,
+		Timestamp: cmd.Timestamp,
+		KeyEpoch:  cmd.KeyEpoch,
+	})
+}
+
+// applyCreateGroup() inserts a new group and makes its creator the first groupmate
+func (b *Broker) applyCreateGroup(cmd types.Command, index uint64) error {
+	err := b.db.CreateGroup(cmd.GroupName, cmd.Username, cmd.Visibility)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Encrypted { // first key is shared by whoever posts first
+		if err := b.db.SetGroupEncryption(cmd.GroupName, types.GroupEncryption{Enabled: true}); err != nil {
+			return err
+		}
+	}
+
+	if err := b.db.JoinGroup(cmd.Username, cmd.GroupName); err != nil {
+		return err
+	}
+
+	return b.db.CommitOffset(cmd.Username, cmd.GroupName, types.PostId(index))
+}
+
+// applyAckPost() records that a user received the posts with ids cmd.PostIds. Posts arrive out of order, so the
+// offset only moves past posts once every post before them was acknowledged too, and posts acknowledged ahead of it are
+// kept apart so they are not sent again either. At most maxAckedPosts are kept apart: past that, the offset skips the
+// oldest posts still missing, which are then not sent again on reconnect
+func (b *Broker) applyAckPost(cmd types.Command) error {
+	if err := b.checkGroupmate(cmd.GroupName, cmd.Username); err != nil {
+		return err
+	}
+
+	offsets, err := b.db.GetOffsets(cmd.Username)
+	if err != nil {
+		return err
+	}
+
+	offset := offsets[cmd.GroupName]
+	acked := make(map[uint64]bool, len(offset.Acked)+len(cmd.PostIds))
+	for _, id := range offset.Acked {
+		acked[id] = true
+	}
+
+	added := 0
+	for _, id := range cmd.PostIds {
+		if id <= offset.Offset || acked[id] { // acknowledged before
+			continue
+		}
+
+		posts, err := b.db.ListPosts(cmd.GroupName, store.PostQuery{After: id - 1, Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(posts) == 0 || posts[0].Id != id { // not a post of the group, nothing of the batch is recorded
+			return errNoPost
+		}
+
+		acked[id] = true
+		offset.Acked = append(offset.Acked, id)
+		added++
+	}
+	if added == 0 {
+		return nil
+	}
+
+	offset.Username = cmd.Username
+	offset.Group = cmd.GroupName
+	slices.Sort(offset.Acked)
+
+	// move the offset past the posts right after it that have all been acknowledged
+	posts, err := b.db.ListPosts(cmd.GroupName, store.PostQuery{After: offset.Offset, Limit: len(offset.Acked)})
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if len(offset.Acked) == 0 || post.Id != offset.Acked[0] {
+			break
+		}
+		offset.Offset = post.Id
+		offset.Acked = offset.Acked[1:]
+	}
+
+	if excess := len(offset.Acked) - maxAckedPosts; excess > 0 { // give up on the oldest posts still missing
+		offset.Offset = offset.Acked[excess-1]
+		offset.Acked = offset.Acked[excess:]
+	}
+
+	return b.db.SetOffset(offset)
+}
+
+// checkGroupmate() returns errNotMember unless a user is a groupmate of a group, so only they keep offsets in it
+func (b *Broker) checkGroupmate(groupName string, username string) error {
+	group, err := b.db.GetGroup(groupName)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(group.GroupMates, username) {
+		return errNotMember
+	}
+
+	return nil
+}
+
+// applyDeleteGroup() deletes a group if requested by its owner
+func (b *Broker) applyDeleteGroup(cmd types.Command) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if group.OwnerName() != cmd.Username {
+		return errNotOwner
+	}
+
+	return b.db.DeleteGroup(cmd.GroupName)
+}
+
+// applyTransferOwnership() hands a group over to another groupmate if requested by its owner
+func (b *Broker) applyTransferOwnership(cmd types.Command) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if group.OwnerName() != cmd.Username {
+		return errNotOwner
+	}
+
+	if !slices.Contains(group.GroupMates, cmd.NewOwner) {
+		return errNotMember
+	}
+
+	if err := b.db.SetGroupOwner(cmd.GroupName, cmd.NewOwner); err != nil {
+		return err
+	}
+
+	if _, ok := group.ACL.Roles[cmd.NewOwner]; !ok {
+		return nil
+	}
+
+	delete(group.ACL.Roles, cmd.NewOwner) // owner's role comes from owning the group, and the old owner becomes a member
+	return b.db.SetGroupACL(cmd.GroupName, group.ACL)
+}
+
+// applyInvite() lets a user join a group if invited by its owner or a moderator. A user who already asked to join is
+// let in right away
+func (b *Broker) applyInvite(cmd types.Command, index uint64) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if !group.Allows(cmd.Username, types.RoleModerator) {
+		return errForbidden
+	}
+
+	exists, err := b.db.UserExists(cmd.Member)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return store.ErrUserNotFound
+	}
+
+	if slices.Contains(group.GroupMates, cmd.Member) {
+		return errAlreadyMember
+	}
+
+	if slices.Contains(group.ACL.Requested, cmd.Member) {
+		return b.addGroupmate(group, cmd.Member, index)
+	}
+
+	if slices.Contains(group.ACL.Invited, cmd.Member) {
+		return nil
+	}
+
+	group.ACL.Invited = append(group.ACL.Invited, cmd.Member)
+	return b.db.SetGroupACL(cmd.GroupName, group.ACL)
+}
+
+// applyRequestJoin() asks the owner and moderators of a private group to let a user in. A user who was already invited
+// is let in right away
+func (b *Broker) applyRequestJoin(cmd types.Command, index uint64) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(group.GroupMates, cmd.Username) {
+		return errAlreadyMember
+	}
+
+	if !group.Private() {
+		return errPublicGroup
+	}
+
+	if slices.Contains(group.ACL.Invited, cmd.Username) {
+		return b.addGroupmate(group, cmd.Username, index)
+	}
+
+	if slices.Contains(group.ACL.Requested, cmd.Username) {
+		return nil
+	}
+
+	group.ACL.Requested = append(group.ACL.Requested, cmd.Username)
+	return b.db.SetGroupACL(cmd.GroupName, group.ACL)
+}
+
+// applyApproveJoin() lets in a user who asked to join, if approved by the group's owner or a moderator
+func (b *Broker) applyApproveJoin(cmd types.Command, index uint64) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if !group.Allows(cmd.Username, types.RoleModerator) {
+		return errForbidden
+	}
+
+	if !slices.Contains(group.ACL.Requested, cmd.Member) {
+		return errNoRequest
+	}
+
+	return b.addGroupmate(group, cmd.Member, index)
+}
+
+// applyDeclineJoin() drops a user's request to join, if declined by the group's owner or a moderator
+func (b *Broker) applyDeclineJoin(cmd types.Command) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if !group.Allows(cmd.Username, types.RoleModerator) {
+		return errForbidden
+	}
+
+	if !slices.Contains(group.ACL.Requested, cmd.Member) {
+		return errNoRequest
+	}
+
+	group.ACL.Requested = removeUser(group.ACL.Requested, cmd.Member)
+	return b.db.SetGroupACL(cmd.GroupName, group.ACL)
+}
+
+// applySetRole() changes the role of a groupmate other than the owner, if requested by the owner
+func (b *Broker) applySetRole(cmd types.Command) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if group.OwnerName() != cmd.Username {
+		return errNotOwner
+	}
+
+	if !slices.Contains(group.GroupMates, cmd.Member) {
+		return errNotMember
+	}
+
+	if cmd.Member == group.OwnerName() {
+		return errOwnerRole
+	}
+
+	if cmd.Role == types.RoleMember { // members are everyone without a role of their own
+		delete(group.ACL.Roles, cmd.Member)
+	} else {
+		if group.ACL.Roles == nil {
+			group.ACL.Roles = make(map[string]string)
+		}
+		group.ACL.Roles[cmd.Member] = cmd.Role
+	}
+
+	return b.db.SetGroupACL(cmd.GroupName, group.ACL)
+}
+
+// applySetVisibility() makes a group public or private, if requested by its owner. Groupmates stay in the group
+func (b *Broker) applySetVisibility(cmd types.Command) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if group.OwnerName() != cmd.Username {
+		return errNotOwner
+	}
+
+	group.ACL.Visibility = cmd.Visibility
+	return b.db.SetGroupACL(cmd.GroupName, group.ACL)
+}
+
+// applyPublishKey() replaces the public key of a user. Group keys sealed to their old key can no longer be opened, so
+// they are dropped from every group the user is in, for the next groupmate posting to share the key with them again
+func (b *Broker) applyPublishKey(cmd types.Command) error {
+	user, err := b.db.GetUser(cmd.Username)
+	if err != nil {
+		return err
+	}
+
+	if user.PublicKey == cmd.PublicKey {
+		return nil
+	}
+
+	if err := b.db.SetPublicKey(cmd.Username, cmd.PublicKey); err != nil {
+		return err
+	}
+
+	for _, name := range user.Groups {
+		group, err := b.db.GetGroup(name)
+		if err == store.ErrGroupNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		dropped := false
+		for _, key := range group.Encryption.Keys {
+			if _, ok := key.Sealed[cmd.Username]; ok {
+				delete(key.Sealed, cmd.Username)
+				dropped = true
+			}
+		}
+		if !dropped {
+			continue
+		}
+
+		if err := b.db.SetGroupEncryption(name, group.Encryption); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyEncryptGroup() makes a group's posts end-to-end encrypted from now on, if requested by its owner. Posts already
+// written stay in clear
+func (b *Broker) applyEncryptGroup(cmd types.Command) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if group.OwnerName() != cmd.Username {
+		return errNotOwner
+	}
+
+	if group.Encryption.Enabled {
+		return nil
+	}
+
+	group.Encryption.Enabled = true
+	return b.db.SetGroupEncryption(cmd.GroupName, group.Encryption)
+}
+
+// applyShareGroupKey() stores a group key sealed to groupmates by a groupmate who may post. A new key replaces the
+// current one if it is for the next epoch, or for the current epoch while no one holds its key, as after a groupmate
+// left. Otherwise the current key is shared with groupmates who lack it, by a groupmate holding it. Copies for users
+// who are no longer groupmates are dropped, and copies already shared are kept
+func (b *Broker) applyShareGroupKey(cmd types.Command) error {
+	group, err := b.db.GetGroup(cmd.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if !group.Encryption.Enabled {
+		return errNotEncrypted
+	}
+
+	if !group.Allows(cmd.Username, types.RoleMember) {
+		return errForbidden
+	}
+
+	epoch := group.Encryption.Epoch()
+	holders := group.Encryption.Holders()
+	switch {
+	case cmd.KeyEpoch == epoch+1:
+		group.Encryption.Keys = append(group.Encryption.Keys, types.GroupKey{Epoch: cmd.KeyEpoch, Sealed: make(map[string]string)})
+	case cmd.KeyEpoch == epoch && epoch > 0 && cmd.NewKey && len(holders) == 0:
+	case cmd.KeyEpoch == epoch && epoch > 0 && !cmd.NewKey && slices.Contains(holders, cmd.Username):
+	default: // another groupmate replaced the key first
+		return errStaleKey
+	}
+
+	key := group.Encryption.Keys[len(group.Encryption.Keys)-1]
+	if key.Sealed == nil {
+		key.Sealed = make(map[string]string)
+		group.Encryption.Keys[len(group.Encryption.Keys)-1] = key
+	}
+	for username, sealed := range cmd.Sealed {
+		if !slices.Contains(group.GroupMates, username) { // left since the key was sealed
+			continue
+		}
+		if _, ok := key.Sealed[username]; ok {
+			continue
+		}
+		key.Sealed[username] = sealed
+	}
+
+	return b.db.SetGroupEncryption(cmd.GroupName, group.Encryption)
+}
+
+// dropSealedKeys() drops the copies of a group's keys sealed to a user who left it. Returns whether any were dropped.
+// If the user held the current key, a new epoch is started without any holders, for the next groupmate posting to
+// replace the key
+func dropSealedKeys(encryption *types.GroupEncryption, username string) bool {
+	held := slices.Contains(encryption.Holders(), username)
+
+	dropped := false
+	for _, key := range encryption.Keys {
+		if _, ok := key.Sealed[username]; ok {
+			delete(key.Sealed, username)
+			dropped = true
+		}
+	}
+
+	if held {
+		encryption.Keys = append(encryption.Keys, types.GroupKey{Epoch: encryption.Epoch() + 1, Sealed: make(map[string]string)})
+	}
+
+	return dropped
+}
+
+// addGroupmate() adds a user to a group and drops their invite and request to join. A new groupmate's offset starts at
+// the join, so they are sent posts written after they joined but not the group's history
+func (b *Broker) addGroupmate(group types.Group, username string, index uint64) error {
+	if slices.Contains(group.ACL.Invited, username) || slices.Contains(group.ACL.Requested, username) {
+		group.ACL.Invited = removeUser(group.ACL.Invited, username)
+		group.ACL.Requested = removeUser(group.ACL.Requested, username)
+		if err := b.db.SetGroupACL(group.GroupName, group.ACL); err != nil {
+			return err
+		}
+	}
+
+	if err := b.db.JoinGroup(username, group.GroupName); err != nil {
+		return err
+	}
+
+	return b.db.CommitOffset(username, group.GroupName, types.PostId(index))
+}
+
+// removeUser() returns a copy of usernames without username
+func removeUser(usernames []string, username string) []string {
+	return slices.DeleteFunc(slices.Clone(usernames), func(elem string) bool {
+		return elem == username
+	})
+}
+
+// refreshGroupMembers() reloads the groupmates of a group from the DB
+func (b *Broker) refreshGroupMembers(groupName string) {
+	group, err := b.db.GetGroup(groupName)
+
+	b.groupMembers.Lock()
+	defer b.groupMembers.Unlock()
+
+	if err == store.ErrGroupNotFound {
+		delete(b.groupMembers.members, groupName)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error refreshing groupmates:", err)
+		return
+	}
+
+	b.groupMembers.members[groupName] = group.GroupMates
+}
+
+// loadGroupMembers() reloads the groupmates of every group from the DB
+func (b *Broker) loadGroupMembers() error {
+	groups, err := b.db.ListGroups()
+	if err != nil {
+		return err
+	}
+
+	b.groupMembers.Lock()
+	defer b.groupMembers.Unlock()
+
+	b.groupMembers.members = make(map[string][]string)
+	for _, group := range groups {
+		b.groupMembers.members[group.GroupName] = group.GroupMates
+	}
+
+	return nil
+}
+
+// snapshotDB() copies the Users, Groups and Posts collections for a server rejoining the cluster
+func (b *Broker) snapshotDB() ([]byte, error) {
+	snapshot, err := b.db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Took snapshot of %d users, %d groups and %d posts\n", len(snapshot.Users), len(snapshot.Groups), len(snapshot.Posts))
+
+	return json.Marshal(snapshot)
+}
+
+// restoreDB() replaces the Users and Groups collections with a snapshot from the leader
+func (b *Broker) restoreDB(data []byte) error {
+	var snapshot types.Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %v", err)
+	}
+
+	if err := b.db.Restore(snapshot); err != nil {
+		return err
+	}
+
+	if err := b.loadGroupMembers(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored snapshot of %d users and %d groups\n", len(snapshot.Users), len(snapshot.Groups))
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package broker
+
+import (
+	"encoding/json"
+	"sjsu-pub-sub/store"
+	"sjsu-pub-sub/types"
+	"slices"
+	"testing"
+)
+
+// newApplyBroker() returns a broker with an in-memory store and no Raft node, and a function applying commands to it
+// as consecutive log entries
+func newApplyBroker(t *testing.T) (*Broker, func(types.Command) error) {
+	t.Helper()
+
+	db, err := store.NewFileStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Broker{db: db, groupMembers: groupMembersMap{members: make(map[string][]string)}}
+
+	index := uint64(0)
+	apply := func(cmd types.Command) error {
+		index++
+		data, err := json.Marshal(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b.applyEntry(types.LogEntry{Index: index, Command: data})
+	}
+	return b, apply
+}
+
+func TestKeyRotationOnLeave(t *testing.T) {
+	b, apply := newApplyBroker(t)
+
+	setup := []types.Command{
+		{Op: types.OpRegister, Username: "alice", PasswordHash: "hash"},
+		{Op: types.OpRegister, Username: "bob", PasswordHash: "hash"},
+		{Op: types.OpRegister, Username: "carol", PasswordHash: "hash"},
+		{Op: types.OpRegister, Username: "dave", PasswordHash: "hash"},
+		{Op: types.OpCreateGroup, Username: "alice", GroupName: "books", Visibility: types.VisibilityPublic, Encrypted: true},
+		{Op: types.OpJoinGroup, Username: "bob", GroupName: "books"},
+		{Op: types.OpJoinGroup, Username: "carol", GroupName: "books"},
+		{Op: types.OpShareGroupKey, Username: "alice", GroupName: "books", KeyEpoch: 1, NewKey: true, Sealed: map[string]string{"alice": "a1", "bob": "b1", "carol": "c1"}},
+		{Op: types.OpJoinGroup, Username: "dave", GroupName: "books"},
+	}
+	for _, cmd := range setup {
+		if err := apply(cmd); err != nil {
+			t.Fatalf("%s by %s: %v", cmd.Op, cmd.Username, err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		cmd         types.Command
+		want        error
+		wantEpoch   uint64
+		wantHolders []string
+	}{
+		{"leaver not holding the key", types.Command{Op: types.OpLeaveGroup, Username: "dave", GroupName: "books"}, nil, 1, []string{"alice", "bob", "carol"}},
+		{"leaver holding the key", types.Command{Op: types.OpLeaveGroup, Username: "carol", GroupName: "books"}, nil, 2, []string{}},
+		{"post with the old key", types.Command{Op: types.OpWritePost, Username: "bob", GroupName: "books", KeyEpoch: 1, Post: "sealed"}, errStaleKey, 2, []string{}},
+		{"share without a new key", types.Command{Op: types.OpShareGroupKey, Username: "bob", GroupName: "books", KeyEpoch: 2, Sealed: map[string]string{"alice": "a2"}}, errStaleKey, 2, []string{}},
+		{"share a new key", types.Command{Op: types.OpShareGroupKey, Username: "bob", GroupName: "books", KeyEpoch: 2, NewKey: true, Sealed: map[string]string{"alice": "a2", "bob": "b2", "carol": "c2"}}, nil, 2, []string{"alice", "bob"}},
+		{"second new key for the epoch", types.Command{Op: types.OpShareGroupKey, Username: "alice", GroupName: "books", KeyEpoch: 2, NewKey: true, Sealed: map[string]string{"alice": "x"}}, errStaleKey, 2, []string{"alice", "bob"}},
+		{"post with the new key", types.Command{Op: types.OpWritePost, Username: "bob", GroupName: "books", KeyEpoch: 2, Post: "sealed"}, nil, 2, []string{"alice", "bob"}},
+	}
+
+	for _, tt := range tests {
+		if err := apply(tt.cmd); err != tt.want {
+			t.Fatalf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+
+		group, err := b.db.GetGroup("books")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if epoch, holders := group.Encryption.Epoch(), group.Encryption.Holders(); epoch != tt.wantEpoch || !slices.Equal(holders, tt.wantHolders) {
+			t.Errorf("%s: got epoch %d held by %v, want %d held by %v", tt.name, epoch, holders, tt.wantEpoch, tt.wantHolders)
+		}
+	}
+
+	group, err := b.db.GetGroup("books")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range group.Encryption.Keys {
+		if _, ok := key.Sealed["carol"]; ok {
+			t.Errorf("carol still holds the key of epoch %d after leaving", key.Epoch)
+		}
+	}
+}
+
+func TestAckedPostsCapped(t *testing.T) {
+	b, apply := newApplyBroker(t)
+
+	setup := []types.Command{
+		{Op: types.OpRegister, Username: "alice", PasswordHash: "hash"},
+		{Op: types.OpRegister, Username: "bob", PasswordHash: "hash"},
+		{Op: types.OpCreateGroup, Username: "alice", GroupName: "books", Visibility: types.VisibilityPublic},
+		{Op: types.OpJoinGroup, Username: "bob", GroupName: "books"},
+	}
+	for i := 0; i < maxAckedPosts+3; i++ {
+		setup = append(setup, types.Command{Op: types.OpWritePost, Username: "alice", GroupName: "books", Post: "hello"})
+	}
+	for _, cmd := range setup {
+		if err := apply(cmd); err != nil {
+			t.Fatalf("%s by %s: %v", cmd.Op, cmd.Username, err)
+		}
+	}
+
+	posts, err := b.db.ListPosts("books", store.PostQuery{Limit: maxAckedPosts + 3})
+	if err != nil || len(posts) != maxAckedPosts+3 {
+		t.Fatalf("got %d posts, %v", len(posts), err)
+	}
+	ids := make([]uint64, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.Id)
+	}
+
+	// bob missed the first two posts, and received one more than are kept apart
+	if err := apply(types.Command{Op: types.OpAckPost, Username: "bob", GroupName: "books", PostIds: ids[2:]}); err != nil {
+		t.Fatal(err)
+	}
+
+	offsets, err := b.db.GetOffsets("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := offsets["books"]
+	if got.Offset != ids[2] || !slices.Equal(got.Acked, ids[3:]) {
+		t.Errorf("got offset %d with %d posts acked, want %d with %d", got.Offset, len(got.Acked), ids[2], len(ids[3:]))
+	}
+}
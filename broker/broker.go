@@ -0,0 +1,474 @@
+package broker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sjsu-pub-sub/auth"
+	"sjsu-pub-sub/certs"
+	"sjsu-pub-sub/config"
+	"sjsu-pub-sub/gossip"
+	"sjsu-pub-sub/pool"
+	"sjsu-pub-sub/raft"
+	"sjsu-pub-sub/store"
+	"sjsu-pub-sub/types"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	replicationTimeout  = 5 * time.Second // how long a write waits to be committed before failing
+	defaultPostLimit    = 20              // posts per page if the client does not ask for a limit
+	maxPostLimit        = 100
+	maxPostSize         = 64 * 1024       // bytes of a post, so gossip carrying it stays within types.MaxFrameSize
+	maxGroupName        = 64              // bytes of a group's name
+	registrationRefresh = 10              // heartbeats between registrations, so a restarted gateway relearns this server
+	shutdownTimeout     = 5 * time.Second // how long in-flight HTTP requests may take to finish on shutdown
+	maxAcksPerRequest   = 500             // posts one /ackpost request may acknowledge
+	maxAckedPosts       = 1000            // posts acknowledged ahead of a user's offset kept per group
+)
+
+var (
+	errNotOwner      = errors.New("only the group owner may do this")
+	errNotMember     = errors.New("user is not a member of the group")
+	errOwnerLeft     = errors.New("group owner cannot leave the group")
+	errForbidden     = errors.New("user's role in the group does not allow this")
+	errNotInvited    = errors.New("private group can only be joined by invite or approved request")
+	errNoRequest     = errors.New("user has not asked to join the group")
+	errAlreadyMember = errors.New("user is already a member of the group")
+	errPublicGroup   = errors.New("public group can be joined directly")
+	errOwnerRole     = errors.New("group owner's role cannot be changed")
+	errNotEncrypted  = errors.New("group is not end-to-end encrypted")
+	errStaleKey      = errors.New("group key has changed, fetch the group's keys again")
+	errNoPost        = errors.New("group has no post with this id")
+)
+
+type clientMap struct {
+	sync.RWMutex
+	connections map[string]string // map of username (key) and IP (value)
+}
+
+type groupMembersMap struct {
+	sync.RWMutex
+	members map[string][]string // map of group name (key) and usernames of groupmates (value)
+}
+
+// Broker is a single pub-sub server: it serves the gateway's HTTP requests, replicates writes to the other servers
+// with Raft, and seeds new posts to the clients logged in to it
+type Broker struct {
+	config       config.Server
+	nodeId       string           // stable id this server registers with the gateway under
+	db           store.Store      // this server's copy of users, groups and posts
+	activeConns  clientMap        // clients logged in to this server
+	groupMembers groupMembersMap  // groupmates to gossip new posts to, kept in step with every applied membership change
+	raftNode     *raft.Node       // this server's membership in leader election and replication
+	gossipPool   *pool.Pool       // long-lived connections to clients, reused for every post sent to them
+	gossipEngine *gossip.Engine   // seeds new posts to groupmates, which gossip them on among themselves
+	gatewayPool  *pool.Pool       // long-lived connection to the gateway for registration and heartbeats
+	sessions     *auth.Signer     // issues and checks the session tokens users act with
+	postSigner   *auth.PostSigner // signs every post sent to clients, so they can drop posts other clients tampered with
+	tls          *certs.Bundle    // certificates every listener and dial uses, nil for plaintext
+}
+
+// New() opens the store selected in cfg and sets up replication and gossip. Nothing is listened on or sent until Run()
+func New(cfg config.Server) (*Broker, error) {
+	b := &Broker{
+		config:       cfg,
+		activeConns:  clientMap{connections: make(map[string]string)},
+		groupMembers: groupMembersMap{members: make(map[string][]string)},
+		sessions:     auth.NewSigner(cfg.SessionSecret, time.Duration(cfg.SessionTTL)),
+	}
+
+	postSigner, err := auth.NewPostSigner(cfg.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	b.postSigner = postSigner
+
+	bundle, err := certs.Load(cfg.TLSFiles())
+	if err != nil {
+		return nil, err
+	}
+	b.tls = bundle
+
+	b.nodeId = cfg.NodeId
+	if b.nodeId == "" {
+		nodeId, err := loadNodeId(cfg.NodeIdFile)
+		if err != nil {
+			return nil, err
+		}
+		b.nodeId = nodeId
+	}
+
+	db, err := openStore(cfg) // initialize DB connection
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to DB: %v", err)
+	}
+	b.db = db
+
+	if err := b.loadGroupMembers(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Error loading groupmates: %v", err)
+	}
+
+	fmt.Println("Initialized DB connection...")
+
+	b.raftNode, err = raft.NewNode(raft.Config{
+		Id:        cfg.RaftAddress(), // servers on the same host differ by Raft port
+		Peers:     cfg.RaftPeers(),
+		StatePath: cfg.RaftState,
+		TLS:       bundle.ClientConfig(certs.RoleServer), // only servers take part in leader election
+		Quorum:    cfg.Quorum,
+		Apply:     b.applyEntry,                               // apply committed writes to local DB
+		Snapshot:  b.snapshotDB,                               // leader sends local DB to rejoining servers
+		Restore:   b.restoreDB,                                // rejoining server replaces local DB with leader's
+		Durable:   cfg.Store == "mongo" || cfg.DataFile != "", // in-memory stores lose every write on restart
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Error initializing leader election: %v", err)
+	}
+
+	b.gossipPool = pool.New(cfg.Host, nil, pool.DefaultIdleTTL, bundle.ClientConfig(certs.RoleClient))
+
+	gossipConfig := gossip.DefaultConfig()
+	gossipConfig.Fanout = cfg.SeedFanout
+	gossipConfig.TTL = cfg.GossipTTL
+	b.gossipEngine = gossip.New(gossipConfig, b.gossipPool, "", nil) // servers only seed posts
+
+	b.gatewayPool = pool.New(cfg.Host, nil, pool.DefaultIdleTTL, bundle.ClientConfig(certs.RoleGateway))
+
+	return b, nil
+}
+
+// NodeId() returns the id this server registers with the gateway under
+func (b *Broker) NodeId() string {
+	return b.nodeId
+}
+
+// Run() listens for clients, other servers and HTTP requests, takes part in leader election and registers with the
+// gateway. It blocks until ctx is cancelled, then deregisters from the gateway and closes the listeners, connections
+// and DB. A broker cannot be run again after Run() returns
+func (b *Broker) Run(ctx context.Context) error {
+	defer b.db.Close()
+
+	clientPort := strconv.Itoa(b.config.Port)     // client TCP server
+	leaderPort := strconv.Itoa(b.config.RaftPort) // leader election TCP server
+
+	listener, err := certs.Listen(":"+clientPort, b.tls.ServerConfig()) // listen for TCP connections for future gossip from client
+	if err != nil {
+		return fmt.Errorf("Error listening: %v", err)
+	}
+	defer listener.Close()
+
+	fmt.Printf("TCP client server listening on port %s...\n", clientPort)
+
+	raftListener, err := certs.Listen(":"+leaderPort, b.tls.ServerConfig(certs.RoleServer, certs.RoleGateway)) // listen for leader election messages, and leader queries from the gateway
+	if err != nil {
+		return fmt.Errorf("Error listening: %v", err)
+	}
+	defer raftListener.Close()
+
+	fmt.Printf("TCP leader server listening on port %s...\n", leaderPort)
+
+	httpServer := &http.Server{Addr: ":" + strconv.Itoa(b.config.HTTPPort), Handler: b.Handler()}
+	httpListener, err := certs.Listen(httpServer.Addr, b.tls.ServerConfig(certs.RoleGateway)) // only the gateway forwards requests
+	if err != nil {
+		return fmt.Errorf("Error listening: %v", err)
+	}
+
+	go b.gossipPool.Run()
+	defer b.gossipPool.Close()
+
+	go b.gatewayPool.Run()
+	defer b.gatewayPool.Close()
+
+	go b.listenForConnections(listener)
+
+	go b.listenForLeaderMessages(raftListener)
+
+	go b.raftNode.Run() // take part in leader election and replication
+
+	go httpServer.Serve(httpListener) // start HTTP server
+
+	registration := types.Registration{
+		NodeId:        b.nodeId,
+		HTTPAddress:   net.JoinHostPort(b.config.Host, strconv.Itoa(b.config.HTTPPort)),
+		ClientAddress: net.JoinHostPort(b.config.Host, clientPort),
+		RaftAddress:   b.config.RaftAddress(),
+		Capabilities:  []string{types.CapReplay},
+	}
+	go b.sendHeartbeats(ctx, registration, time.Duration(b.config.Heartbeat))
+
+	<-ctx.Done()
+
+	fmt.Println("Shutting down...")
+	b.deregister()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	httpServer.Shutdown(shutdownCtx)
+
+	return nil
+}
+
+// handleConnection() receives TCP connections from clients and stores their IP address for future gossip. The leader
+// also sends each client the posts it missed while offline
+func (b *Broker) handleConnection(conn net.Conn) {
+	defer conn.Close()
+	fmt.Println("Received client connection from:", conn.RemoteAddr())
+
+	remoteAddr := conn.RemoteAddr().String()
+
+	parts := strings.SplitN(remoteAddr, ":", 2)
+	result := ""
+
+	if len(parts) > 0 {
+		result = parts[0] // get hostname (server) from IP. The port from conn.RemoteAddr() is not the TCP port the client is listening on for gossip
+		fmt.Println("Substring before the first colon:", result)
+	} else {
+		fmt.Println("No colon found in the string")
+	}
+
+	fmt.Printf("Remote hostname: %s\n", result)
+
+	session, err := types.AcceptSession(conn, b.config.Host, []string{types.CapReplay}, types.MaxFrameSize)
+	if err != nil {
+		fmt.Printf("Client %v failed handshake: %v\n", conn.RemoteAddr(), err)
+		return
+	}
+
+	fmt.Printf("Client %v speaks protocol version %d\n", conn.RemoteAddr(), session.Version)
+
+	username := ""
+	port := ""
+	for {
+		env, err := session.Receive() // read port that client is listening to gossip on
+		if err != nil {
+			fmt.Printf("Client %v disconnected\n", conn.RemoteAddr())
+			break
+		}
+
+		if env.Type != types.MsgAuth { // newer client, ignore messages this server does not know
+			fmt.Printf("Client %v sent unknown message %s\n", conn.RemoteAddr(), env.Type)
+			continue
+		}
+
+		var authMsg types.AuthMessage
+		if err := env.Decode(&authMsg); err != nil {
+			fmt.Println("Error decoding auth message:", err)
+			continue
+		}
+
+		tokenUser, err := b.sessions.Verify(authMsg.Token)
+		if err != nil || tokenUser != authMsg.Username { // only the user themselves may receive their posts
+			fmt.Printf("Client %v failed to authenticate as %s: %v\n", conn.RemoteAddr(), authMsg.Username, err)
+			break
+		}
+
+		fmt.Printf("Client %v logged in as %s on port %s\n", conn.RemoteAddr(), authMsg.Username, authMsg.Port)
+		username = authMsg.Username
+		port = authMsg.Port
+		b.activeConns.Lock()
+		b.activeConns.connections[username] = result + port // store username as key, above hostname + receive port as IP (value) for client
+		b.activeConns.Unlock()
+		b.printConns()
+
+		if b.raftNode.IsLeader() && session.Supports(types.CapReplay) { // only leaders send posts, like they multicast
+			go b.replayMissedPosts(username, result+port)
+		}
+	}
+
+	b.activeConns.Lock()
+	delete(b.activeConns.connections, username) // if client goes down, remove client from conn list
+	b.activeConns.Unlock()
+	b.printConns()
+}
+
+// printConns() logs the clients logged in to this server
+func (b *Broker) printConns() {
+	b.activeConns.RLock()
+	defer b.activeConns.RUnlock()
+
+	fmt.Println("Updated conn list:")
+	for key, value := range b.activeConns.connections {
+		fmt.Printf("Key: %s, Value: %s\n", key, value)
+	}
+}
+
+// replayMissedPosts() sends a reconnecting user every post of their groups they have not acknowledged, oldest
+// first, so posts written while they were offline still reach them
+func (b *Broker) replayMissedPosts(username string, address string) {
+	user, err := b.db.GetUser(username)
+	if err != nil {
+		fmt.Println("Error retrieving user to replay posts to:", err)
+		return
+	}
+
+	offsets, err := b.db.GetOffsets(username)
+	if err != nil {
+		fmt.Println("Error retrieving offsets:", err)
+		return
+	}
+
+	replayed := 0
+	for _, group := range user.Groups {
+		offset := offsets[group]
+		acked := make(map[uint64]bool, len(offset.Acked))
+		for _, id := range offset.Acked {
+			acked[id] = true
+		}
+		query := store.PostQuery{After: offset.Offset, Limit: maxPostLimit}
+		for {
+			posts, err := b.db.ListPosts(group, query)
+			if err != nil {
+				fmt.Printf("Error retrieving posts of group %s to replay: %v\n", group, err)
+				break
+			}
+
+			for _, post := range posts {
+				if acked[post.Id] { // received, but after a post the user missed
+					continue
+				}
+				if err := b.sendPost(address, post); err != nil {
+					fmt.Printf("Stopped replaying posts to %s: %v\n", username, err) // user went offline again, retry on next reconnect
+					return
+				}
+				replayed++
+			}
+
+			if len(posts) < query.Limit || posts[len(posts)-1].Id <= query.After { // ids that do not advance would repeat the page
+				break
+			}
+			query.After = posts[len(posts)-1].Id
+		}
+	}
+
+	fmt.Printf("Replayed %d missed posts to %s\n", replayed, username)
+}
+
+// sendPost() sends a single post to a client over its pooled connection, without asking it to gossip the post any
+// further
+func (b *Broker) sendPost(address string, post types.Post) error {
+	msg := types.GossipMessage{
+		Id:        post.Id,
+		Group:     post.Group,
+		Author:    post.Author,
+		Timestamp: post.Timestamp,
+		Body:      post.Body,
+		KeyEpoch:  post.KeyEpoch, // encrypted posts are replayed as they were stored
+	}
+	b.postSigner.Sign(&msg)
+
+	return b.gossipPool.Send(address, types.MsgGossip, msg)
+}
+
+// openStore() opens the store selected in the config
+func openStore(cfg config.Server) (store.Store, error) {
+	switch cfg.Store {
+	case "mongo":
+		return store.NewMongoStore(cfg.MongoURI, cfg.Database)
+	case "file":
+		return store.NewFileStore(cfg.DataFile)
+	}
+
+	return nil, fmt.Errorf("unknown store %s", cfg.Store)
+}
+
+// listenForConnections() listens for client connections and handles them, until the listener is closed
+func (b *Broker) listenForConnections(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) { // shutting down
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error accepting connection: %v\n", err)
+			continue
+		}
+		go b.handleConnection(conn)
+	}
+}
+
+// listenForLeaderMessages() listens for leader election and replication messages from other servers and the gateway,
+// until the listener is closed
+func (b *Broker) listenForLeaderMessages(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) { // shutting down
+			return
+		}
+		if err != nil {
+			continue
+		}
+		go b.raftNode.HandleConn(conn)
+	}
+}
+
+// sendHeartbeats() registers this server with the gateway, then tells the gateway it is up every interval, on a
+// long-lived connection that is redialed if it breaks, until ctx is cancelled. The registration is repeated every
+// registrationRefresh heartbeats, so a restarted gateway relearns all servers
+func (b *Broker) sendHeartbeats(ctx context.Context, registration types.Registration, interval time.Duration) {
+	gatewayAddr := b.config.GatewayServerAddress()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for seq := uint64(0); ; seq++ {
+		if seq%registrationRefresh == 0 {
+			if err := b.gatewayPool.Send(gatewayAddr, types.MsgRegister, registration); err != nil {
+				fmt.Println("failed to register with gateway:", err)
+			}
+		}
+
+		heartbeat := types.Heartbeat{NodeId: registration.NodeId, Seq: seq, Interval: interval}
+		if err := b.gatewayPool.Send(gatewayAddr, types.MsgHeartbeat, heartbeat); err != nil {
+			fmt.Println("failed to send heartbeat to gateway:", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deregister() tells the gateway this server is shutting down, so requests stop being routed to it at once
+func (b *Broker) deregister() {
+	err := b.gatewayPool.Send(b.config.GatewayServerAddress(), types.MsgDeregister, types.Deregistration{NodeId: b.nodeId})
+	if err != nil {
+		fmt.Println("failed to deregister from gateway:", err)
+	}
+}
+
+// loadNodeId() reads this server's node id from path, or generates one and saves it there on first start, so the id
+// stays the same across restarts
+func loadNodeId(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("Error reading node id: %v", err)
+	}
+
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("Error generating node id: %v", err)
+	}
+	nodeId := hex.EncodeToString(random)
+
+	if err := os.WriteFile(path, []byte(nodeId+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("Error saving node id: %v", err)
+	}
+
+	return nodeId, nil
+}
@@ -0,0 +1,1253 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sjsu-pub-sub/auth"
+	"sjsu-pub-sub/e2e"
+	"sjsu-pub-sub/raft"
+	"sjsu-pub-sub/store"
+	"sjsu-pub-sub/types"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Handler() returns the HTTP API the gateway forwards client requests to, so it can also be mounted in another server
+func (b *Broker) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/register", b.registerClientHandler)             // register a new user
+	mux.HandleFunc("/login", b.loginHandler)                         // log in an existing user
+	mux.HandleFunc("/claim", b.claimHandler)                         // set the password of a user registered before passwords
+	mux.HandleFunc("/refresh", b.refreshHandler)                     // renew the session of a logged in user
+	mux.HandleFunc("/groups", b.getAllGroupsHandler)                 // get all groups the user may see
+	mux.HandleFunc("/groups/", b.groupHandler)                       // get a group's members and roles, a page of its posts or its keys
+	mux.HandleFunc("/joingroup", b.joinGroupHandler)                 // join a group
+	mux.HandleFunc("/writepost", b.writePostHandler)                 // write a post to a group
+	mux.HandleFunc("/leavegroup", b.leaveGroupHandler)               // leave a group
+	mux.HandleFunc("/user", b.getUserHandler)                        // get a user and their groups
+	mux.HandleFunc("/creategroup", b.createGroupHandler)             // create a new group
+	mux.HandleFunc("/deletegroup", b.deleteGroupHandler)             // delete a group the user owns
+	mux.HandleFunc("/transferownership", b.transferOwnershipHandler) // hand a group over to a groupmate
+	mux.HandleFunc("/ackpost", b.ackPostHandler)                     // acknowledge a received post
+	mux.HandleFunc("/invite", b.inviteHandler)                       // invite a user to a group
+	mux.HandleFunc("/requestjoin", b.requestJoinHandler)             // ask to join a private group
+	mux.HandleFunc("/approverequest", b.approveRequestHandler)       // let in a user who asked to join
+	mux.HandleFunc("/declinerequest", b.declineRequestHandler)       // turn down a user who asked to join
+	mux.HandleFunc("/setrole", b.setRoleHandler)                     // change a groupmate's role
+	mux.HandleFunc("/setvisibility", b.setVisibilityHandler)         // make a group public or private
+	mux.HandleFunc("/publishkey", b.publishKeyHandler)               // publish the key group keys are sealed to
+	mux.HandleFunc("/encryptgroup", b.encryptGroupHandler)           // make a group's posts end-to-end encrypted
+	mux.HandleFunc("/sharegroupkey", b.shareGroupKeyHandler)         // share or replace an encrypted group's key
+
+	return mux
+}
+
+// registerClientHandler() receives requests to register a new user with a password, and logs them in. Users registered
+// before passwords existed cannot register again, and claim their username through claimHandler() instead
+func (b *Broker) registerClientHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	username := r.Form.Get("username")
+	password := r.Form.Get("password")
+
+	if username == "" {
+		http.Error(w, "Username is required", http.StatusBadRequest)
+		return
+	}
+	if len(password) < auth.MinPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be at least %d characters", auth.MinPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	_, err = b.db.GetUser(username)
+	if err == nil { // check if username is taken
+		http.Error(w, "Username already exists", http.StatusConflict)
+		return
+	}
+	if err != store.ErrUserNotFound {
+		http.Error(w, "Error checking username", http.StatusInternalServerError)
+		return
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		return
+	}
+
+	// insert user on all servers. Another request may have registered the same username concurrently
+	_, err = b.replicate(types.Command{Op: types.OpRegister, Username: username, PasswordHash: hash})
+	if err == store.ErrUserExists {
+		http.Error(w, "Username already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		replicationFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Registered new user %s!\n", username)
+	b.startSession(w, username)
+}
+
+// loginHandler() receives requests for an existing user to log in with their password
+func (b *Broker) loginHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	username := r.Form.Get("username")
+	password := r.Form.Get("password")
+
+	if !b.raftNode.Ready() { // DB may be missing users registered while this server was down
+		http.Error(w, "Server is catching up with the cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	user, err := b.db.GetUser(username)
+	if err == store.ErrUserNotFound {
+		http.Error(w, "Username does not exist", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+
+	if user.PasswordHash == "" {
+		http.Error(w, "User has no password yet, claim the username with a token from an admin to set one", http.StatusForbidden)
+		return
+	}
+	if !auth.CheckPassword(user.PasswordHash, password) {
+		fmt.Printf("Wrong password for user %s\n", username)
+		http.Error(w, "Wrong username or password", http.StatusUnauthorized)
+		return
+	}
+
+	fmt.Printf("Logged in user %s!\n", username)
+	b.startSession(w, username)
+}
+
+// claimHandler() receives requests to set the password of a user registered before passwords existed, and logs them
+// in. The claim token an admin issued for the username proves the request comes from its owner. It works only while the
+// user has no password, so it cannot be used twice
+func (b *Broker) claimHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	username := r.Form.Get("username")
+	password := r.Form.Get("password")
+
+	claimed, err := b.sessions.VerifyClaim(r.Form.Get("token"))
+	if err != nil || claimed != username {
+		http.Error(w, "Claim token is invalid, expired or for another user", http.StatusForbidden)
+		return
+	}
+	if len(password) < auth.MinPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be at least %d characters", auth.MinPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = b.replicate(types.Command{Op: types.OpClaimUser, Username: username, PasswordHash: hash})
+	if err == store.ErrUserNotFound {
+		http.Error(w, "Username does not exist", http.StatusNotFound)
+		return
+	}
+	if err == store.ErrUserExists {
+		http.Error(w, "User already has a password", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		replicationFailed(w, err)
+		return
+	}
+
+	fmt.Printf("User %s claimed their username!\n", username)
+	b.startSession(w, username)
+}
+
+// refreshHandler() receives requests to renew the session of a logged in user before it expires, so a client staying
+// up longer than a session can still log in to servers coming back
+func (b *Broker) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	b.startSession(w, username)
+}
+
+// startSession() issues a session token to a user who proved who they are
+func (b *Broker) startSession(w http.ResponseWriter, username string) {
+	token, expires := b.sessions.Issue(username)
+
+	sessionJSON, err := json.Marshal(types.UserSession{
+		Username: username,
+		Token:    token,
+		Expires:  expires,
+	})
+	if err != nil {
+		http.Error(w, "Error marshalling session to JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(sessionJSON)
+}
+
+// sessionUser() returns the user whose session token came with a request, from an "Authorization: Bearer" header.
+// Answers 401 and returns false if the token is missing, invalid or expired
+func (b *Broker) sessionUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		http.Error(w, "Log in first", http.StatusUnauthorized)
+		return "", false
+	}
+
+	username, err := b.sessions.Verify(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return "", false
+	}
+
+	return username, true
+}
+
+// viewerUser() returns the user whose session token came with a read request, or an empty string for anonymous
+// requests, which only see public groups. Answers 401 and returns false if a token came but is invalid or expired
+func (b *Broker) viewerUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Header.Get("Authorization") == "" {
+		return "", true
+	}
+	return b.sessionUser(w, r)
+}
+
+// getAllGroupsHandler() receives requests to return the name, creator, owner, member count and visibility of all
+// groups the user may see
+func (b *Broker) getAllGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := b.viewerUser(w, r)
+	if !ok {
+		return
+	}
+
+	fmt.Printf("Retrieving all groups...\n")
+
+	if !b.raftNode.Ready() { // DB may be missing writes made while this server was down
+		http.Error(w, "Server is catching up with the cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	groups, err := b.db.ListGroupSummaries(viewer) // get all groups the user may see, without their posts
+	if err != nil {
+		http.Error(w, "Error retrieving groups", http.StatusInternalServerError)
+		return
+	}
+
+	groupsJSON, err := json.Marshal(groups)
+	if err != nil {
+		http.Error(w, "Error marshalling groups to JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(groupsJSON)
+	fmt.Printf("Retrieved all groups!\n")
+}
+
+// groupHandler() sends requests for /groups/{name} to getGroupHandler(), for /groups/{name}/posts to
+// getGroupPostsHandler() and for /groups/{name}/keys to getGroupKeysHandler()
+func (b *Broker) groupHandler(w http.ResponseWriter, r *http.Request) {
+	group, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/groups/"), "/")
+
+	switch {
+	case group == "" || strings.Contains(resource, "/"):
+		http.NotFound(w, r)
+	case resource == "posts":
+		b.getGroupPostsHandler(w, r, group)
+	case resource == "keys":
+		b.getGroupKeysHandler(w, r, group)
+	case resource == "" && !strings.HasSuffix(r.URL.Path, "/"):
+		b.getGroupHandler(w, r, group)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// validGroupName() checks a new group's name can be used in /groups/{name} URLs
+func validGroupName(name string) bool {
+	if len(name) > maxGroupName || strings.HasPrefix(name, " ") || strings.HasPrefix(name, ".") {
+		return false
+	}
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune(" -_.", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// visibleGroup() returns a group for a user reading it. Answers 404 and returns false if the group does not exist or
+// is private to others, so private groups cannot be found by guessing their name
+func (b *Broker) visibleGroup(w http.ResponseWriter, name string, viewer string) (types.Group, bool) {
+	group, err := b.db.GetGroup(name)
+	if err == store.ErrGroupNotFound || (err == nil && !group.VisibleTo(viewer)) {
+		http.Error(w, "Group name does not exist", http.StatusNotFound)
+		return types.Group{}, false
+	}
+	if err != nil {
+		http.Error(w, "Error retrieving group", http.StatusInternalServerError)
+		return types.Group{}, false
+	}
+
+	return group, true
+}
+
+// getGroupHandler() receives requests to return a group with the role of each groupmate. Only the owner and
+// moderators see who was invited and who asked to join
+func (b *Broker) getGroupHandler(w http.ResponseWriter, r *http.Request, name string) {
+	viewer, ok := b.viewerUser(w, r)
+	if !ok {
+		return
+	}
+
+	fmt.Printf("Retrieving group %s...\n", name)
+
+	if !b.raftNode.Ready() { // DB may be missing writes made while this server was down
+		http.Error(w, "Server is catching up with the cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	group, ok := b.visibleGroup(w, name, viewer)
+	if !ok {
+		return
+	}
+
+	info := types.GroupInfo{
+		GroupSummary: group.Summary(),
+		Roles:        make(map[string]string),
+	}
+	for _, mate := range group.GroupMates {
+		info.Roles[mate] = group.Role(mate)
+	}
+	if group.Allows(viewer, types.RoleModerator) {
+		info.Invited = group.ACL.Invited
+		info.Requested = group.ACL.Requested
+	}
+
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		http.Error(w, "Error marshalling group to JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(infoJSON)
+	fmt.Printf("Retrieved group %s!\n", name)
+}
+
+// getGroupPostsHandler() receives requests for a page of a group's posts. Supports after (post id to continue from),
+// limit, author, since and until (RFC 3339 times) query parameters. Posts of private groups are only shown to
+// groupmates
+func (b *Broker) getGroupPostsHandler(w http.ResponseWriter, r *http.Request, group string) {
+	viewer, ok := b.viewerUser(w, r)
+	if !ok {
+		return
+	}
+
+	fmt.Printf("Retrieving posts of group %s...\n", group)
+
+	if !b.raftNode.Ready() { // DB may be missing writes made while this server was down
+		http.Error(w, "Server is catching up with the cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	groupInfo, ok := b.visibleGroup(w, group, viewer)
+	if !ok {
+		return
+	}
+	if !groupInfo.Readable(viewer) { // invited, but not joined yet
+		http.Error(w, "Join the group to read its posts", http.StatusForbidden)
+		return
+	}
+
+	params := r.URL.Query()
+	query := store.PostQuery{
+		Limit:  defaultPostLimit,
+		Author: params.Get("author"),
+	}
+
+	var err error
+	if after := params.Get("after"); after != "" {
+		if query.After, err = strconv.ParseUint(after, 10, 64); err != nil {
+			http.Error(w, "Invalid after post id", http.StatusBadRequest)
+			return
+		}
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		if query.Limit > maxPostLimit {
+			query.Limit = maxPostLimit
+		}
+	}
+	if since := params.Get("since"); since != "" {
+		if query.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			http.Error(w, "Invalid since time", http.StatusBadRequest)
+			return
+		}
+	}
+	if until := params.Get("until"); until != "" {
+		if query.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			http.Error(w, "Invalid until time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	posts, err := b.db.ListPosts(group, query)
+	if err == store.ErrGroupNotFound {
+		http.Error(w, "Group name does not exist", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error retrieving posts", http.StatusInternalServerError)
+		return
+	}
+
+	page := types.PostPage{Posts: posts}
+	if len(posts) == query.Limit { // page is full, so there may be more posts
+		page.Next = posts[len(posts)-1].Id
+	}
+
+	pageJSON, err := json.Marshal(page)
+	if err != nil {
+		http.Error(w, "Error marshalling posts to JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(pageJSON)
+	fmt.Printf("Retrieved %d posts of group %s!\n", len(posts), group)
+}
+
+// getGroupKeysHandler() receives requests from a groupmate for what they need to read and write an end-to-end
+// encrypted group: the group keys sealed to them, the public keys of their groupmates and who holds the current key
+func (b *Broker) getGroupKeysHandler(w http.ResponseWriter, r *http.Request, name string) {
+	username, ok := b.sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	fmt.Printf("Retrieving keys of group %s for %s...\n", name, username)
+
+	if !b.raftNode.Ready() { // DB may be missing writes made while this server was down
+		http.Error(w, "Server is catching up with the cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	group, ok := b.visibleGroup(w, name, username)
+	if !ok {
+		return
+	}
+	if group.Role(username) == "" {
+		http.Error(w, "Join the group to get its keys", http.StatusForbidden)
+		return
+	}
+
+	keyring := types.GroupKeyring{
+		Enabled:    group.Encryption.Enabled,
+		Epoch:      group.Encryption.Epoch(),
+		Keys:       make(map[uint64]string),
+		PublicKeys: make(map[string]string),
+		Holders:    group.Encryption.Holders(),
+	}
+	for _, key := range group.Encryption.Keys {
+		if sealed, ok := key.Sealed[username]; ok {
+			keyring.Keys[key.Epoch] = sealed
+		}
+	}
+	for _, mate := range group.GroupMates {
+		user, err := b.db.GetUser(mate)
+		if err != nil && err != store.ErrUserNotFound {
+			http.Error(w, "Error retrieving groupmates", http.StatusInternalServerError)
+			return
+		}
+		keyring.PublicKeys[mate] = user.PublicKey
+	}
+
+	keyringJSON, err := json.Marshal(keyring)
+	if err != nil {
+		http.Error(w, "Error marshalling keys to JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(keyringJSON)
+	fmt.Printf("Retrieved keys of group %s for %s!\n", name, username)
+}
+
+// joinGroupHandler() receives requests for a user to join a group, if it exists
+func (b *Broker) joinGroupHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+
+	fmt.Printf("Received request for username %s to join group %s...\n", username, group)
+
+	_, err = b.replicate(types.Command{Op: types.OpJoinGroup, Username: username, GroupName: group})
+	if err == store.ErrGroupNotFound {
+		http.Error(w, "Group name does not exist", http.StatusNotFound)
+		return
+	}
+	if err == errNotInvited {
+		http.Error(w, "Group is private, ask to join it or get invited", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		replicationFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully joined group %s!\n", username, group)
+	w.WriteHeader(http.StatusOK)
+}
+
+// leaveGroupHandler() receives requests for a user to leave a group, so they stop receiving its posts
+func (b *Broker) leaveGroupHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+
+	fmt.Printf("Received request for username %s to leave group %s...\n", username, group)
+
+	_, err = b.replicate(types.Command{Op: types.OpLeaveGroup, Username: username, GroupName: group})
+	if err == store.ErrGroupNotFound {
+		http.Error(w, "Group name does not exist", http.StatusNotFound)
+		return
+	}
+	if err == errOwnerLeft {
+		http.Error(w, "Group owner must transfer ownership or delete the group before leaving", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		replicationFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully left group %s!\n", username, group)
+	w.WriteHeader(http.StatusOK)
+}
+
+// getUserHandler() receives requests to return a user and the groups they are in. Private groups are left out unless
+// the user asks about themselves or is in them too
+func (b *Broker) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := b.viewerUser(w, r)
+	if !ok {
+		return
+	}
+
+	username := r.URL.Query().Get("username")
+
+	fmt.Printf("Retrieving user %s...\n", username)
+
+	if !b.raftNode.Ready() { // DB may be missing writes made while this server was down
+		http.Error(w, "Server is catching up with the cluster", http.StatusServiceUnavailable)
+		return
+	}
+
+	user, err := b.db.GetUser(username)
+	if err == store.ErrUserNotFound {
+		http.Error(w, "Username does not exist", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+
+	user.PasswordHash = "" // only servers need it
+
+	if viewer != username {
+		visible := []string{}
+		for _, name := range user.Groups {
+			group, err := b.db.GetGroup(name)
+			if err == nil && group.VisibleTo(viewer) {
+				visible = append(visible, name)
+			}
+		}
+		user.Groups = visible
+	}
+
+	userJSON, err := json.Marshal(user)
+	if err != nil {
+		http.Error(w, "Error marshalling user to JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(userJSON)
+	fmt.Printf("Retrieved user %s!\n", username)
+}
+
+// createGroupHandler() receives requests for a user to create a new group, which they own and are the first member of.
+// Groups are public unless visibility is private, and post in clear unless encrypted is true
+func (b *Broker) createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+	visibility := r.Form.Get("visibility")
+	encrypted := r.Form.Get("encrypted") == "true"
+
+	if username == "" || group == "" {
+		http.Error(w, "Username and group name are required", http.StatusBadRequest)
+		return
+	}
+	if !validGroupName(group) {
+		http.Error(w, fmt.Sprintf("Group name must be at most %d letters, digits, spaces, '-', '_' or '.', and not start with a space or '.'", maxGroupName), http.StatusBadRequest)
+		return
+	}
+	if visibility == "" {
+		visibility = types.VisibilityPublic
+	}
+	if visibility != types.VisibilityPublic && visibility != types.VisibilityPrivate {
+		http.Error(w, "Visibility must be public or private", http.StatusBadRequest)
+		return
+	}
+
+	fmt.Printf("Received request for username %s to create %s group %s...\n", username, visibility, group)
+
+	cmd := types.Command{Op: types.OpCreateGroup, Username: username, GroupName: group, Visibility: visibility, Encrypted: encrypted}
+
+	_, err = b.replicate(cmd)
+	if err == store.ErrGroupExists {
+		http.Error(w, "Group name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		replicationFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully created group %s!\n", username, group)
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteGroupHandler() receives requests for the owner of a group to delete it
+func (b *Broker) deleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+
+	fmt.Printf("Received request for username %s to delete group %s...\n", username, group)
+
+	_, err = b.replicate(types.Command{Op: types.OpDeleteGroup, Username: username, GroupName: group})
+	if err == store.ErrGroupNotFound {
+		http.Error(w, "Group name does not exist", http.StatusNotFound)
+		return
+	}
+	if err == errNotOwner {
+		http.Error(w, "Only the group owner can delete a group", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		replicationFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully deleted group %s!\n", username, group)
+	w.WriteHeader(http.StatusOK)
+}
+
+// transferOwnershipHandler() receives requests for the owner of a group to hand it over to another groupmate
+func (b *Broker) transferOwnershipHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+	newOwner := r.Form.Get("newowner")
+
+	fmt.Printf("Received request for username %s to transfer group %s to %s...\n", username, group, newOwner)
+
+	_, err = b.replicate(types.Command{Op: types.OpTransferOwnership, Username: username, GroupName: group, NewOwner: newOwner})
+	if err == store.ErrGroupNotFound {
+		http.Error(w, "Group name does not exist", http.StatusNotFound)
+		return
+	}
+	if err == errNotOwner {
+		http.Error(w, "Only the group owner can transfer ownership", http.StatusForbidden)
+		return
+	}
+	if err == errNotMember {
+		http.Error(w, "New owner must be a member of the group", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		replicationFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully transferred group %s to %s!\n", username, group, newOwner)
+	w.WriteHeader(http.StatusOK)
+}
+
+// inviteHandler() receives requests for the owner or a moderator of a group to invite a user, who may then join it
+// even if it is private
+func (b *Broker) inviteHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+	member := r.Form.Get("member")
+
+	fmt.Printf("Received request for username %s to invite %s to group %s...\n", username, member, group)
+
+	_, err = b.replicate(types.Command{Op: types.OpInvite, Username: username, GroupName: group, Member: member})
+	if err != nil {
+		groupRequestFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully invited %s to group %s!\n", username, member, group)
+	w.WriteHeader(http.StatusOK)
+}
+
+// requestJoinHandler() receives requests for a user to ask the owner and moderators of a private group to let them in
+func (b *Broker) requestJoinHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+
+	fmt.Printf("Received request for username %s to ask to join group %s...\n", username, group)
+
+	_, err = b.replicate(types.Command{Op: types.OpRequestJoin, Username: username, GroupName: group})
+	if err != nil {
+		groupRequestFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully asked to join group %s!\n", username, group)
+	w.WriteHeader(http.StatusOK)
+}
+
+// approveRequestHandler() receives requests for the owner or a moderator of a group to let in a user who asked to join
+func (b *Broker) approveRequestHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+	member := r.Form.Get("member")
+
+	fmt.Printf("Received request for username %s to let %s into group %s...\n", username, member, group)
+
+	_, err = b.replicate(types.Command{Op: types.OpApproveJoin, Username: username, GroupName: group, Member: member})
+	if err != nil {
+		groupRequestFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully let %s into group %s!\n", username, member, group)
+	w.WriteHeader(http.StatusOK)
+}
+
+// declineRequestHandler() receives requests for the owner or a moderator of a group to turn down a user who asked to
+// join
+func (b *Broker) declineRequestHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+	member := r.Form.Get("member")
+
+	fmt.Printf("Received request for username %s to turn %s down from group %s...\n", username, member, group)
+
+	_, err = b.replicate(types.Command{Op: types.OpDeclineJoin, Username: username, GroupName: group, Member: member})
+	if err != nil {
+		groupRequestFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully turned %s down from group %s!\n", username, member, group)
+	w.WriteHeader(http.StatusOK)
+}
+
+// setRoleHandler() receives requests for the owner of a group to make a groupmate a moderator, member or read-only
+func (b *Broker) setRoleHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+	member := r.Form.Get("member")
+	role := r.Form.Get("role")
+
+	if role != types.RoleModerator && role != types.RoleMember && role != types.RoleReadOnly {
+		http.Error(w, "Role must be moderator, member or readonly", http.StatusBadRequest)
+		return
+	}
+
+	fmt.Printf("Received request for username %s to make %s %s of group %s...\n", username, member, role, group)
+
+	_, err = b.replicate(types.Command{Op: types.OpSetRole, Username: username, GroupName: group, Member: member, Role: role})
+	if err != nil {
+		groupRequestFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully made %s %s of group %s!\n", username, member, role, group)
+	w.WriteHeader(http.StatusOK)
+}
+
+// setVisibilityHandler() receives requests for the owner of a group to make it public or private
+func (b *Broker) setVisibilityHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+	visibility := r.Form.Get("visibility")
+
+	if visibility != types.VisibilityPublic && visibility != types.VisibilityPrivate {
+		http.Error(w, "Visibility must be public or private", http.StatusBadRequest)
+		return
+	}
+
+	fmt.Printf("Received request for username %s to make group %s %s...\n", username, group, visibility)
+
+	_, err = b.replicate(types.Command{Op: types.OpSetVisibility, Username: username, GroupName: group, Visibility: visibility})
+	if err != nil {
+		groupRequestFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully made group %s %s!\n", username, group, visibility)
+	w.WriteHeader(http.StatusOK)
+}
+
+// publishKeyHandler() receives requests for a user to publish the public key their groupmates seal group keys to
+func (b *Broker) publishKeyHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	publicKey := r.Form.Get("publickey")
+
+	if _, err := e2e.ParseKey(publicKey); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fmt.Printf("Received request for username %s to publish a public key...\n", username)
+
+	_, err = b.replicate(types.Command{Op: types.OpPublishKey, Username: username, PublicKey: publicKey})
+	if err == store.ErrUserNotFound {
+		http.Error(w, "Username does not exist", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		replicationFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully published a public key!\n", username)
+	w.WriteHeader(http.StatusOK)
+}
+
+// encryptGroupHandler() receives requests for the owner of a group to make its posts end-to-end encrypted
+func (b *Broker) encryptGroupHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+
+	fmt.Printf("Received request for username %s to encrypt group %s...\n", username, group)
+
+	_, err = b.replicate(types.Command{Op: types.OpEncryptGroup, Username: username, GroupName: group})
+	if err != nil {
+		groupRequestFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully encrypted group %s!\n", username, group)
+	w.WriteHeader(http.StatusOK)
+}
+
+// shareGroupKeyHandler() receives requests for a groupmate to share an encrypted group's key with groupmates lacking
+// it, or, if newkey is true, to replace it with a new key. sealed is a JSON object of the key sealed to each groupmate
+func (b *Broker) shareGroupKeyHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+
+	epoch, err := strconv.ParseUint(r.Form.Get("keyepoch"), 10, 64)
+	if err != nil || epoch == 0 {
+		http.Error(w, "Invalid key epoch", http.StatusBadRequest)
+		return
+	}
+
+	var sealed map[string]string
+	if err := json.Unmarshal([]byte(r.Form.Get("sealed")), &sealed); err != nil || len(sealed) == 0 {
+		http.Error(w, "Sealed keys must be a JSON object of sealed keys by username", http.StatusBadRequest)
+		return
+	}
+
+	newKey := r.Form.Get("newkey") == "true"
+
+	fmt.Printf("Received request for username %s to share key %d of group %s with %d groupmates...\n", username, epoch, group, len(sealed))
+
+	_, err = b.replicate(types.Command{Op: types.OpShareGroupKey, Username: username, GroupName: group, KeyEpoch: epoch, Sealed: sealed, NewKey: newKey})
+	if err != nil {
+		groupRequestFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully shared key %d of group %s!\n", username, epoch, group)
+	w.WriteHeader(http.StatusOK)
+}
+
+// writePostHandler() receives requests for a user to write a post to a group, and if successful kickstarts gossip protocol.
+// Posts to an end-to-end encrypted group come encrypted, with keyepoch naming the group key used
+func (b *Broker) writePostHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+	post := r.Form.Get("post")
+	if len(post) > maxPostSize {
+		http.Error(w, fmt.Sprintf("Post must not be longer than %d bytes", maxPostSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var epoch uint64
+	if value := r.Form.Get("keyepoch"); value != "" {
+		if epoch, err = strconv.ParseUint(value, 10, 64); err != nil {
+			http.Error(w, "Invalid key epoch", http.StatusBadRequest)
+			return
+		}
+	}
+
+	fmt.Printf("Received request for username %s to post \"%s\" in group %s...\n", username, post, group)
+
+	cmd := types.Command{
+		Op:        types.OpWritePost,
+		Username:  username,
+		GroupName: group,
+		Post:      post,
+		Timestamp: time.Now().UTC(),
+		KeyEpoch:  epoch,
+	}
+
+	index, err := b.replicate(cmd) // post id is derived from the index of the post in the replicated log
+	if err == store.ErrGroupNotFound {
+		http.Error(w, "Group name does not exist", http.StatusNotFound)
+		return
+	}
+	if err == errForbidden {
+		http.Error(w, "Only groupmates who are not read-only can post in a group", http.StatusForbidden)
+		return
+	}
+	if err == errStaleKey {
+		http.Error(w, "Group is end-to-end encrypted, encrypt the post with its current key", http.StatusConflict)
+		return
+	}
+	if err == errNotEncrypted {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		replicationFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s successfully posted \"%s\" in group %s!\n", username, post, group)
+	w.WriteHeader(http.StatusOK)
+
+	b.groupMembers.RLock()
+	groupMates := b.groupMembers.members[group] // get groupmates to gossip to
+	b.groupMembers.RUnlock()
+
+	fmt.Println("Initiating gossip to groupmates...")
+
+	connListToWrite := []string{} // get list of active groupmates of above group
+	b.activeConns.RLock()
+	for _, user := range groupMates {
+		conn, ok := b.activeConns.connections[user]
+		if ok {
+			connListToWrite = append(connListToWrite, conn)
+		}
+	}
+	b.activeConns.RUnlock()
+
+	if len(connListToWrite) == 0 { // terminate as no clients to gossip to
+		fmt.Println("No clients active currently!")
+		return
+	}
+
+	for _, elem := range connListToWrite {
+		fmt.Println(elem)
+	}
+
+	msg := types.GossipMessage{
+		Id:         types.PostId(index), // used by clients to see what gossip they're receiving
+		Group:      group,
+		Author:     username,
+		Timestamp:  cmd.Timestamp,
+		Body:       post,
+		KeyEpoch:   epoch,
+		GroupMates: connListToWrite, // signed, so clients only exchange digests with groupmates the server vouched for
+	}
+	b.postSigner.Sign(&msg) // relaying clients cannot change the post without its groupmates noticing
+
+	if b.raftNode.IsLeader() { // only leaders can multicast
+		b.gossipEngine.Publish(msg, connListToWrite) // seed the first clients, which gossip with all other clients
+
+		stats := b.gossipEngine.Stats()
+		fmt.Printf("Seeded post to groupmates! %d posts published, %d seeds sent\n", stats.Published, stats.Forwarded)
+	}
+
+	return
+}
+
+// ackPostHandler() receives requests for a user to acknowledge posts of a group, one id per post, so they are not sent
+// again when the user reconnects
+func (b *Broker) ackPostHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := b.sessionUser(w, r) // act as the logged in user, whatever the form says
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	group := r.Form.Get("groupname")
+
+	if len(r.Form["id"]) == 0 || len(r.Form["id"]) > maxAcksPerRequest {
+		http.Error(w, fmt.Sprintf("Acknowledge between 1 and %d posts at once", maxAcksPerRequest), http.StatusBadRequest)
+		return
+	}
+	ids := make([]uint64, 0, len(r.Form["id"]))
+	for _, value := range r.Form["id"] {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid post id", http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	_, err = b.replicate(types.Command{Op: types.OpAckPost, Username: username, GroupName: group, PostIds: ids})
+	if err == store.ErrGroupNotFound {
+		http.Error(w, "Group name does not exist", http.StatusNotFound)
+		return
+	}
+	if err == errNoPost {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == errNotMember {
+		http.Error(w, "Only groupmates can acknowledge posts of a group", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		replicationFailed(w, err)
+		return
+	}
+
+	fmt.Printf("Username %s acknowledged %d posts in group %s\n", username, len(ids), group)
+	w.WriteHeader(http.StatusOK)
+}
+
+// replicate() appends a mutation to the replicated log and waits until a quorum of servers persisted it and this server
+// applied it. Returns the mutation's index in the log
+func (b *Broker) replicate(cmd types.Command) (uint64, error) {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return 0, err
+	}
+
+	return b.raftNode.Propose(data, replicationTimeout)
+}
+
+// groupRequestFailed() tells the client why a write to a group's access control was refused, or that it was not
+// acknowledged by a quorum of servers
+func groupRequestFailed(w http.ResponseWriter, err error) {
+	switch err {
+	case store.ErrGroupNotFound:
+		http.Error(w, "Group name does not exist", http.StatusNotFound)
+	case store.ErrUserNotFound:
+		http.Error(w, "Username does not exist", http.StatusNotFound)
+	case errNoRequest:
+		http.Error(w, "User has not asked to join the group", http.StatusNotFound)
+	case errNotOwner, errForbidden, errOwnerRole:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errNotMember, errPublicGroup, errNotEncrypted:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errAlreadyMember, errStaleKey:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		replicationFailed(w, err)
+	}
+}
+
+// replicationFailed() tells the client a write was not acknowledged by a quorum of servers
+func replicationFailed(w http.ResponseWriter, err error) {
+	fmt.Println("Error replicating write:", err)
+
+	if err == raft.ErrNotLeader {
+		http.Error(w, "Server is not the leader", http.StatusServiceUnavailable)
+		return
+	}
+
+	http.Error(w, "Error replicating write", http.StatusInternalServerError)
+}
@@ -0,0 +1,414 @@
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sjsu-pub-sub/auth"
+	"sjsu-pub-sub/config"
+	"sjsu-pub-sub/store"
+	"sjsu-pub-sub/types"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPassword = "password123"
+
+// newTestBroker() creates a broker with an in-memory file store that is the only server of its cluster, and waits
+// until it is elected leader so writes are accepted
+func newTestBroker(t *testing.T) *Broker {
+	t.Helper()
+
+	signingKey, _, err := auth.GeneratePostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultServer()
+	cfg.Host = "127.0.0.1"
+	cfg.NodeId = "test"
+	cfg.Store = "file"
+	cfg.DataFile = "" // in memory only
+	cfg.RaftState = filepath.Join(t.TempDir(), "raft.json")
+	cfg.SessionSecret = "test session secret"
+	cfg.SigningKey = signingKey
+
+	b, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go b.raftNode.Run()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !b.raftNode.IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatal("broker was not elected leader")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return b
+}
+
+// send() sends a request to a handler as the user token belongs to, or anonymously if token is empty. Forms are sent
+// in the body of POST requests
+func send(h http.Handler, method string, path string, token string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	if method == http.MethodPost {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// register() registers a user and returns their session token
+func register(t *testing.T, h http.Handler, username string) string {
+	t.Helper()
+
+	w := send(h, http.MethodPost, "/register", "", url.Values{"username": {username}, "password": {testPassword}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("registering %s: got %d %s", username, w.Code, w.Body.String())
+	}
+
+	var session types.UserSession
+	if err := json.Unmarshal(w.Body.Bytes(), &session); err != nil {
+		t.Fatal(err)
+	}
+	return session.Token
+}
+
+// step is one request of a test, sent after the ones before it
+type step struct {
+	name   string
+	method string
+	path   string
+	token  string
+	form   url.Values
+	want   int
+}
+
+// run() sends each step in order and checks the status code of its response
+func run(t *testing.T, h http.Handler, steps []step) {
+	t.Helper()
+
+	for _, s := range steps {
+		method := s.method
+		if method == "" {
+			method = http.MethodPost
+		}
+
+		w := send(h, method, s.path, s.token, s.form)
+		if w.Code != s.want {
+			t.Errorf("%s: got %d %q, want %d", s.name, w.Code, strings.TrimSpace(w.Body.String()), s.want)
+		}
+	}
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBroker(t)
+	h := b.Handler()
+
+	alice := url.Values{"username": {"alice"}, "password": {testPassword}}
+
+	run(t, h, []step{
+		{"register without username", "", "/register", "", url.Values{"password": {testPassword}}, http.StatusBadRequest},
+		{"register with short password", "", "/register", "", url.Values{"username": {"alice"}, "password": {"short"}}, http.StatusBadRequest},
+		{"register", "", "/register", "", alice, http.StatusOK},
+		{"register taken username", "", "/register", "", alice, http.StatusConflict},
+		{"log in", "", "/login", "", alice, http.StatusOK},
+		{"log in with wrong password", "", "/login", "", url.Values{"username": {"alice"}, "password": {"wrong password"}}, http.StatusUnauthorized},
+		{"log in unknown user", "", "/login", "", url.Values{"username": {"bob"}, "password": {testPassword}}, http.StatusNotFound},
+		{"act without session", "", "/joingroup", "", url.Values{"groupname": {"books"}}, http.StatusUnauthorized},
+		{"act with forged session", "", "/joingroup", "forged.token", url.Values{"groupname": {"books"}}, http.StatusUnauthorized},
+	})
+}
+
+func TestRefreshSession(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBroker(t)
+	h := b.Handler()
+
+	alice := register(t, h, "alice")
+	expired, _ := auth.NewSigner("test session secret", -time.Second).Issue("alice")
+
+	run(t, h, []step{
+		{"refresh anonymously", "", "/refresh", "", nil, http.StatusUnauthorized},
+		{"refresh expired session", "", "/refresh", expired, nil, http.StatusUnauthorized},
+	})
+
+	w := send(h, http.MethodPost, "/refresh", alice, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: got %d %q, want %d", w.Code, strings.TrimSpace(w.Body.String()), http.StatusOK)
+	}
+	var session types.UserSession
+	if err := json.Unmarshal(w.Body.Bytes(), &session); err != nil {
+		t.Fatal(err)
+	}
+	if username, err := b.sessions.Verify(session.Token); username != "alice" || err != nil {
+		t.Errorf("renewed token is for %q, %v, want alice", username, err)
+	}
+	if time.Until(session.Expires) < time.Duration(config.DefaultServer().SessionTTL)-time.Minute {
+		t.Errorf("renewed session expires at %v, want a full session from now", session.Expires)
+	}
+}
+
+func TestClaimLegacyUser(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBroker(t)
+	h := b.Handler()
+
+	if err := b.db.CreateUser("legacy", ""); err != nil { // registered before passwords existed
+		t.Fatal(err)
+	}
+
+	token, _ := b.sessions.IssueClaim("legacy", time.Hour)
+	session, _ := b.sessions.Issue("legacy")
+	claim := url.Values{"username": {"legacy"}, "password": {testPassword}, "token": {token}}
+
+	run(t, h, []step{
+		{"log in without password", "", "/login", "", url.Values{"username": {"legacy"}, "password": {testPassword}}, http.StatusForbidden},
+		{"register legacy username", "", "/register", "", url.Values{"username": {"legacy"}, "password": {testPassword}}, http.StatusConflict},
+		{"claim with session token", "", "/claim", "", url.Values{"username": {"legacy"}, "password": {testPassword}, "token": {session}}, http.StatusForbidden},
+		{"claim another username", "", "/claim", "", url.Values{"username": {"other"}, "password": {testPassword}, "token": {token}}, http.StatusForbidden},
+		{"claim with short password", "", "/claim", "", url.Values{"username": {"legacy"}, "password": {"short"}, "token": {token}}, http.StatusBadRequest},
+		{"claim", "", "/claim", "", claim, http.StatusOK},
+		{"claim again", "", "/claim", "", claim, http.StatusConflict},
+		{"log in with claimed password", "", "/login", "", url.Values{"username": {"legacy"}, "password": {testPassword}}, http.StatusOK},
+	})
+}
+
+func TestGroupMembership(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBroker(t)
+	h := b.Handler()
+
+	alice := register(t, h, "alice")
+	bob := register(t, h, "bob")
+
+	books := url.Values{"groupname": {"books"}}
+	post := url.Values{"groupname": {"books"}, "post": {"hello"}}
+
+	run(t, h, []step{
+		{"create group", "", "/creategroup", alice, books, http.StatusOK},
+		{"create taken group name", "", "/creategroup", bob, books, http.StatusConflict},
+		{"create group with slash", "", "/creategroup", alice, url.Values{"groupname": {"a/b"}}, http.StatusBadRequest},
+		{"create hidden group name", "", "/creategroup", alice, url.Values{"groupname": {".books"}}, http.StatusBadRequest},
+		{"create group of unknown visibility", "", "/creategroup", alice, url.Values{"groupname": {"films"}, "visibility": {"secret"}}, http.StatusBadRequest},
+		{"post before joining", "", "/writepost", bob, post, http.StatusForbidden},
+		{"join unknown group", "", "/joingroup", bob, url.Values{"groupname": {"films"}}, http.StatusNotFound},
+		{"join", "", "/joingroup", bob, books, http.StatusOK},
+		{"join again", "", "/joingroup", bob, books, http.StatusOK},
+		{"post", "", "/writepost", bob, post, http.StatusOK},
+		{"post to unknown group", "", "/writepost", bob, url.Values{"groupname": {"films"}, "post": {"hello"}}, http.StatusNotFound},
+		{"post too long", "", "/writepost", bob, url.Values{"groupname": {"books"}, "post": {strings.Repeat("a", maxPostSize+1)}}, http.StatusRequestEntityTooLarge},
+		{"owner leaves", "", "/leavegroup", alice, books, http.StatusConflict},
+		{"delete as member", "", "/deletegroup", bob, books, http.StatusForbidden},
+		{"transfer to non-member", "", "/transferownership", alice, url.Values{"groupname": {"books"}, "newowner": {"carol"}}, http.StatusBadRequest},
+		{"transfer", "", "/transferownership", alice, url.Values{"groupname": {"books"}, "newowner": {"bob"}}, http.StatusOK},
+		{"former owner leaves", "", "/leavegroup", alice, books, http.StatusOK},
+		{"post after leaving", "", "/writepost", alice, post, http.StatusForbidden},
+		{"delete as owner", "", "/deletegroup", bob, books, http.StatusOK},
+		{"join deleted group", "", "/joingroup", alice, books, http.StatusNotFound},
+	})
+}
+
+func TestPrivateGroup(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBroker(t)
+	h := b.Handler()
+
+	alice := register(t, h, "alice")
+	bob := register(t, h, "bob")
+	carol := register(t, h, "carol")
+
+	secret := url.Values{"groupname": {"secret"}}
+
+	run(t, h, []step{
+		{"create private group", "", "/creategroup", alice, url.Values{"groupname": {"secret"}, "visibility": {"private"}}, http.StatusOK},
+		{"read as owner", http.MethodGet, "/groups/secret", alice, nil, http.StatusOK},
+		{"read anonymously", http.MethodGet, "/groups/secret", "", nil, http.StatusNotFound},
+		{"read as outsider", http.MethodGet, "/groups/secret/posts", bob, nil, http.StatusNotFound},
+		{"join uninvited", "", "/joingroup", bob, secret, http.StatusForbidden},
+		{"invite as outsider", "", "/invite", carol, url.Values{"groupname": {"secret"}, "member": {"bob"}}, http.StatusForbidden},
+		{"invite", "", "/invite", alice, url.Values{"groupname": {"secret"}, "member": {"bob"}}, http.StatusOK},
+		{"read posts before joining", http.MethodGet, "/groups/secret/posts", bob, nil, http.StatusForbidden},
+		{"join invited", "", "/joingroup", bob, secret, http.StatusOK},
+		{"read posts as groupmate", http.MethodGet, "/groups/secret/posts", bob, nil, http.StatusOK},
+		{"ask to join", "", "/requestjoin", carol, secret, http.StatusOK},
+		{"approve as member", "", "/approverequest", bob, url.Values{"groupname": {"secret"}, "member": {"carol"}}, http.StatusForbidden},
+		{"approve", "", "/approverequest", alice, url.Values{"groupname": {"secret"}, "member": {"carol"}}, http.StatusOK},
+		{"approve again", "", "/approverequest", alice, url.Values{"groupname": {"secret"}, "member": {"carol"}}, http.StatusNotFound},
+	})
+}
+
+func TestGroupRoutes(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBroker(t)
+	h := b.Handler()
+
+	alice := register(t, h, "alice")
+	run(t, h, []step{{"create group", "", "/creategroup", alice, url.Values{"groupname": {"my books"}}, http.StatusOK}})
+
+	run(t, h, []step{
+		{"list groups", http.MethodGet, "/groups", "", nil, http.StatusOK},
+		{"group", http.MethodGet, "/groups/my%20books", "", nil, http.StatusOK},
+		{"group with trailing slash", http.MethodGet, "/groups/my%20books/", "", nil, http.StatusNotFound},
+		{"posts", http.MethodGet, "/groups/my%20books/posts", "", nil, http.StatusOK},
+		{"posts with extra segment", http.MethodGet, "/groups/my%20books/posts/1", "", nil, http.StatusNotFound},
+		{"unknown resource", http.MethodGet, "/groups/my%20books/members", "", nil, http.StatusNotFound},
+		{"no group", http.MethodGet, "/groups/", "", nil, http.StatusNotFound},
+		{"unknown group", http.MethodGet, "/groups/films", "", nil, http.StatusNotFound},
+		{"keys anonymously", http.MethodGet, "/groups/my%20books/keys", "", nil, http.StatusUnauthorized},
+		{"keys", http.MethodGet, "/groups/my%20books/keys", alice, nil, http.StatusOK},
+		{"posts with bad limit", http.MethodGet, "/groups/my%20books/posts?limit=0", "", nil, http.StatusBadRequest},
+		{"posts with bad since", http.MethodGet, "/groups/my%20books/posts?since=yesterday", "", nil, http.StatusBadRequest},
+		{"user", http.MethodGet, "/user?username=alice", "", nil, http.StatusOK},
+		{"unknown user", http.MethodGet, "/user?username=bob", "", nil, http.StatusNotFound},
+	})
+}
+
+func TestGroupPostsPages(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBroker(t)
+	h := b.Handler()
+
+	alice := register(t, h, "alice")
+	bob := register(t, h, "bob")
+
+	run(t, h, []step{
+		{"create group", "", "/creategroup", alice, url.Values{"groupname": {"books"}}, http.StatusOK},
+		{"join", "", "/joingroup", bob, url.Values{"groupname": {"books"}}, http.StatusOK},
+		{"first post", "", "/writepost", alice, url.Values{"groupname": {"books"}, "post": {"one"}}, http.StatusOK},
+		{"second post", "", "/writepost", bob, url.Values{"groupname": {"books"}, "post": {"two"}}, http.StatusOK},
+		{"third post", "", "/writepost", alice, url.Values{"groupname": {"books"}, "post": {"three"}}, http.StatusOK},
+	})
+
+	page := func(query string) types.PostPage {
+		t.Helper()
+
+		w := send(h, http.MethodGet, "/groups/books/posts"+query, "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("posts%s: got %d", query, w.Code)
+		}
+
+		var page types.PostPage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		return page
+	}
+
+	first := page("?limit=2")
+	if len(first.Posts) != 2 || first.Posts[0].Body != "one" || first.Posts[1].Body != "two" {
+		t.Fatalf("first page: got %+v", first.Posts)
+	}
+	if first.Posts[0].Id < types.FirstPostId || first.Posts[1].Id <= first.Posts[0].Id {
+		t.Errorf("post ids %d and %d are not increasing log positions", first.Posts[0].Id, first.Posts[1].Id)
+	}
+	if first.Next != first.Posts[1].Id {
+		t.Errorf("next of full page: got %d, want %d", first.Next, first.Posts[1].Id)
+	}
+
+	second := page("?limit=2&after=" + url.QueryEscape(strconv.FormatUint(first.Next, 10)))
+	if len(second.Posts) != 1 || second.Posts[0].Body != "three" || second.Next != 0 {
+		t.Errorf("last page: got %+v, next %d", second.Posts, second.Next)
+	}
+
+	byAlice := page("?author=alice")
+	if len(byAlice.Posts) != 2 {
+		t.Errorf("posts by alice: got %d, want 2", len(byAlice.Posts))
+	}
+}
+
+func TestAckPost(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBroker(t)
+	h := b.Handler()
+
+	alice := register(t, h, "alice")
+	bob := register(t, h, "bob")
+	carol := register(t, h, "carol")
+
+	run(t, h, []step{
+		{"create group", "", "/creategroup", alice, url.Values{"groupname": {"books"}}, http.StatusOK},
+		{"join", "", "/joingroup", bob, url.Values{"groupname": {"books"}}, http.StatusOK},
+	})
+	for _, body := range []string{"one", "two", "three", "four", "five"} {
+		run(t, h, []step{{"post " + body, "", "/writepost", alice, url.Values{"groupname": {"books"}, "post": {body}}, http.StatusOK}})
+	}
+
+	posts, err := b.db.ListPosts("books", store.PostQuery{Limit: 5})
+	if err != nil || len(posts) != 5 {
+		t.Fatalf("got %d posts, %v", len(posts), err)
+	}
+	offsets, err := b.db.GetOffsets("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := offsets["books"].Offset // bob joined before the posts were written
+
+	ack := func(ids ...uint64) url.Values {
+		form := url.Values{"groupname": {"books"}}
+		for _, id := range ids {
+			form.Add("id", strconv.FormatUint(id, 10))
+		}
+		return form
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		form      url.Values
+		want      int
+		wantAt    uint64   // offset of bob after the request
+		wantAcked []uint64 // posts after the offset bob acknowledged
+	}{
+		{"ack out of order", bob, ack(posts[1].Id), http.StatusOK, joined, []uint64{posts[1].Id}},
+		{"ack unknown post", bob, ack(posts[3].Id, posts[4].Id+1), http.StatusNotFound, joined, []uint64{posts[1].Id}},
+		{"ack as outsider", carol, ack(posts[0].Id), http.StatusForbidden, joined, []uint64{posts[1].Id}},
+		{"ack with bad id", bob, url.Values{"groupname": {"books"}, "id": {"first"}}, http.StatusBadRequest, joined, []uint64{posts[1].Id}},
+		{"ack nothing", bob, ack(), http.StatusBadRequest, joined, []uint64{posts[1].Id}},
+		{"ack gap", bob, ack(posts[0].Id), http.StatusOK, posts[1].Id, nil},
+		{"ack again", bob, ack(posts[0].Id), http.StatusOK, posts[1].Id, nil},
+		{"ack batch", bob, ack(posts[4].Id, posts[3].Id, posts[3].Id, posts[1].Id), http.StatusOK, posts[1].Id, []uint64{posts[3].Id, posts[4].Id}},
+		{"ack last gap", bob, ack(posts[2].Id), http.StatusOK, posts[4].Id, nil},
+	}
+
+	for _, tt := range tests {
+		w := send(h, http.MethodPost, "/ackpost", tt.token, tt.form)
+		if w.Code != tt.want {
+			t.Errorf("%s: got %d %q, want %d", tt.name, w.Code, strings.TrimSpace(w.Body.String()), tt.want)
+		}
+
+		offsets, err := b.db.GetOffsets("bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := offsets["books"]
+		if got.Offset != tt.wantAt {
+			t.Errorf("%s: offset %d, want %d", tt.name, got.Offset, tt.wantAt)
+		}
+		if !slices.Equal(got.Acked, tt.wantAcked) {
+			t.Errorf("%s: acked %v, want %v", tt.name, got.Acked, tt.wantAcked)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// file names of the CA in a certificate directory
+const (
+	caCertFile = "ca.pem"
+	caKeyFile  = "ca-key.pem"
+)
+
+// organization every certificate is issued to
+const organization = "sjsu-pub-sub"
+
+// CA signs the certificates of a test cluster's gateway, servers and clients
+type CA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// CAPath() returns the file the CA certificate kept in dir is saved to, which every binary is started with
+func CAPath(dir string) string {
+	return filepath.Join(dir, caCertFile)
+}
+
+// LoadOrCreateCA() reads the CA kept in dir, or creates one valid for validity and saves it there. The CA's key never
+// has to leave dir: copy only ca.pem to other hosts
+func LoadOrCreateCA(dir string, validity time.Duration) (*CA, bool, error) {
+	certPath := CAPath(dir)
+	keyPath := filepath.Join(dir, caKeyFile)
+
+	if _, err := os.Stat(certPath); err == nil {
+		ca, err := loadCA(certPath, keyPath)
+		return ca, false, err
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, false, fmt.Errorf("Error reading CA certificate: %v", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, false, fmt.Errorf("Error creating certificate directory: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error generating CA key: %v", err)
+	}
+
+	template, err := newTemplate(pkix.Name{Organization: []string{organization}, CommonName: organization + " CA"}, validity)
+	if err != nil {
+		return nil, false, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error creating CA certificate: %v", err)
+	}
+
+	if err := writeKeyPair(certPath, keyPath, der, key); err != nil {
+		return nil, false, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &CA{cert: cert, key: key}, true, nil
+}
+
+// Issue() creates a certificate and key for name acting as role, valid for validity and for the given hostnames and
+// IPs, and saves them in dir as <name>.pem and <name>-key.pem. Returns the paths of both
+func (ca *CA) Issue(dir string, role string, name string, hosts []string, validity time.Duration) (string, string, error) {
+	switch role {
+	case RoleGateway, RoleServer, RoleClient:
+	default:
+		return "", "", fmt.Errorf("unknown role %q, use %s, %s or %s", role, RoleGateway, RoleServer, RoleClient)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("Error generating key: %v", err)
+	}
+
+	subject := pkix.Name{Organization: []string{organization}, OrganizationalUnit: []string{role}, CommonName: name}
+	template, err := newTemplate(subject, validity)
+	if err != nil {
+		return "", "", err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} // every binary both listens and dials
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return "", "", fmt.Errorf("Error creating certificate: %v", err)
+	}
+
+	certPath := filepath.Join(dir, name+".pem")
+	keyPath := filepath.Join(dir, name+"-key.pem")
+
+	if err := writeKeyPair(certPath, keyPath, der, key); err != nil {
+		return "", "", err
+	}
+
+	return certPath, keyPath, nil
+}
+
+// loadCA() reads a CA's certificate and key
+func loadCA(certPath string, keyPath string) (*CA, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading CA certificate: %v", err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading CA key: %v", err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, fmt.Errorf("Error reading CA certificate: no certificate found in %s", certPath)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing CA certificate: %v", err)
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, fmt.Errorf("Error reading CA key: no key found in %s", keyPath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing CA key: %v", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("Error parsing CA key: key in %s cannot sign", keyPath)
+	}
+
+	return &CA{cert: cert, key: signer}, nil
+}
+
+// newTemplate() returns a certificate template with a random serial number, valid from now for validity
+func newTemplate(subject pkix.Name, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("Error generating serial number: %v", err)
+	}
+
+	now := time.Now()
+
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    now.Add(-time.Minute), // tolerate clocks slightly behind this host's
+		NotAfter:     now.Add(validity),
+	}, nil
+}
+
+// writeKeyPair() saves a certificate and its key as PEM files. The key is only readable by its owner
+func writeKeyPair(certPath string, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("Error encoding key: %v", err)
+	}
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("Error writing certificate: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("Error writing key: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,504 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sjsu-pub-sub/auth"
+	"sjsu-pub-sub/certs"
+	"sjsu-pub-sub/config"
+	"sjsu-pub-sub/e2e"
+	"sjsu-pub-sub/gossip"
+	"sjsu-pub-sub/membership"
+	"sjsu-pub-sub/pool"
+	"sjsu-pub-sub/types"
+	"sync"
+	"time"
+)
+
+const (
+	emptyStringError    = "Enter a non-empty value!"
+	postsPerPage        = 10
+	rosterRetryInterval = 5 * time.Second // time between attempts to reach the gateway or a server that went away
+	maxAcksPerRequest   = 500             // posts of a group acknowledged in one request, as many as servers accept
+)
+
+// Client is a logged in user: it sends the user's requests to the gateway, stays logged in to every server that is up
+// to receive new posts, and gossips posts on to groupmates
+type Client struct {
+	config       config.Client
+	gatewayURL   string             // base URL of the gateway every request goes to
+	username     string             // user logged in, empty until Run() logs in
+	address      string             // ":port" this client receives gossip on
+	lines        chan string        // lines typed by the user
+	done         <-chan struct{}    // closed when Run()'s context is cancelled, so prompts stop waiting for input
+	gossipPool   *pool.Pool         // long-lived connections to other clients, reused for every post gossiped to them
+	gossipEngine *gossip.Engine     // receives posts, and gossips them on to groupmates
+	members      *membership.List   // which other clients are alive, so gossip skips dead ones
+	tls          *certs.Bundle      // certificates every listener and dial uses, nil for plaintext
+	httpClient   *http.Client       // sends requests to the gateway
+	keys         *e2e.KeyPair       // user's key pair for end-to-end encrypted groups, nil if it could not be loaded
+	acksReady    chan struct{}      // signalled when a post is shown, so ackPosts() sends the acknowledgements
+	verifier     *auth.PostVerifier // checks posts were signed with the servers' key pinned in the config
+
+	groupKeys   map[string]map[uint64]*[e2e.KeySize]byte // group keys the user opened, by group and epoch
+	groupKeysMu sync.Mutex
+
+	token     string    // session token the servers issued the user, renewed by renewSession() before it expires
+	expires   time.Time // when token expires
+	sessionMu sync.Mutex
+
+	pendingAcks   map[string][]uint64 // ids of posts shown but not acknowledged yet, by group
+	pendingAcksMu sync.Mutex
+
+	serverConns   map[string]net.Conn // open login connections, by server address
+	wantedServers []string            // servers the gateway last listed as up
+	serverConnsMu sync.Mutex
+}
+
+// New() creates a client that reads the user's input from stdin. Nothing is sent until Run()
+func New(cfg config.Client) (*Client, error) {
+	bundle, err := certs.Load(cfg.TLSFiles())
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := auth.NewPostVerifier(cfg.PostKey) // never trust a key sent by whoever answers the login
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		config:      cfg,
+		gatewayURL:  cfg.GatewayURL(),
+		lines:       make(chan string),
+		acksReady:   make(chan struct{}, 1),
+		pendingAcks: make(map[string][]uint64),
+		serverConns: make(map[string]net.Conn),
+		groupKeys:   make(map[string]map[uint64]*[e2e.KeySize]byte),
+		tls:         bundle,
+		verifier:    verifier,
+		httpClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: bundle.ClientConfig(certs.RoleGateway)},
+		},
+	}
+
+	go c.readInput(os.Stdin)
+
+	return c, nil
+}
+
+// Run() logs the user in, starts receiving and gossiping posts, then serves the user's choices until ctx is cancelled,
+// when it closes the connections to servers and other clients
+func (c *Client) Run(ctx context.Context) error {
+	c.done = ctx.Done()
+
+	session, err := c.login() // upon client spinning up, log in
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to login: %v", err)
+	}
+	username := session.Username
+	c.username = username
+	c.setSession(session)
+	go c.renewSession(ctx)
+
+	if err := c.loadKeys(); err != nil { // groups posting in clear still work
+		fmt.Printf("End-to-end encrypted groups are unavailable: %v\n", err)
+	}
+
+	listener, address, err := createListener(c.tls.ServerConfig(certs.RoleServer, certs.RoleClient)) // TCP listener for server-client gossip
+	if err != nil {
+		return fmt.Errorf("Unable to create listener: %v", err)
+	}
+	defer listener.Close()
+	c.address = address
+
+	fmt.Printf("Client is listening on port %v\n", address)
+
+	c.gossipPool = pool.New(username, nil, pool.DefaultIdleTTL, c.tls.ClientConfig(certs.RoleClient))
+	go c.gossipPool.Run()
+	defer c.gossipPool.Close() // close gossip connections on ctrl + C
+
+	gossipConfig := gossip.DefaultConfig()
+	gossipConfig.Fanout = c.config.Fanout
+	gossipConfig.Rounds = c.config.Rounds
+	gossipConfig.TTL = c.config.TTL
+	gossipConfig.AntiEntropyInterval = time.Duration(c.config.AntiEntropy)
+	c.gossipEngine = gossip.New(gossipConfig, c.gossipPool, address, c.showPost)
+	c.members = membership.New(membership.DefaultConfig(), c.gossipPool, address)
+	c.gossipEngine.UseMembership(c.members)
+	c.gossipEngine.UseVerifier(c.verifier.Verify) // drop posts other clients altered or forged on the way
+	go c.ackPosts(ctx)
+	go c.gossipEngine.Run()
+	go c.members.Run() // probe groupmates learned through gossip
+
+	go c.listenForOtherClientConnections(listener) // accept client connections and receive gossip
+
+	c.dialAndAuthenticate(ctx) // dial to all TCP servers and send username, and receive posts missed while offline
+	defer c.syncServers(nil)   // log out of every server
+
+	for ctx.Err() == nil {
+		err := c.doClientFunctionalities()
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("Unable to perform client funcionalities: %v\n", err)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// prompt() asks the user for a line of input. Returns an empty line once Run()'s context is cancelled
+func (c *Client) prompt(text string) string {
+	fmt.Print(text)
+
+	select {
+	case line := <-c.lines:
+		return line
+	case <-c.done:
+		return ""
+	}
+}
+
+// readInput() hands lines typed by the user to prompt()
+func (c *Client) readInput(input io.Reader) {
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		c.lines <- scanner.Text()
+	}
+}
+
+// userLogin() requests user to login
+func (c *Client) userLogin() (string, string, error) {
+	errPrefix := "Error getting user login info:"
+
+	username := c.prompt("Enter a username here: ")
+	password := c.prompt("Enter a password here: ")
+
+	if username == "" || password == "" {
+		return "", "", fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	return username, password, nil
+}
+
+// login() logs in a user, registering them first if the username is new. Users registered before passwords existed
+// are registered again to set their password
+func (c *Client) login() (types.UserSession, error) {
+	username, password, err := c.userLogin() // users enter username and password
+	if err != nil {
+		return types.UserSession{}, fmt.Errorf("Error getting new user login info: %v", err)
+	}
+
+	form := url.Values{}
+	form.Set("username", username)
+	form.Set("password", password)
+
+	session, status, err := c.requestSession("/login", form)
+	if err != nil {
+		return session, err
+	}
+
+	switch status {
+	case http.StatusOK:
+		fmt.Printf("Successfully logged in existing user %s! \n\n", username)
+		return session, nil
+	case http.StatusUnauthorized:
+		return session, fmt.Errorf("Wrong username or password")
+	case http.StatusNotFound: // new user
+	case http.StatusForbidden: // user registered before passwords existed
+		return c.claim(username, form)
+	default:
+		return session, fmt.Errorf("Failed to log in with %d code", status)
+	}
+
+	session, status, err = c.requestSession("/register", form)
+	if err != nil {
+		return session, err
+	}
+
+	switch status {
+	case http.StatusOK:
+		fmt.Printf("Successfully registered new user %s! \n\n", username)
+		return session, nil
+	case http.StatusBadRequest:
+		return session, fmt.Errorf("Password must be at least %d characters", auth.MinPasswordLength)
+	case http.StatusConflict: // someone else registered the username in the meantime
+		return session, fmt.Errorf("Username %s already exists", username)
+	default:
+		return session, fmt.Errorf("Failed to register with %d code", status)
+	}
+}
+
+// claim() sets the password of a user registered before passwords existed, with the claim token an admin issued them
+func (c *Client) claim(username string, form url.Values) (types.UserSession, error) {
+	token := c.prompt("User has no password yet. Enter the claim token an admin issued for it: ")
+	if token == "" {
+		return types.UserSession{}, fmt.Errorf("Claim token is required to set a password")
+	}
+	form.Set("token", token)
+
+	session, status, err := c.requestSession("/claim", form)
+	if err != nil {
+		return session, err
+	}
+
+	switch status {
+	case http.StatusOK:
+		fmt.Printf("Successfully claimed user %s! \n\n", username)
+		return session, nil
+	case http.StatusBadRequest:
+		return session, fmt.Errorf("Password must be at least %d characters", auth.MinPasswordLength)
+	case http.StatusForbidden:
+		return session, fmt.Errorf("Claim token is invalid, expired or for another user")
+	case http.StatusConflict: // claimed in the meantime
+		return session, fmt.Errorf("User %s already has a password", username)
+	default:
+		return session, fmt.Errorf("Failed to claim user with %d code", status)
+	}
+}
+
+// setSession() switches to a session the servers issued the user
+func (c *Client) setSession(session types.UserSession) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	c.token = session.Token
+	c.expires = session.Expires
+}
+
+// sessionToken() returns the token of the user's current session
+func (c *Client) sessionToken() string {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	return c.token
+}
+
+// renewSession() swaps the user's session for a new one whenever half of it has run out, until ctx is cancelled, so
+// requests and logins to servers coming back keep working however long the client stays up
+func (c *Client) renewSession(ctx context.Context) {
+	for {
+		c.sessionMu.Lock()
+		expires := c.expires
+		c.sessionMu.Unlock()
+
+		select {
+		case <-time.After(max(time.Until(expires)/2, rosterRetryInterval)):
+		case <-ctx.Done():
+			return
+		}
+
+		session, status, err := c.refreshSession()
+		if err != nil {
+			fmt.Println("Unable to renew session:", err) // retried until the session expires
+			continue
+		}
+
+		switch status {
+		case http.StatusOK:
+			c.setSession(session)
+		case http.StatusUnauthorized:
+			fmt.Println("Session expired, restart the client to log in again")
+			return
+		default:
+			fmt.Printf("Unable to renew session: HTTP request error: %v\n", status)
+		}
+	}
+}
+
+// refreshSession() asks the gateway for a new session in place of the current one. Returns the session if the gateway
+// answers 200, and the status code either way
+func (c *Client) refreshSession() (types.UserSession, int, error) {
+	var session types.UserSession
+
+	resp, err := c.post(c.gatewayURL+"/refresh", nil) // HTTP request to gateway
+	if err != nil {
+		return session, 0, fmt.Errorf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return session, resp.StatusCode, nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return session, resp.StatusCode, fmt.Errorf("Error decoding session: %v", err)
+	}
+
+	return session, resp.StatusCode, nil
+}
+
+// requestSession() sends a username and password to the gateway's login, register or claim endpoint. Returns the
+// session if the gateway answers 200, and the status code either way
+func (c *Client) requestSession(endpoint string, form url.Values) (types.UserSession, int, error) {
+	var session types.UserSession
+
+	resp, err := c.httpClient.PostForm(c.gatewayURL+endpoint, form) // HTTP request to gateway
+	if err != nil {
+		return session, 0, fmt.Errorf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return session, resp.StatusCode, nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return session, resp.StatusCode, fmt.Errorf("Error decoding session: %v", err)
+	}
+
+	return session, resp.StatusCode, nil
+}
+
+// showPost() prints a post the first time it is received, decrypted if it was written to an end-to-end encrypted group,
+// and acknowledges it so it is not sent again on reconnect
+func (c *Client) showPost(msg types.GossipMessage) {
+	body := c.readBody(msg.Group, msg.KeyEpoch, msg.Body)
+	if msg.Author != "" {
+		body = msg.Author + ": " + body
+	}
+	fmt.Printf("Post received through gossip: [%s] %s\n", msg.Timestamp.Local().Format(time.DateTime), body)
+
+	if msg.Group == "" {
+		return
+	}
+
+	c.pendingAcksMu.Lock()
+	c.pendingAcks[msg.Group] = append(c.pendingAcks[msg.Group], msg.Id) // acknowledge post only once it has been shown
+	c.pendingAcksMu.Unlock()
+
+	select {
+	case c.acksReady <- struct{}{}:
+	default: // ackPosts() is already due to send it
+	}
+}
+
+// ackPosts() acknowledges shown posts until ctx is cancelled. Posts shown while a request is in flight pile up and are
+// then acknowledged together, with one request per group
+func (c *Client) ackPosts(ctx context.Context) {
+	for {
+		select {
+		case <-c.acksReady:
+		case <-ctx.Done():
+			return
+		}
+
+		c.pendingAcksMu.Lock()
+		pending := c.pendingAcks
+		c.pendingAcks = make(map[string][]uint64)
+		c.pendingAcksMu.Unlock()
+
+		for group, ids := range pending {
+			for len(ids) > 0 {
+				batch := ids[:min(len(ids), maxAcksPerRequest)]
+				ids = ids[len(batch):]
+				c.ackGroupPosts(group, batch)
+			}
+		}
+	}
+}
+
+// getGossipStats() prints how posts have been reaching this client
+func (c *Client) getGossipStats() error {
+	stats := c.gossipEngine.Stats()
+
+	fmt.Printf("Posts received: %d (%d duplicates)\n", stats.Received, stats.Duplicates)
+	fmt.Printf("Distinct posts delivered: %d (%d recovered by anti-entropy)\n", stats.Delivered, stats.Recovered)
+	fmt.Printf("Posts forwarded: %d (%d not forwarded as their TTL ran out)\n", stats.Forwarded, stats.Expired)
+	fmt.Printf("Digest exchanges started: %d\n", stats.DigestsSent)
+	fmt.Printf("Posts dropped as altered or forged: %d\n", stats.Rejected)
+	fmt.Printf("Coverage by push gossip: %.1f%%\n", 100*stats.Coverage())
+
+	fmt.Println("Known clients:")
+	for _, member := range c.members.Members() {
+		fmt.Printf("  %s %s (incarnation %d)\n", member.Address, member.State, member.Incarnation)
+	}
+
+	return nil
+}
+
+// handleClientConnection() receives gossip and digests from the server and other clients, and hands them to the gossip
+// engine. Membership probes from other clients go to the membership list
+func (c *Client) handleClientConnection(conn net.Conn) {
+	defer conn.Close()
+
+	session, err := types.AcceptSession(conn, c.username, []string{types.CapPing}, types.MaxFrameSize)
+	if err != nil {
+		fmt.Println("Error accepting gossip connection:", err)
+		return
+	}
+
+	for {
+		env, err := session.Receive()
+		if err == io.EOF { // sender is done
+			return
+		}
+		if err != nil {
+			fmt.Println("Error reading gossip:", err)
+			return
+		}
+
+		if env.Type == types.MsgPing { // sender checking the connection is still alive
+			if err := session.Reply(env, types.MsgPong, struct{}{}); err != nil {
+				return
+			}
+			continue
+		}
+		switch env.Type {
+		case types.MsgSwimPing, types.MsgSwimPingReq, types.MsgSwimAck:
+			if err := c.members.Handle(env, conn.RemoteAddr()); err != nil {
+				fmt.Println("Error handling membership probe:", err)
+			}
+		default:
+			if err := c.gossipEngine.Handle(env, conn.RemoteAddr()); err != nil { // ignores messages this client does not know
+				fmt.Println("Error handling gossip:", err)
+			}
+		}
+	}
+}
+
+// listenForOtherClientConnections() accepts clients connecting to it for gossip, until the listener is closed
+func (c *Client) listenForOtherClientConnections(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) { // shutting down
+			return
+		}
+		if err != nil {
+			fmt.Println("Error accepting connection:", err)
+			continue
+		}
+
+		go c.handleClientConnection(conn)
+	}
+}
+
+// createListener() creates TCP listener for server to connect for gossip, over TLS if tlsConfig is set
+func createListener(tlsConfig *tls.Config) (n net.Listener, s string, err error) {
+	minPort := 5000
+	maxPort := 10000
+
+	// Generate a random port number within the specified range
+	rand.Seed(time.Now().UnixNano())
+	port := rand.Intn(maxPort-minPort+1) + minPort
+	address := fmt.Sprintf(":%d", port)
+
+	listener, err := certs.Listen(address, tlsConfig)
+	if err != nil {
+		fmt.Println("Client unable to start listener:", err)
+		return nil, "", err
+	}
+
+	return listener, address, nil
+}
@@ -0,0 +1,271 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sjsu-pub-sub/e2e"
+	"sjsu-pub-sub/types"
+	"slices"
+	"strconv"
+)
+
+// errStaleKey is returned when another groupmate replaced a group's key while the user was encrypting a post with it
+var errStaleKey = errors.New("group key was replaced by another groupmate")
+
+// loadKeys() reads the user's key pair for end-to-end encrypted groups, creating it on the user's first login from this
+// machine, and publishes its public key so groupmates can share group keys with the user
+func (c *Client) loadKeys() error {
+	path := filepath.Join(c.config.KeyDir, c.username+".key")
+
+	keys, created, err := e2e.LoadOrCreateKeyPair(path)
+	if err != nil {
+		return err
+	}
+	if created {
+		fmt.Printf("Created key pair for encrypted groups in %s. Keep it to read their posts from this machine\n", path)
+	}
+	c.keys = keys
+
+	data := url.Values{}
+	data.Set("publickey", keys.PublicKey())
+
+	resp, err := c.post(c.gatewayURL+"/publishkey", []byte(data.Encode())) // HTTP request to gateway
+	if err != nil {
+		return fmt.Errorf("Error publishing public key: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error publishing public key: HTTP request error: %v", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// groupKeyring() gets the keys of a group sealed to the user, and the public keys of their groupmates
+func (c *Client) groupKeyring(group string) (types.GroupKeyring, error) {
+	var keyring types.GroupKeyring
+
+	resp, err := c.get(c.gatewayURL + "/groups/" + url.PathEscape(group) + "/keys") // HTTP request to gateway
+	if err != nil {
+		return keyring, fmt.Errorf("Error sending HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return keyring, fmt.Errorf("Group %s does not exist", group)
+	} else if resp.StatusCode == http.StatusForbidden {
+		return keyring, fmt.Errorf("Join group %s first", group)
+	} else if resp.StatusCode != http.StatusOK {
+		return keyring, fmt.Errorf("HTTP request error: %v", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return keyring, fmt.Errorf("Error reading HTTP response: %v", err)
+	}
+
+	if err := json.Unmarshal(body, &keyring); err != nil {
+		return keyring, fmt.Errorf("Error unmarshalling keys JSON: %v", err)
+	}
+
+	c.cacheGroupKeys(group, keyring)
+
+	return keyring, nil
+}
+
+// cacheGroupKeys() opens the keys of a group sealed to the user and keeps them, so posts are decrypted without asking
+// the servers again. Keys sealed to an older key pair of the user cannot be opened and are skipped
+func (c *Client) cacheGroupKeys(group string, keyring types.GroupKeyring) {
+	c.groupKeysMu.Lock()
+	defer c.groupKeysMu.Unlock()
+
+	if c.keys == nil {
+		return
+	}
+
+	if c.groupKeys[group] == nil {
+		c.groupKeys[group] = make(map[uint64]*[e2e.KeySize]byte)
+	}
+
+	for epoch, sealed := range keyring.Keys {
+		if _, ok := c.groupKeys[group][epoch]; ok {
+			continue
+		}
+		if key, err := c.keys.OpenGroupKey(sealed); err == nil {
+			c.groupKeys[group][epoch] = key
+		}
+	}
+}
+
+// cachedGroupKey() returns the key of a group for an epoch if the user opened it before
+func (c *Client) cachedGroupKey(group string, epoch uint64) (*[e2e.KeySize]byte, bool) {
+	c.groupKeysMu.Lock()
+	defer c.groupKeysMu.Unlock()
+
+	key, ok := c.groupKeys[group][epoch]
+	return key, ok
+}
+
+// readBody() returns the text of a post, decrypting it if it was written to an end-to-end encrypted group. Keys not
+// opened yet are fetched from the servers
+func (c *Client) readBody(group string, epoch uint64, body string) string {
+	if epoch == 0 {
+		return body
+	}
+
+	key, ok := c.cachedGroupKey(group, epoch)
+	if !ok {
+		if _, err := c.groupKeyring(group); err != nil {
+			return fmt.Sprintf("[encrypted post: %v]", err)
+		}
+		if key, ok = c.cachedGroupKey(group, epoch); !ok {
+			return fmt.Sprintf("[encrypted post: key %d of group %s was not shared with you]", epoch, group)
+		}
+	}
+
+	text, err := e2e.Decrypt(key, body)
+	if err != nil {
+		return fmt.Sprintf("[encrypted post: %v]", err)
+	}
+
+	return text
+}
+
+// encryptPost() encrypts a post for a group if it is end-to-end encrypted, and returns the epoch of the key used, or 0
+// if the group posts in clear. Before encrypting it makes sure every groupmate who published a public key holds the
+// key: groupmates who joined since are sent a sealed copy, and a new key is shared if the user cannot open the current
+// one, as when no key was shared yet or the servers started a new epoch after someone left. Returns errStaleKey if
+// another groupmate replaced the key meanwhile
+func (c *Client) encryptPost(group string, post string) (string, uint64, error) {
+	keyring, err := c.groupKeyring(group)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if !keyring.Enabled {
+		return post, 0, nil
+	}
+
+	if c.keys == nil {
+		return "", 0, fmt.Errorf("Group %s is end-to-end encrypted, but you have no key pair", group)
+	}
+
+	epoch := keyring.Epoch
+	key, ok := c.cachedGroupKey(group, epoch)
+
+	replace := !ok // no key yet, a new epoch no one holds, or the current key was sealed to an older key pair of the user
+	if replace {
+		if key, err = e2e.NewGroupKey(); err != nil {
+			return "", 0, err
+		}
+		if epoch == 0 || len(keyring.Holders) > 0 { // otherwise fill the epoch the servers started
+			epoch++
+		}
+	}
+
+	sealed := make(map[string]string)
+	unreadable := []string{}
+	for mate, publicKey := range keyring.PublicKeys {
+		if publicKey == "" {
+			unreadable = append(unreadable, mate)
+			continue
+		}
+		if !replace && slices.Contains(keyring.Holders, mate) {
+			continue
+		}
+		if sealed[mate], err = e2e.SealGroupKey(key, publicKey); err != nil {
+			return "", 0, err
+		}
+	}
+
+	if len(unreadable) > 0 {
+		slices.Sort(unreadable)
+		fmt.Printf("Groupmates %v have not logged in since encryption was added, and cannot read this post\n", unreadable)
+	}
+
+	if len(sealed) > 0 {
+		if err := c.shareGroupKey(group, epoch, sealed, replace); err != nil {
+			return "", 0, err
+		}
+
+		c.groupKeysMu.Lock()
+		c.groupKeys[group][epoch] = key
+		c.groupKeysMu.Unlock()
+	}
+
+	ciphertext, err := e2e.Encrypt(key, post)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return ciphertext, epoch, nil
+}
+
+// shareGroupKey() sends a group key sealed to groupmates to the servers, to store for the groupmates to fetch. newKey
+// is set if the key replaces the group's current one
+func (c *Client) shareGroupKey(group string, epoch uint64, sealed map[string]string, newKey bool) error {
+	sealedJSON, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+
+	data := url.Values{}
+	data.Set("groupname", group)
+	data.Set("keyepoch", strconv.FormatUint(epoch, 10))
+	data.Set("sealed", string(sealedJSON))
+	data.Set("newkey", strconv.FormatBool(newKey))
+
+	resp, err := c.post(c.gatewayURL+"/sharegroupkey", []byte(data.Encode())) // HTTP request to gateway
+	if err != nil {
+		return fmt.Errorf("Error sending HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return errStaleKey
+	} else if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("You are not allowed to post in group %s", group)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Failed to share group key with %d code", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// encryptGroup() makes the posts of a group the user owns end-to-end encrypted from now on
+func (c *Client) encryptGroup() error {
+	errPrefix := "Error encrypting group:"
+
+	groupName := c.prompt("Enter a group name: ")
+
+	if groupName == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	payload := []byte(url.Values{"groupname": {groupName}}.Encode())
+
+	url := c.gatewayURL + "/encryptgroup" // HTTP request to gateway
+
+	resp, err := c.post(url, payload)
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%s Only the owner of group %s can encrypt it", errPrefix, groupName)
+	} else if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s Group %s does not exist", errPrefix, groupName)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s Failed to encrypt group with %d code", errPrefix, resp.StatusCode)
+	}
+
+	fmt.Printf("Successfully encrypted group %s! New posts can only be read by its members\n", groupName)
+	return nil
+}
@@ -0,0 +1,691 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sjsu-pub-sub/types"
+	"strconv"
+	"time"
+)
+
+// getGroups() gets and prints all groups
+func (c *Client) getGroups() error {
+	errPrefix := "Error getting groups:"
+
+	baseUrl := c.gatewayURL + "/groups" // HTTP request to gateway
+
+	resp, err := c.get(baseUrl) // private groups are only listed to their groupmates and invited users
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s HTTP request error: %v", errPrefix, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s Error reading HTTP response: %v", errPrefix, err)
+	}
+
+	var groups []types.GroupSummary
+	if err := json.Unmarshal(body, &groups); err != nil {
+		return fmt.Errorf("%s Error unmarshalling groups JSON: %v", errPrefix, err)
+	}
+
+	fmt.Println("Groups:") // print all received groups
+	for _, group := range groups {
+		fmt.Printf("Group Name: %s\n", group.GroupName)
+		fmt.Printf("Creator: %s\n", group.Creator)
+		if group.Owner != "" && group.Owner != group.Creator {
+			fmt.Printf("Owner: %s\n", group.Owner)
+		}
+		fmt.Printf("Members: %d\n", group.MemberCount)
+		fmt.Printf("Visibility: %s\n", group.Visibility)
+		if group.Encrypted {
+			fmt.Println("Posts are end-to-end encrypted")
+		}
+		fmt.Println("--------------------------------------------------")
+	}
+
+	fmt.Println("Successfully retrieved all groups!")
+	return nil
+}
+
+// getPosts() pages through the posts of a group, optionally only those by one author
+func (c *Client) getPosts() error {
+	errPrefix := "Error getting posts:"
+
+	groupName := c.prompt("Enter a group name: ")
+
+	author := c.prompt("Only show posts by (leave empty for everyone): ")
+
+	if groupName == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	var after uint64
+	for {
+		params := url.Values{}
+		params.Set("limit", strconv.Itoa(postsPerPage))
+		if after > 0 {
+			params.Set("after", strconv.FormatUint(after, 10))
+		}
+		if author != "" {
+			params.Set("author", author)
+		}
+
+		baseUrl := c.gatewayURL + "/groups/" + url.PathEscape(groupName) + "/posts?" + params.Encode() // HTTP request to gateway
+
+		resp, err := c.get(baseUrl)
+		if err != nil {
+			return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("%s Error reading HTTP response: %v", errPrefix, err)
+		}
+
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%s Group %s does not exist", errPrefix, groupName)
+		} else if resp.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("%s Join group %s to read its posts", errPrefix, groupName)
+		} else if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s HTTP request error: %v", errPrefix, resp.StatusCode)
+		}
+
+		var page types.PostPage
+		if err := json.Unmarshal(body, &page); err != nil {
+			return fmt.Errorf("%s Error unmarshalling posts JSON: %v", errPrefix, err)
+		}
+
+		if after == 0 && len(page.Posts) == 0 {
+			fmt.Println("No posts yet")
+			return nil
+		}
+
+		for _, post := range page.Posts {
+			body := c.readBody(groupName, post.KeyEpoch, post.Body)
+			fmt.Printf("- [%d %s] Author: %s, Body: %s\n", post.Id, post.Timestamp.Local().Format(time.DateTime), post.Author, body)
+		}
+
+		if page.Next == 0 { // no more posts
+			return nil
+		}
+
+		if c.prompt("Show more? (y/n): ") != "y" {
+			return nil
+		}
+		after = page.Next
+	}
+}
+
+// joinGroup() subscribes a user to a group, allowing them to receive all new posts
+func (c *Client) joinGroup() error {
+	errPrefix := "Error joining group:"
+
+	groupName := c.prompt("Enter a group name: ")
+
+	if groupName == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	payload := []byte(url.Values{"groupname": {groupName}}.Encode())
+
+	url := c.gatewayURL + "/joingroup" // HTTP request to gateway
+
+	resp, err := c.post(url, payload)
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%s Group %s is private, ask to join it (12) or get invited", errPrefix, groupName)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s Failed to register with %d code", errPrefix, resp.StatusCode)
+	}
+
+	fmt.Printf("Successfully joined new group %s! \n", groupName)
+	return nil
+}
+
+// writeMyPost() writes a post to a group, encrypted if the group is end-to-end encrypted
+func (c *Client) writeMyPost() error {
+	errPrefix := "Error joining group:"
+
+	groupName := c.prompt("Enter a group name: ")
+
+	post := c.prompt("Write a post: ")
+
+	if groupName == "" || post == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	for attempt := 0; ; attempt++ {
+		body, epoch, err := c.encryptPost(groupName, post)
+		if err == errStaleKey && attempt == 0 { // another groupmate replaced the key first, encrypt with theirs
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s %v", errPrefix, err)
+		}
+
+		data := url.Values{}
+		data.Set("groupname", groupName)
+		data.Set("post", body)
+		if epoch > 0 {
+			data.Set("keyepoch", strconv.FormatUint(epoch, 10))
+		}
+
+		url := c.gatewayURL + "/writepost" // HTTP request to gateway
+
+		resp, err := c.post(url, []byte(data.Encode()))
+		if err != nil {
+			return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusConflict && attempt == 0 { // key replaced, or group encrypted, since it was read
+			continue
+		} else if resp.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("%s You are not allowed to post in group %s", errPrefix, groupName)
+		} else if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s Failed to register with %d code", errPrefix, resp.StatusCode)
+		}
+
+		if epoch > 0 {
+			fmt.Printf("Successfully wrote end-to-end encrypted post \"%s\" to group %s\n", post, groupName)
+		} else {
+			fmt.Printf("Successfully wrote post \"%s\" to group %s\n", post, groupName)
+		}
+		return nil
+	}
+}
+
+// leaveGroup() unsubscribes a user from a group, so they stop receiving its posts
+func (c *Client) leaveGroup() error {
+	errPrefix := "Error leaving group:"
+
+	groupName := c.prompt("Enter a group name: ")
+
+	if groupName == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	payload := []byte(url.Values{"groupname": {groupName}}.Encode())
+
+	url := c.gatewayURL + "/leavegroup" // HTTP request to gateway
+
+	resp, err := c.post(url, payload)
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%s Transfer ownership of group %s or delete it before leaving", errPrefix, groupName)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s Failed to leave group with %d code", errPrefix, resp.StatusCode)
+	}
+
+	fmt.Printf("Successfully left group %s! \n", groupName)
+	return nil
+}
+
+// getMyGroups() gets and prints the groups a user is in
+func (c *Client) getMyGroups() error {
+	errPrefix := "Error getting my groups:"
+
+	baseUrl := c.gatewayURL + "/user?username=" + url.QueryEscape(c.username) // HTTP request to gateway
+
+	resp, err := c.get(baseUrl)
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s HTTP request error: %v", errPrefix, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s Error reading HTTP response: %v", errPrefix, err)
+	}
+
+	var user types.User
+	if err := json.Unmarshal(body, &user); err != nil {
+		return fmt.Errorf("%s Error unmarshalling user JSON: %v", errPrefix, err)
+	}
+
+	if len(user.Groups) == 0 {
+		fmt.Println("You have not joined any groups yet")
+		return nil
+	}
+
+	fmt.Println("My groups:")
+	for _, group := range user.Groups {
+		fmt.Printf("- %s\n", group)
+	}
+
+	return nil
+}
+
+// createGroup() creates a new group owned by the user, who becomes its first member
+func (c *Client) createGroup() error {
+	errPrefix := "Error creating group:"
+
+	groupName := c.prompt("Enter a new group name: ")
+
+	visibility := types.VisibilityPublic
+	if c.prompt("Private group? (y/n): ") == "y" {
+		visibility = types.VisibilityPrivate
+	}
+
+	encrypted := c.prompt("End-to-end encrypt its posts? (y/n): ") == "y"
+
+	if groupName == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	payload := []byte(url.Values{"groupname": {groupName}, "visibility": {visibility}, "encrypted": {strconv.FormatBool(encrypted)}}.Encode())
+
+	url := c.gatewayURL + "/creategroup" // HTTP request to gateway
+
+	resp, err := c.post(url, payload)
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%s Group %s already exists", errPrefix, groupName)
+	} else if resp.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%s Group names may only hold letters, digits, spaces, '-', '_' and '.', and not start with a space or '.'", errPrefix)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s Failed to create group with %d code", errPrefix, resp.StatusCode)
+	}
+
+	fmt.Printf("Successfully created new %s group %s! \n", visibility, groupName)
+	if encrypted {
+		fmt.Println("Its posts are end-to-end encrypted, only its members can read them")
+	}
+	return nil
+}
+
+// deleteGroup() deletes a group the user owns
+func (c *Client) deleteGroup() error {
+	errPrefix := "Error deleting group:"
+
+	groupName := c.prompt("Enter a group name: ")
+
+	if groupName == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	payload := []byte(url.Values{"groupname": {groupName}}.Encode())
+
+	url := c.gatewayURL + "/deletegroup" // HTTP request to gateway
+
+	resp, err := c.post(url, payload)
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%s Only the owner of group %s can delete it", errPrefix, groupName)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s Failed to delete group with %d code", errPrefix, resp.StatusCode)
+	}
+
+	fmt.Printf("Successfully deleted group %s! \n", groupName)
+	return nil
+}
+
+// transferOwnership() hands a group the user owns over to another member of the group
+func (c *Client) transferOwnership() error {
+	errPrefix := "Error transferring group ownership:"
+
+	groupName := c.prompt("Enter a group name: ")
+
+	newOwner := c.prompt("Enter the new owner's username: ")
+
+	if groupName == "" || newOwner == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	payload := []byte(url.Values{"groupname": {groupName}, "newowner": {newOwner}}.Encode())
+
+	url := c.gatewayURL + "/transferownership" // HTTP request to gateway
+
+	resp, err := c.post(url, payload)
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%s Only the owner of group %s can transfer it", errPrefix, groupName)
+	} else if resp.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%s %s is not a member of group %s", errPrefix, newOwner, groupName)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s Failed to transfer ownership with %d code", errPrefix, resp.StatusCode)
+	}
+
+	fmt.Printf("Successfully transferred group %s to %s! \n", groupName, newOwner)
+	return nil
+}
+
+// inviteUser() invites a user to a group the user owns or moderates, so they may join it even if it is private
+func (c *Client) inviteUser() error {
+	errPrefix := "Error inviting user:"
+
+	groupName := c.prompt("Enter a group name: ")
+
+	member := c.prompt("Enter the username to invite: ")
+
+	if groupName == "" || member == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	payload := []byte(url.Values{"groupname": {groupName}, "member": {member}}.Encode())
+
+	url := c.gatewayURL + "/invite" // HTTP request to gateway
+
+	resp, err := c.post(url, payload)
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%s Only the owner and moderators of group %s can invite users", errPrefix, groupName)
+	} else if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s Group %s or user %s does not exist", errPrefix, groupName, member)
+	} else if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%s %s is already a member of group %s", errPrefix, member, groupName)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s Failed to invite user with %d code", errPrefix, resp.StatusCode)
+	}
+
+	fmt.Printf("Successfully invited %s to group %s! \n", member, groupName)
+	return nil
+}
+
+// requestJoin() asks the owner and moderators of a private group to let the user in
+func (c *Client) requestJoin() error {
+	errPrefix := "Error asking to join group:"
+
+	groupName := c.prompt("Enter a group name: ")
+
+	if groupName == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	payload := []byte(url.Values{"groupname": {groupName}}.Encode())
+
+	url := c.gatewayURL + "/requestjoin" // HTTP request to gateway
+
+	resp, err := c.post(url, payload)
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%s Group %s is public, join it directly (2)", errPrefix, groupName)
+	} else if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s Group %s does not exist", errPrefix, groupName)
+	} else if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%s You are already a member of group %s", errPrefix, groupName)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s Failed to ask to join group with %d code", errPrefix, resp.StatusCode)
+	}
+
+	fmt.Printf("Asked to join group %s! You join it once the owner or a moderator approves\n", groupName)
+	return nil
+}
+
+// reviewRequests() shows who asked to join a group the user owns or moderates, and approves or declines each of them
+func (c *Client) reviewRequests() error {
+	errPrefix := "Error reviewing join requests:"
+
+	groupName := c.prompt("Enter a group name: ")
+
+	if groupName == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	resp, err := c.get(c.gatewayURL + "/groups/" + url.PathEscape(groupName)) // HTTP request to gateway
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s Group %s does not exist", errPrefix, groupName)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s HTTP request error: %v", errPrefix, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s Error reading HTTP response: %v", errPrefix, err)
+	}
+
+	var group types.GroupInfo
+	if err := json.Unmarshal(body, &group); err != nil {
+		return fmt.Errorf("%s Error unmarshalling group JSON: %v", errPrefix, err)
+	}
+
+	if len(group.Requested) == 0 {
+		fmt.Println("No pending requests to join, or you are not allowed to see them")
+		return nil
+	}
+
+	for _, member := range group.Requested {
+		var endpoint string
+		switch c.prompt(fmt.Sprintf("Let %s into group %s? (y/n, leave empty to skip): ", member, groupName)) {
+		case "y":
+			endpoint = "/approverequest"
+		case "n":
+			endpoint = "/declinerequest"
+		default:
+			continue
+		}
+
+		payload := []byte(url.Values{"groupname": {groupName}, "member": {member}}.Encode())
+
+		resp, err := c.post(c.gatewayURL+endpoint, payload) // HTTP request to gateway
+		if err != nil {
+			return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("%s Only the owner and moderators of group %s can review requests", errPrefix, groupName)
+		} else if resp.StatusCode != http.StatusOK {
+			fmt.Printf("%s Failed to review request from %s with %d code\n", errPrefix, member, resp.StatusCode)
+			continue
+		}
+
+		fmt.Printf("Successfully reviewed request from %s!\n", member)
+	}
+
+	return nil
+}
+
+// setRole() makes a member of a group the user owns a moderator, member or read-only
+func (c *Client) setRole() error {
+	errPrefix := "Error changing role:"
+
+	groupName := c.prompt("Enter a group name: ")
+
+	member := c.prompt("Enter the member's username: ")
+
+	role := c.prompt("Enter the new role (moderator, member or readonly): ")
+
+	if groupName == "" || member == "" || role == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	payload := []byte(url.Values{"groupname": {groupName}, "member": {member}, "role": {role}}.Encode())
+
+	url := c.gatewayURL + "/setrole" // HTTP request to gateway
+
+	resp, err := c.post(url, payload)
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%s Only the owner of group %s can change roles, and not their own", errPrefix, groupName)
+	} else if resp.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%s %s is not a member of group %s, or %s is not a role", errPrefix, member, groupName, role)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s Failed to change role with %d code", errPrefix, resp.StatusCode)
+	}
+
+	fmt.Printf("Successfully made %s %s of group %s! \n", member, role, groupName)
+	return nil
+}
+
+// setVisibility() makes a group the user owns public or private
+func (c *Client) setVisibility() error {
+	errPrefix := "Error changing group visibility:"
+
+	groupName := c.prompt("Enter a group name: ")
+
+	visibility := c.prompt("Enter the new visibility (public or private): ")
+
+	if groupName == "" || visibility == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	payload := []byte(url.Values{"groupname": {groupName}, "visibility": {visibility}}.Encode())
+
+	url := c.gatewayURL + "/setvisibility" // HTTP request to gateway
+
+	resp, err := c.post(url, payload)
+	if err != nil {
+		return fmt.Errorf("%s Error sending HTTP request: %v", errPrefix, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%s Only the owner of group %s can change its visibility", errPrefix, groupName)
+	} else if resp.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%s Visibility must be public or private", errPrefix)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s Failed to change visibility with %d code", errPrefix, resp.StatusCode)
+	}
+
+	fmt.Printf("Successfully made group %s %s! \n", groupName, visibility)
+	return nil
+}
+
+// doClientFunctionalities() is the handler for all user functionalities
+func (c *Client) doClientFunctionalities() error {
+	errPrefix := "Error handling client functionality choice:"
+	optionString := c.prompt("Choose a number from the following choices: \nSee all groups (1) \nJoin a group (2) \nWrite a post (3) \nCreate a group (4) \nDelete a group (5) \nTransfer group ownership (6) \nLeave a group (7) \nSee my groups (8) \nSee posts in a group (9) \nSee gossip stats (10) \nInvite a user to a group (11) \nAsk to join a private group (12) \nReview requests to join a group (13) \nChange a member's role (14) \nChange a group's visibility (15) \nEnd-to-end encrypt a group's posts (16)\n")
+
+	if optionString == "" {
+		return fmt.Errorf("%s %s", errPrefix, emptyStringError)
+	}
+
+	option, err := strconv.Atoi(optionString)
+	if err != nil {
+		return fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	if option == 1 {
+		return c.getGroups()
+	} else if option == 2 {
+		return c.joinGroup()
+	} else if option == 3 {
+		return c.writeMyPost()
+	} else if option == 4 {
+		return c.createGroup()
+	} else if option == 5 {
+		return c.deleteGroup()
+	} else if option == 6 {
+		return c.transferOwnership()
+	} else if option == 7 {
+		return c.leaveGroup()
+	} else if option == 8 {
+		return c.getMyGroups()
+	} else if option == 9 {
+		return c.getPosts()
+	} else if option == 10 {
+		return c.getGossipStats()
+	} else if option == 11 {
+		return c.inviteUser()
+	} else if option == 12 {
+		return c.requestJoin()
+	} else if option == 13 {
+		return c.reviewRequests()
+	} else if option == 14 {
+		return c.setRole()
+	} else if option == 15 {
+		return c.setVisibility()
+	} else if option == 16 {
+		return c.encryptGroup()
+	} else {
+		return fmt.Errorf("%s Chose invalid number %d", errPrefix, option)
+	}
+}
+
+// get() sends a read request to the gateway on behalf of the logged in user, who may see their private groups
+func (c *Client) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.sessionToken())
+
+	return c.httpClient.Do(req)
+}
+
+// post() sends a form to the gateway on behalf of the logged in user
+func (c *Client) post(url string, payload []byte) (*http.Response, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+c.sessionToken()) // server takes the user from the session, not the form
+
+	return c.httpClient.Do(req)
+}
+
+// ackGroupPosts() tells the server posts of a group were received, so they are not sent again when the user reconnects
+func (c *Client) ackGroupPosts(group string, ids []uint64) {
+	data := url.Values{}
+	data.Set("groupname", group)
+	for _, id := range ids {
+		data.Add("id", strconv.FormatUint(id, 10))
+	}
+
+	resp, err := c.post(c.gatewayURL+"/ackpost", []byte(data.Encode())) // HTTP request to gateway
+	if err != nil {
+		fmt.Println("Error acknowledging posts:", err) // posts are sent again on reconnect
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Error acknowledging posts: HTTP request error: %v\n", resp.StatusCode)
+	}
+}
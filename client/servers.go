@@ -0,0 +1,213 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sjsu-pub-sub/certs"
+	"sjsu-pub-sub/types"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// dialAndAuthenticate() creates a long-lived TCP connection to every server the gateway lists as up, to receive new
+// posts, then keeps the connections in step with the gateway's roster in the background until ctx is cancelled
+func (c *Client) dialAndAuthenticate(ctx context.Context) {
+	roster, err := c.getRoster(ctx, 0)
+	if err != nil {
+		fmt.Println("Unable to get servers from gateway, using configured servers:", err)
+		c.syncServers(c.config.Servers)
+	} else {
+		c.syncServers(rosterAddresses(roster))
+	}
+
+	fmt.Println("Sent servers username and port!")
+
+	go c.watchServers(ctx, roster.Version)
+}
+
+// watchServers() waits for the gateway's roster to change, then dials servers that came up and drops servers that went
+// away. Keeps the current connections while the gateway cannot be reached
+func (c *Client) watchServers(ctx context.Context, version uint64) {
+	for {
+		roster, err := c.getRoster(ctx, version)
+		if ctx.Err() != nil { // shutting down
+			return
+		}
+		if err != nil {
+			fmt.Println("Error getting servers from gateway:", err)
+			if version == 0 { // never reached the gateway, keep trying the configured servers
+				c.syncServers(c.config.Servers)
+			}
+			select {
+			case <-time.After(rosterRetryInterval):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		if roster.Version != version {
+			version = roster.Version
+			c.syncServers(rosterAddresses(roster))
+		}
+	}
+}
+
+// getRoster() asks the gateway for the servers that are up. If version is the roster this client has, the gateway
+// only answers once the roster changes or its poll timeout passes
+func (c *Client) getRoster(ctx context.Context, version uint64) (types.Roster, error) {
+	var roster types.Roster
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.gatewayURL+"/servers?version="+strconv.FormatUint(version, 10), nil)
+	if err != nil {
+		return roster, fmt.Errorf("Failed to create request: %v", err)
+	}
+
+	client := http.Client{Transport: c.httpClient.Transport, Timeout: time.Minute} // longer than the gateway's poll timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return roster, fmt.Errorf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return roster, fmt.Errorf("HTTP request error: %v", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&roster); err != nil {
+		return roster, fmt.Errorf("Error decoding servers: %v", err)
+	}
+
+	return roster, nil
+}
+
+// rosterAddresses() returns the addresses clients log in to of the servers in a roster
+func rosterAddresses(roster types.Roster) []string {
+	addresses := []string{}
+	for _, server := range roster.Servers {
+		if server.ClientAddress != "" {
+			addresses = append(addresses, server.ClientAddress)
+		}
+	}
+	return addresses
+}
+
+// syncServers() logs in to every wanted server without an open connection, and closes connections to servers no
+// longer wanted
+func (c *Client) syncServers(wanted []string) {
+	msg := types.AuthMessage{
+		Username: c.username,
+		Port:     c.address,
+		Token:    c.sessionToken(),
+	}
+
+	c.serverConnsMu.Lock()
+	c.wantedServers = wanted
+	isWanted := make(map[string]bool, len(wanted))
+	for _, server := range wanted {
+		isWanted[server] = true
+	}
+	for server, conn := range c.serverConns {
+		if !isWanted[server] {
+			fmt.Printf("Server %s went away, disconnecting...\n", server)
+			delete(c.serverConns, server)
+			conn.Close()
+		}
+	}
+	missing := []string{}
+	for _, server := range wanted {
+		if _, ok := c.serverConns[server]; !ok {
+			missing = append(missing, server)
+		}
+	}
+	c.serverConnsMu.Unlock()
+
+	// create TCP connection to 1) give server client IP for future gossip 2) create long-lived TCP connection
+	for _, server := range missing {
+		conn, err := certs.Dial(server, 5*time.Second, c.tls.ClientConfig(certs.RoleServer))
+		if err != nil {
+			fmt.Println("Unable to connect to TCP server", err)
+			continue
+		}
+		fmt.Printf("Connected to TCP server %s...\n", server)
+
+		err = authenticate(conn, msg) // send username and port so server can map client with username
+		if err != nil {
+			fmt.Println("Unable to write message", err)
+			conn.Close()
+			continue
+		}
+
+		c.serverConnsMu.Lock()
+		c.serverConns[server] = conn
+		c.serverConnsMu.Unlock()
+
+		go c.checkServerHealth(server, conn)
+	}
+}
+
+// authenticate() agrees on a protocol version with a server and sends it the user's username and gossip port
+func authenticate(conn net.Conn, msg types.AuthMessage) error {
+	session, err := types.StartSession(conn, msg.Username, []string{types.CapReplay}, types.MaxFrameSize)
+	if err != nil {
+		return err
+	}
+
+	_, err = session.Send(types.MsgAuth, msg)
+	return err
+}
+
+// checkServerHealth() waits for a server to close its login connection, then logs in to it again once it is back
+func (c *Client) checkServerHealth(server string, conn net.Conn) {
+	data := make([]byte, 1024)
+	for {
+		if _, err := conn.Read(data); err != nil {
+			break
+		}
+	}
+	conn.Close()
+
+	c.serverConnsMu.Lock()
+	dropped := c.serverConns[server] == conn
+	if dropped {
+		delete(c.serverConns, server)
+	}
+	c.serverConnsMu.Unlock()
+
+	if !dropped { // closed because the server left the roster
+		return
+	}
+
+	fmt.Printf("Lost connection to server %s\n", server) // log if server goes down
+
+	for {
+		select {
+		case <-time.After(rosterRetryInterval):
+		case <-c.done: // shutting down
+			return
+		}
+
+		c.serverConnsMu.Lock()
+		wanted := c.wantedServers
+		_, reconnected := c.serverConns[server]
+		c.serverConnsMu.Unlock()
+
+		if reconnected || !slices.Contains(wanted, server) { // roster changed in the meantime
+			return
+		}
+
+		c.syncServers(wanted)
+
+		c.serverConnsMu.Lock()
+		_, reconnected = c.serverConns[server]
+		c.serverConnsMu.Unlock()
+
+		if reconnected {
+			return
+		}
+	}
+}
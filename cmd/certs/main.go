@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sjsu-pub-sub/certs"
+	"sjsu-pub-sub/config"
+	"time"
+)
+
+// issues a certificate for a gateway, server or client of a test cluster, creating the cluster's CA first if the
+// directory does not hold one yet. Run once per binary, then copy ca.pem and the binary's certificate and key to its
+// host
+func main() {
+	cfg := config.DefaultCerts()
+	if err := config.Load("certs", &cfg); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if cfg.Name == "" {
+		cfg.Name = cfg.Role
+	}
+
+	validity := time.Duration(cfg.Validity)
+
+	ca, created, err := certs.LoadOrCreateCA(cfg.Dir, validity)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if created {
+		fmt.Printf("Created CA in %s. Keep ca-key.pem private, and copy only ca.pem to other hosts\n", cfg.Dir)
+	}
+
+	certPath, keyPath, err := ca.Issue(cfg.Dir, cfg.Role, cfg.Name, cfg.Hosts, validity)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Issued %s certificate for %s: %s and %s\n", cfg.Role, cfg.Name, certPath, keyPath)
+	fmt.Printf("Start it with -tlsca %s -tlscert %s -tlskey %s\n", certs.CAPath(cfg.Dir), certPath, keyPath)
+}
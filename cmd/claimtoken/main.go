@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sjsu-pub-sub/auth"
+	"sjsu-pub-sub/config"
+	"time"
+)
+
+// issues the token a user registered before passwords existed sets their password with. Give it to the user only once
+// they proved who they are some other way, as it lets whoever holds it take the username
+func main() {
+	cfg := config.DefaultClaim()
+	if err := config.Load("server", &cfg); err != nil { // same secret as the servers by default
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	signer := auth.NewSigner(cfg.SessionSecret, time.Duration(cfg.TTL))
+	token, expires := signer.IssueClaim(cfg.Username, time.Duration(cfg.TTL))
+
+	fmt.Printf("Claim token for %s, valid until %s and only until they set a password:\n%s\n", cfg.Username, expires.Local().Format(time.DateTime), token)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sjsu-pub-sub/client"
+	"sjsu-pub-sub/config"
+	"syscall"
+)
+
+func main() {
+	cfg := config.DefaultClient()
+	if err := config.Load("client", &cfg); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	c, err := client.New(cfg)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM) // log out on ctrl + C
+	defer stop()
+
+	if err := c.Run(ctx); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sjsu-pub-sub/config"
+	"sjsu-pub-sub/gateway"
+	"syscall"
+)
+
+func main() {
+	cfg := config.DefaultGateway()
+	if err := config.Load("gateway", &cfg); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	g, err := gateway.New(cfg)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM) // shut down on ctrl + C
+	defer stop()
+
+	if err := g.Run(ctx); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
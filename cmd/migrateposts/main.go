@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sjsu-pub-sub/config"
+	"sjsu-pub-sub/store"
+)
+
+// moves posts embedded in Groups documents into the Posts collection. Run once against each server's MongoDB
+// instance before starting the upgraded server on it
+func main() {
+	cfg := config.DefaultMigrate()
+	if err := config.Load("server", &cfg); err != nil { // same database as the servers by default
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	db, err := store.NewMongoStore(cfg.MongoURI, cfg.Database) // also creates the Posts indexes
+	if err != nil {
+		fmt.Printf("Error connecting to DB: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	moved, err := db.MigrateEmbeddedPosts()
+	if err != nil {
+		fmt.Printf("Error migrating posts after moving %d: %v\n", moved, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Moved %d posts into the Posts collection\n", moved)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sjsu-pub-sub/auth"
+)
+
+// generates the key servers sign posts with, and the public key clients verify them with. Give every server the same
+// signing key and keep it as secret as the session secret, as whoever holds it can forge posts
+func main() {
+	signingKey, postKey, err := auth.GeneratePostKey()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Signing key for every server (-signingkey or PUBSUB_SERVER_SIGNING_KEY), keep it secret:\n%s\n", signingKey)
+	fmt.Printf("Post key for every client (-postkey, postKey in the client section or PUBSUB_CLIENT_POST_KEY):\n%s\n", postKey)
+}
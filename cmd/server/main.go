@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sjsu-pub-sub/broker"
+	"sjsu-pub-sub/config"
+	"syscall"
+)
+
+func main() {
+	cfg := config.DefaultServer()
+	if err := config.Load("server", &cfg); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	b, err := broker.New(cfg)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM) // shut down on ctrl + C
+	defer stop()
+
+	if err := b.Run(ctx); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Certs holds the settings of the certificate tool, which creates a test cluster's CA and issues certificates signed
+// by it
+type Certs struct {
+	Dir      string   `json:"dir" env:"PUBSUB_CERTS_DIR" flag:"dir" usage:"Directory holding the CA, created along with it if missing, and the certificates issued"`
+	Role     string   `json:"role" env:"PUBSUB_CERTS_ROLE" flag:"role" usage:"What the certificate's holder acts as: gateway, server or client"`
+	Name     string   `json:"name" env:"PUBSUB_CERTS_NAME" flag:"name" usage:"Name of the certificate's holder, also naming its files (default the role)"`
+	Hosts    []string `json:"hosts" env:"PUBSUB_CERTS_HOSTS" flag:"hosts" usage:"Comma-separated hostnames and IPs the holder is reached on"`
+	Validity Duration `json:"validity" env:"PUBSUB_CERTS_VALIDITY" flag:"validity" usage:"How long the CA and the certificate are valid for"`
+}
+
+// DefaultCerts() returns the certificate tool's defaults
+func DefaultCerts() Certs {
+	return Certs{
+		Dir:      "tls",
+		Hosts:    []string{},
+		Validity: Duration(365 * 24 * time.Hour),
+	}
+}
+
+// Validate() checks the certificate tool's settings
+func (c Certs) Validate() error {
+	if c.Dir == "" {
+		return fmt.Errorf("dir must not be empty")
+	}
+	if c.Role == "" {
+		return fmt.Errorf("role must be set to gateway, server or client")
+	}
+	if len(c.Hosts) == 0 {
+		return fmt.Errorf("hosts must list the hostnames or IPs the holder is reached on, as peers check them")
+	}
+	if c.Validity <= 0 {
+		return fmt.Errorf("validity must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"sjsu-pub-sub/auth"
+	"sjsu-pub-sub/gossip"
+)
+
+// Client holds the settings of a client
+type Client struct {
+	Shared
+	Servers     []string `json:"servers" env:"PUBSUB_CLIENT_SERVERS" flag:"servers" usage:"Comma-separated addresses of the servers to log in to over TCP while the gateway cannot be reached"`
+	Fanout      int      `json:"fanout" env:"PUBSUB_CLIENT_FANOUT" flag:"fanout" usage:"Groupmates each new post is gossiped to per round"`
+	Rounds      int      `json:"rounds" env:"PUBSUB_CLIENT_ROUNDS" flag:"rounds" usage:"Rounds each new post is gossiped for"`
+	TTL         int      `json:"ttl" env:"PUBSUB_CLIENT_TTL" flag:"ttl" usage:"Hops a post is gossiped if the server did not set a limit"`
+	AntiEntropy Duration `json:"antiEntropy" env:"PUBSUB_CLIENT_ANTI_ENTROPY" flag:"antientropy" usage:"Time between digest exchanges with a random groupmate, 0 to disable"`
+	KeyDir      string   `json:"keyDir" env:"PUBSUB_CLIENT_KEY_DIR" flag:"keydir" usage:"Directory holding each user's key pair for end-to-end encrypted groups, created along with a key pair if missing"`
+	PostKey     string   `json:"postKey" env:"PUBSUB_CLIENT_POST_KEY" flag:"postkey" usage:"Base64 Ed25519 public key the servers sign posts with, printed by cmd/postkey along with their signing key"`
+}
+
+// DefaultClient() returns a client's defaults
+func DefaultClient() Client {
+	gossipDefaults := gossip.DefaultConfig()
+
+	return Client{
+		Shared:      DefaultShared(),
+		Servers:     []string{"34.125.39.1:8081", "34.16.150.3:8081", "34.125.18.161:8081"},
+		Fanout:      gossipDefaults.Fanout,
+		Rounds:      gossipDefaults.Rounds,
+		TTL:         gossipDefaults.TTL,
+		AntiEntropy: Duration(gossipDefaults.AntiEntropyInterval),
+		KeyDir:      "keys",
+	}
+}
+
+// Validate() checks a client's settings
+func (c Client) Validate() error {
+	if err := c.Shared.Validate(); err != nil {
+		return err
+	}
+	if len(c.Servers) == 0 {
+		return fmt.Errorf("servers must list at least one server")
+	}
+	if c.Fanout < 1 || c.Rounds < 1 || c.TTL < 1 {
+		return fmt.Errorf("fanout, rounds and ttl must be at least 1")
+	}
+	if c.AntiEntropy < 0 {
+		return fmt.Errorf("antiEntropy must not be negative")
+	}
+	if c.KeyDir == "" {
+		return fmt.Errorf("keyDir must not be empty")
+	}
+	if _, err := auth.NewPostVerifier(c.PostKey); err != nil { // posts relayed by other clients cannot be trusted without it
+		return fmt.Errorf("postKey: %v", err)
+	}
+	return nil
+}
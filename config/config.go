@@ -0,0 +1,320 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"sjsu-pub-sub/certs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// every setting of every binary can come from four places. Later ones override earlier ones:
+//  1. defaults, compiled in
+//  2. a JSON config file, named by -config or PUBSUB_CONFIG. Settings shared by all binaries go at the top level,
+//     the rest in a section named after the binary, e.g. {"gatewayHost": "10.0.0.2", "server": {"store": "file"}}
+//  3. environment variables, e.g. PUBSUB_SERVER_STORE=file
+//  4. command line flags, e.g. -store file
+//
+// so one build runs in any environment by pointing it at that environment's config file
+
+// configFileEnv names the environment variable holding the config file path, if -config is not given
+const configFileEnv = "PUBSUB_CONFIG"
+
+// Duration is a time.Duration written as "1s" or "500ms" in config files, environment variables and flags
+type Duration time.Duration
+
+// String() formats a duration like time.Duration does
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Set() parses a duration like time.ParseDuration does
+func (d *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON() writes a duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON() reads a duration written as a string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"1s\": %v", err)
+	}
+	return d.Set(value)
+}
+
+// Shared holds the settings every binary needs
+type Shared struct {
+	GatewayHost       string `json:"gatewayHost" env:"PUBSUB_GATEWAY_HOST" flag:"gatewayhost" usage:"Host the gateway runs on"`
+	GatewayHTTPPort   int    `json:"gatewayHttpPort" env:"PUBSUB_GATEWAY_HTTP_PORT" flag:"gatewayhttpport" usage:"Port the gateway serves client requests on"`
+	GatewayServerPort int    `json:"gatewayServerPort" env:"PUBSUB_GATEWAY_SERVER_PORT" flag:"gatewayserverport" usage:"Port the gateway receives server registrations and heartbeats on"`
+	TLSCA             string `json:"tlsCa" env:"PUBSUB_TLS_CA" flag:"tlsca" usage:"CA certificate every peer's certificate must be signed by. Turns on TLS for all traffic (default plaintext)"`
+	TLSCert           string `json:"tlsCert" env:"PUBSUB_TLS_CERT" flag:"tlscert" usage:"This binary's certificate, signed by -tlsca"`
+	TLSKey            string `json:"tlsKey" env:"PUBSUB_TLS_KEY" flag:"tlskey" usage:"This binary's private key"`
+}
+
+// DefaultShared() returns the settings of the GCP deployment
+func DefaultShared() Shared {
+	return Shared{
+		GatewayHost:       "34.125.114.92",
+		GatewayHTTPPort:   8080,
+		GatewayServerPort: 8087,
+	}
+}
+
+// GatewayURL() returns the base URL clients send requests to
+func (s Shared) GatewayURL() string {
+	return s.Scheme() + "://" + joinHostPort(s.GatewayHost, s.GatewayHTTPPort)
+}
+
+// Scheme() returns the URL scheme of the gateway's and servers' HTTP APIs
+func (s Shared) Scheme() string {
+	if s.TLSCA != "" {
+		return "https"
+	}
+	return "http"
+}
+
+// TLSFiles() returns the TLS certificate files of a binary
+func (s Shared) TLSFiles() certs.Files {
+	return certs.Files{CA: s.TLSCA, Cert: s.TLSCert, Key: s.TLSKey}
+}
+
+// GatewayServerAddress() returns the address servers register and send heartbeats to
+func (s Shared) GatewayServerAddress() string {
+	return joinHostPort(s.GatewayHost, s.GatewayServerPort)
+}
+
+// Validate() checks the shared settings
+func (s Shared) Validate() error {
+	if s.GatewayHost == "" {
+		return fmt.Errorf("gatewayHost must not be empty")
+	}
+	if err := checkPort("gatewayHttpPort", s.GatewayHTTPPort); err != nil {
+		return err
+	}
+	if err := checkPort("gatewayServerPort", s.GatewayServerPort); err != nil {
+		return err
+	}
+	if s.GatewayHTTPPort == s.GatewayServerPort {
+		return fmt.Errorf("gatewayHttpPort and gatewayServerPort must differ")
+	}
+	if s.TLSCA == "" && (s.TLSCert != "" || s.TLSKey != "") {
+		return fmt.Errorf("tlsCa must be set to use tlsCert and tlsKey")
+	}
+	if s.TLSCA != "" && (s.TLSCert == "" || s.TLSKey == "") { // every binary both listens and dials with its certificate
+		return fmt.Errorf("tlsCert and tlsKey must be set when tlsCa is")
+	}
+	return nil
+}
+
+// Load() fills cfg, a pointer to a struct holding a binary's defaults, from the config file, environment variables
+// and command line flags, then validates it. section names the binary's section of the config file. Fields are
+// matched by their json, env and flag tags, and structs embedded in cfg, like Shared, are read from the top level
+// of the config file
+func Load(section string, cfg interface{}) error {
+	target := reflect.ValueOf(cfg)
+	if target.Kind() != reflect.Pointer || target.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config must be a pointer to a struct")
+	}
+
+	path := configPath(os.Args[1:])
+	if path != "" {
+		if err := loadFile(path, section, cfg); err != nil {
+			return err
+		}
+	}
+
+	fields := settings(target.Elem())
+
+	for _, field := range fields {
+		if field.env == "" {
+			continue
+		}
+		if value, ok := os.LookupEnv(field.env); ok {
+			if err := field.Set(value); err != nil {
+				return fmt.Errorf("Error reading %s: %v", field.env, err)
+			}
+		}
+	}
+
+	flag.String("config", path, "JSON file to read settings from (env "+configFileEnv+")")
+	for _, field := range fields {
+		if field.flag != "" {
+			flag.Var(field, field.flag, field.usage)
+		}
+	}
+	flag.Parse()
+
+	if validator, ok := cfg.(interface{ Validate() error }); ok {
+		if err := validator.Validate(); err != nil {
+			return fmt.Errorf("Invalid config: %v", err)
+		}
+	}
+	return nil
+}
+
+// configPath() returns the config file named by -config among args, or by the environment
+func configPath(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		if len(name) == len(arg) || len(arg)-len(name) > 2 {
+			continue // not a flag
+		}
+
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, "config=") {
+			return strings.TrimPrefix(name, "config=")
+		}
+	}
+
+	return os.Getenv(configFileEnv)
+}
+
+// loadFile() reads the settings of the structs embedded in cfg from the top level of a config file, then the binary's
+// section over them
+func loadFile(path string, section string, cfg interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Error reading config file: %v", err)
+	}
+
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Type().Field(i).Anonymous {
+			continue
+		}
+		if err := json.Unmarshal(data, v.Field(i).Addr().Interface()); err != nil { // shared settings only
+			return fmt.Errorf("Error parsing config file %s: %v", path, err)
+		}
+	}
+
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return fmt.Errorf("Error parsing config file %s: %v", path, err)
+	}
+
+	if raw, ok := sections[section]; ok {
+		if err := json.Unmarshal(raw, cfg); err != nil {
+			return fmt.Errorf("Error parsing %s section of config file %s: %v", section, path, err)
+		}
+	}
+
+	return nil
+}
+
+// setting is a field of a config struct, settable from a string. It implements flag.Value
+type setting struct {
+	value reflect.Value
+	env   string
+	flag  string
+	usage string
+}
+
+// settings() returns the tagged fields of a config struct, including those of embedded structs
+func settings(v reflect.Value) []*setting {
+	result := []*setting{}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			result = append(result, settings(v.Field(i))...)
+			continue
+		}
+
+		if field.Tag.Get("env") == "" && field.Tag.Get("flag") == "" {
+			continue
+		}
+
+		result = append(result, &setting{
+			value: v.Field(i),
+			env:   field.Tag.Get("env"),
+			flag:  field.Tag.Get("flag"),
+			usage: field.Tag.Get("usage"),
+		})
+	}
+	return result
+}
+
+// String() formats the field's current value, shown as the flag's default in -help
+func (s *setting) String() string {
+	if s == nil || !s.value.IsValid() {
+		return ""
+	}
+
+	switch value := s.value.Addr().Interface().(type) {
+	case *Duration:
+		return value.String()
+	case *[]string:
+		return strings.Join(*value, ",")
+	}
+	return fmt.Sprint(s.value.Interface())
+}
+
+// Set() parses a string into the field. Lists are comma-separated
+func (s *setting) Set(text string) error {
+	if duration, ok := s.value.Addr().Interface().(*Duration); ok {
+		return duration.Set(text)
+	}
+
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(text)
+	case reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", text)
+		}
+		s.value.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", text)
+		}
+		s.value.SetFloat(f)
+	case reflect.Slice:
+		list := []string{}
+		for _, elem := range strings.Split(text, ",") {
+			if elem = strings.TrimSpace(elem); elem != "" {
+				list = append(list, elem)
+			}
+		}
+		s.value.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+	return nil
+}
+
+// checkPort() checks a port number is in range
+func checkPort(name string, port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("%s must be between 1 and 65535, got %d", name, port)
+	}
+	return nil
+}
+
+// joinHostPort() joins a host and port into an address
+func joinHostPort(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"sjsu-pub-sub/detector"
+	"time"
+)
+
+// Gateway holds the settings of the gateway
+type Gateway struct {
+	Shared
+	Phi             float64  `json:"phi" env:"PUBSUB_GATEWAY_PHI" flag:"phi" usage:"Suspicion above which a server is suspected to be down"`
+	DownAfter       int      `json:"downAfter" env:"PUBSUB_GATEWAY_DOWN_AFTER" flag:"downafter" usage:"Consecutive checks a server must be suspected in before it is declared down"`
+	UpAfter         int      `json:"upAfter" env:"PUBSUB_GATEWAY_UP_AFTER" flag:"upafter" usage:"Consecutive heartbeats a down server must send before it is readmitted"`
+	AcceptablePause Duration `json:"acceptablePause" env:"PUBSUB_GATEWAY_ACCEPTABLE_PAUSE" flag:"acceptablepause" usage:"Heartbeat delay tolerated on top of the usual interval"`
+	CheckInterval   Duration `json:"checkInterval" env:"PUBSUB_GATEWAY_CHECK_INTERVAL" flag:"checkinterval" usage:"Time between checks for servers that stopped sending heartbeats"`
+}
+
+// DefaultGateway() returns the gateway's defaults
+func DefaultGateway() Gateway {
+	detectorDefaults := detector.DefaultConfig()
+
+	return Gateway{
+		Shared:          DefaultShared(),
+		Phi:             detectorDefaults.Threshold,
+		DownAfter:       detectorDefaults.DownAfter,
+		UpAfter:         detectorDefaults.UpAfter,
+		AcceptablePause: Duration(detectorDefaults.AcceptablePause),
+		CheckInterval:   Duration(time.Second),
+	}
+}
+
+// Validate() checks the gateway's settings
+func (g Gateway) Validate() error {
+	if err := g.Shared.Validate(); err != nil {
+		return err
+	}
+	if g.Phi <= 0 {
+		return fmt.Errorf("phi must be positive, got %v", g.Phi)
+	}
+	if g.DownAfter < 1 || g.UpAfter < 1 {
+		return fmt.Errorf("downAfter and upAfter must be at least 1")
+	}
+	if g.AcceptablePause < 0 {
+		return fmt.Errorf("acceptablePause must not be negative")
+	}
+	if g.CheckInterval <= 0 {
+		return fmt.Errorf("checkInterval must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sjsu-pub-sub/auth"
+	"sjsu-pub-sub/gossip"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// shortest session secret a server starts with
+const minSessionSecret = 16
+
+// Server holds the settings of a server
+type Server struct {
+	Shared
+	Host          string   `json:"host" env:"PUBSUB_SERVER_HOST" flag:"host" usage:"Hostname other servers and the gateway reach this server on"`
+	Port          int      `json:"port" env:"PUBSUB_SERVER_PORT" flag:"port" usage:"Port clients log in on over TCP"`
+	RaftPort      int      `json:"raftPort" env:"PUBSUB_SERVER_RAFT_PORT" flag:"raftport" usage:"Port this server exchanges Raft messages on, and of peers listed without a port"`
+	HTTPPort      int      `json:"httpPort" env:"PUBSUB_SERVER_HTTP_PORT" flag:"httpport" usage:"Port the gateway forwards client requests to"`
+	NodeId        string   `json:"nodeId" env:"PUBSUB_SERVER_NODE_ID" flag:"nodeid" usage:"Id identifying this server to the gateway (default read from -nodeidfile, or generated and saved there)"`
+	NodeIdFile    string   `json:"nodeIdFile" env:"PUBSUB_SERVER_NODE_ID_FILE" flag:"nodeidfile" usage:"File this server's generated node id is kept in"`
+	Peers         []string `json:"peers" env:"PUBSUB_SERVER_PEERS" flag:"peers" usage:"Comma-separated host:raftport of all other servers. This server is left out if listed, and the port defaults to -raftport"`
+	RaftState     string   `json:"raftState" env:"PUBSUB_SERVER_RAFT_STATE" flag:"raftstate" usage:"File to persist the Raft term and vote to. The replicated log is appended to the same name ending in .log"`
+	Quorum        int      `json:"quorum" env:"PUBSUB_SERVER_QUORUM" flag:"quorum" usage:"Servers that must persist a write before it is acknowledged (0 for majority)"`
+	Store         string   `json:"store" env:"PUBSUB_SERVER_STORE" flag:"store" usage:"Where to keep users and groups: mongo or file"`
+	DataFile      string   `json:"dataFile" env:"PUBSUB_SERVER_DATA_FILE" flag:"datafile" usage:"File the file store appends to, or empty to keep it in memory"`
+	MongoURI      string   `json:"mongoUri" env:"PUBSUB_SERVER_MONGO_URI" flag:"mongouri" usage:"MongoDB instance the mongo store connects to"`
+	Database      string   `json:"database" env:"PUBSUB_SERVER_DATABASE" flag:"database" usage:"MongoDB database holding the Users, Groups, Posts and Offsets collections"`
+	SeedFanout    int      `json:"seedFanout" env:"PUBSUB_SERVER_SEED_FANOUT" flag:"seedfanout" usage:"Groupmates the leader sends each new post to, which gossip it to the rest"`
+	GossipTTL     int      `json:"gossipTtl" env:"PUBSUB_SERVER_GOSSIP_TTL" flag:"gossipttl" usage:"Hops a post is gossiped from the leader before clients stop forwarding it"`
+	Heartbeat     Duration `json:"heartbeat" env:"PUBSUB_SERVER_HEARTBEAT" flag:"heartbeat" usage:"Time between heartbeats sent to the gateway"`
+	SessionSecret string   `json:"sessionSecret" env:"PUBSUB_SERVER_SESSION_SECRET" flag:"sessionsecret" usage:"Secret session tokens are signed with, the same on every server"`
+	SessionTTL    Duration `json:"sessionTtl" env:"PUBSUB_SERVER_SESSION_TTL" flag:"sessionttl" usage:"How long a user stays logged in"`
+	SigningKey    string   `json:"signingKey" env:"PUBSUB_SERVER_SIGNING_KEY" flag:"signingkey" usage:"Base64 Ed25519 seed posts sent to clients are signed with, the same on every server. Generate one with cmd/postkey"`
+}
+
+// DefaultServer() returns a server's defaults
+func DefaultServer() Server {
+	hostname, _ := os.Hostname()
+
+	return Server{
+		Shared:     DefaultShared(),
+		Host:       hostname,
+		Port:       8081,
+		RaftPort:   8082,
+		HTTPPort:   8080,
+		NodeIdFile: "node.id",
+		Peers:      []string{},
+		RaftState:  "raft.json",
+		Store:      "mongo",
+		DataFile:   "pubsub.log",
+		MongoURI:   "mongodb://localhost:27017",
+		Database:   "Test",
+		SeedFanout: 2,
+		GossipTTL:  gossip.DefaultConfig().TTL,
+		Heartbeat:  Duration(time.Second),
+		SessionTTL: Duration(24 * time.Hour),
+	}
+}
+
+// Validate() checks a server's settings
+func (s Server) Validate() error {
+	if err := s.Shared.Validate(); err != nil {
+		return err
+	}
+	if s.Host == "" {
+		return fmt.Errorf("host must not be empty")
+	}
+	for name, port := range map[string]int{"port": s.Port, "raftPort": s.RaftPort, "httpPort": s.HTTPPort} {
+		if err := checkPort(name, port); err != nil {
+			return err
+		}
+	}
+	if s.Port == s.RaftPort || s.Port == s.HTTPPort || s.RaftPort == s.HTTPPort {
+		return fmt.Errorf("port, raftPort and httpPort must all differ")
+	}
+	for _, peer := range s.Peers {
+		if err := checkPeer(peer); err != nil {
+			return err
+		}
+	}
+	if s.NodeId == "" && s.NodeIdFile == "" {
+		return fmt.Errorf("nodeId or nodeIdFile must be set")
+	}
+	if s.Quorum < 0 {
+		return fmt.Errorf("quorum must not be negative")
+	}
+	switch s.Store {
+	case "mongo":
+		if s.MongoURI == "" || s.Database == "" {
+			return fmt.Errorf("mongoUri and database must be set for the mongo store")
+		}
+	case "file":
+	default:
+		return fmt.Errorf("unknown store %q, use mongo or file", s.Store)
+	}
+	if s.SeedFanout < 1 || s.GossipTTL < 1 {
+		return fmt.Errorf("seedFanout and gossipTtl must be at least 1")
+	}
+	if s.Heartbeat <= 0 {
+		return fmt.Errorf("heartbeat must be positive")
+	}
+	if len(s.SessionSecret) < minSessionSecret { // anyone who can guess the secret can log in as anyone
+		return fmt.Errorf("sessionSecret must be at least %d characters", minSessionSecret)
+	}
+	if s.SessionTTL <= 0 {
+		return fmt.Errorf("sessionTtl must be positive")
+	}
+	if _, err := auth.NewPostSigner(s.SigningKey); err != nil { // clients drop every post unless it matches their postKey
+		return fmt.Errorf("signingKey: %v", err)
+	}
+	return nil
+}
+
+// RaftAddress() returns the address other servers send Raft messages to, which also identifies this server in Raft
+func (s Server) RaftAddress() string {
+	return joinHostPort(s.Host, s.RaftPort)
+}
+
+// RaftPeers() returns the Raft address of every other server, giving peers listed without a port this server's Raft
+// port
+func (s Server) RaftPeers() []string {
+	peers := []string{}
+	for _, peer := range s.Peers {
+		address := peer
+		if _, _, err := net.SplitHostPort(peer); err != nil { // no port
+			address = joinHostPort(peer, s.RaftPort)
+		}
+		if address != s.RaftAddress() && !slices.Contains(peers, address) {
+			peers = append(peers, address)
+		}
+	}
+	return peers
+}
+
+// checkPeer() checks a peer is a host, or a host and valid port
+func checkPeer(peer string) error {
+	host, port, err := net.SplitHostPort(peer)
+	if err != nil {
+		host, port = peer, ""
+	}
+	if host == "" {
+		return fmt.Errorf("peer %q has no host", peer)
+	}
+	if port == "" {
+		return nil
+	}
+
+	number, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("peer %q has an invalid port", peer)
+	}
+	return checkPort("peer "+peer+" port", number)
+}
+
+// Migrate holds the settings of the post migration tool, read from the server section so it migrates the database
+// the servers use
+type Migrate struct {
+	MongoURI string `json:"mongoUri" env:"PUBSUB_SERVER_MONGO_URI" flag:"uri" usage:"MongoDB instance to migrate"`
+	Database string `json:"database" env:"PUBSUB_SERVER_DATABASE" flag:"db" usage:"Database holding the Users and Groups collections"`
+}
+
+// DefaultMigrate() returns the migration tool's defaults
+func DefaultMigrate() Migrate {
+	return Migrate{
+		MongoURI: "mongodb://localhost:27017",
+		Database: "Test",
+	}
+}
+
+// Validate() checks the migration tool's settings
+func (m Migrate) Validate() error {
+	if m.MongoURI == "" || m.Database == "" {
+		return fmt.Errorf("uri and db must not be empty")
+	}
+	return nil
+}
+
+// Claim holds the settings of the claim token tool, read from the server section so it signs tokens with the secret
+// the servers check them with
+type Claim struct {
+	SessionSecret string   `json:"sessionSecret" env:"PUBSUB_SERVER_SESSION_SECRET" flag:"sessionsecret" usage:"Secret the servers sign session tokens with"`
+	Username      string   `json:"-" flag:"user" usage:"User registered before passwords existed to issue the claim token for"`
+	TTL           Duration `json:"-" flag:"ttl" usage:"How long the claim token is valid"`
+}
+
+// DefaultClaim() returns the claim token tool's defaults
+func DefaultClaim() Claim {
+	return Claim{
+		TTL: Duration(72 * time.Hour),
+	}
+}
+
+// Validate() checks the claim token tool's settings
+func (c Claim) Validate() error {
+	if c.Username == "" {
+		return fmt.Errorf("user must not be empty")
+	}
+	if len(c.SessionSecret) < minSessionSecret {
+		return fmt.Errorf("sessionSecret must be at least %d characters", minSessionSecret)
+	}
+	if c.TTL <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package detector
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config tunes how quickly a node that stops sending heartbeats is declared down, and how quickly it is readmitted
+type Config struct {
+	Threshold       float64       // phi above which a node is suspected. 8 means a 1 in 10^8 chance the suspicion is wrong
+	DownAfter       int           // consecutive checks a node must be suspected in before it is declared down
+	UpAfter         int           // consecutive heartbeats a down node must send before it is readmitted
+	WindowSize      int           // heartbeat intervals the distribution of intervals is estimated from
+	MinStdDev       time.Duration // lower bound on the estimated deviation, so perfectly regular heartbeats do not make phi jumpy
+	AcceptablePause time.Duration // extra delay tolerated on top of the estimated interval, e.g. for GC or VM pauses
+}
+
+// DefaultConfig() returns settings that declare a node sending a heartbeat every second down after about 5 seconds of
+// silence, and tolerate a couple of lost heartbeats
+func DefaultConfig() Config {
+	return Config{
+		Threshold:       8,
+		DownAfter:       3,
+		UpAfter:         3,
+		WindowSize:      100,
+		MinStdDev:       100 * time.Millisecond,
+		AcceptablePause: time.Second,
+	}
+}
+
+// heartbeat history of a single node
+type node struct {
+	intervals []time.Duration // last WindowSize intervals between heartbeats
+	last      time.Time       // when the last heartbeat arrived
+	up        bool
+	suspected int // consecutive checks phi was above Threshold in
+	recovered int // consecutive heartbeats received while down
+}
+
+// Detector decides which nodes are up from the heartbeats they send, using the phi accrual failure detector: instead of
+// declaring a node down after a fixed timeout, it estimates how likely a heartbeat is to still arrive given the
+// intervals seen so far, so slow or jittery networks raise the timeout on their own
+type Detector struct {
+	mu     sync.Mutex
+	config Config
+	nodes  map[string]*node
+}
+
+// New() creates a detector that knows no nodes yet
+func New(config Config) *Detector {
+	return &Detector{
+		config: config,
+		nodes:  make(map[string]*node),
+	}
+}
+
+// Heartbeat() records a heartbeat from a node. interval is how often the node sends heartbeats, used as the estimate
+// until enough have arrived. Returns true if the node just came up, either for the first time or after being down for
+// UpAfter heartbeats
+func (d *Detector) Heartbeat(name string, interval time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+
+	n, ok := d.nodes[name]
+	if !ok {
+		d.nodes[name] = &node{
+			intervals: []time.Duration{interval},
+			last:      now,
+			up:        true,
+		}
+		return true
+	}
+
+	if n.up || n.recovered > 0 { // the gap of an outage says nothing about the node's usual interval
+		n.intervals = append(n.intervals, now.Sub(n.last))
+		if len(n.intervals) > d.config.WindowSize {
+			n.intervals = n.intervals[len(n.intervals)-d.config.WindowSize:]
+		}
+	}
+	n.last = now
+
+	if n.up {
+		return false
+	}
+
+	n.recovered++
+	if n.recovered < d.config.UpAfter { // wait for the node to be stable before routing to it again
+		return false
+	}
+
+	n.up = true
+	n.suspected = 0
+	n.recovered = 0
+	return true
+}
+
+// Check() updates every node's suspicion and returns the nodes that just went down. Call it at a fixed rate, so
+// DownAfter is a duration
+func (d *Detector) Check() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	down := []string{}
+	for name, n := range d.nodes {
+		if !n.up {
+			if d.phi(n) > d.config.Threshold {
+				n.recovered = 0 // silent again, recovery starts over
+			}
+			continue
+		}
+
+		if d.phi(n) <= d.config.Threshold {
+			n.suspected = 0
+			continue
+		}
+
+		n.suspected++
+		if n.suspected >= d.config.DownAfter { // a single slow heartbeat is not enough
+			n.up = false
+			n.recovered = 0
+			down = append(down, name)
+		}
+	}
+
+	sort.Strings(down)
+	return down
+}
+
+// Remove() forgets a node, e.g. one that shut down cleanly
+func (d *Detector) Remove(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.nodes, name)
+}
+
+// Phi() returns the current suspicion of a node, 0 if it is unknown
+func (d *Detector) Phi(name string) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n, ok := d.nodes[name]
+	if !ok {
+		return 0
+	}
+	return d.phi(n)
+}
+
+// Up() returns the nodes currently considered up, sorted by name
+func (d *Detector) Up() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := []string{}
+	for name, n := range d.nodes {
+		if n.up {
+			result = append(result, name)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// phi() returns -log10 of the probability that the next heartbeat of a node arrives later than now, assuming
+// heartbeat intervals are normally distributed. Caller must hold lock
+func (d *Detector) phi(n *node) float64 {
+	var sum float64
+	for _, interval := range n.intervals {
+		sum += float64(interval)
+	}
+	mean := sum / float64(len(n.intervals))
+
+	var squares float64
+	for _, interval := range n.intervals {
+		squares += (float64(interval) - mean) * (float64(interval) - mean)
+	}
+	stdDev := max(math.Sqrt(squares/float64(len(n.intervals))), float64(d.config.MinStdDev))
+
+	mean += float64(d.config.AcceptablePause)
+	elapsed := float64(time.Since(n.last))
+
+	// logistic approximation of the normal CDF, accurate to within about 0.014%
+	y := (elapsed - mean) / stdDev
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return -math.Log10(e / (1 + e))
+	}
+	return -math.Log10(1 - 1/(1+e))
+}
@@ -0,0 +1,160 @@
+package detector
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testConfig() returns settings with no acceptable pause, so phi depends only on the intervals seen
+func testConfig() Config {
+	config := DefaultConfig()
+	config.AcceptablePause = 0
+	return config
+}
+
+// silence() makes a node's last heartbeat arrive elapsed ago
+func silence(d *Detector, name string, elapsed time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nodes[name].last = time.Now().Add(-elapsed)
+}
+
+func TestPhi(t *testing.T) {
+	d := New(testConfig())
+	d.Heartbeat("a", time.Second)
+
+	// with a single interval of 1s, the deviation is MinStdDev, so every 100ms of silence past 1s is one deviation
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+	}{
+		{"just heard from", 0},
+		{"one deviation early", 900 * time.Millisecond},
+		{"at the mean", time.Second},
+		{"one deviation late", 1100 * time.Millisecond},
+		{"two deviations late", 1200 * time.Millisecond},
+		{"three deviations late", 1300 * time.Millisecond},
+		{"four deviations late", 1400 * time.Millisecond},
+	}
+
+	previous := -1.0
+	for _, tt := range tests {
+		silence(d, "a", tt.elapsed)
+		got := d.Phi("a")
+
+		y := float64(tt.elapsed-time.Second) / float64(100*time.Millisecond)
+		want := -math.Log10(math.Erfc(y/math.Sqrt2) / 2) // exact tail of the normal distribution
+
+		// the logistic approximation is off by at most about 0.014%
+		if math.Abs(math.Pow(10, -got)-math.Pow(10, -want)) > 0.0002 {
+			t.Errorf("%s: got phi %.3f, want %.3f", tt.name, got, want)
+		}
+		if got <= previous {
+			t.Errorf("%s: phi %.3f did not grow with silence, was %.3f", tt.name, got, previous)
+		}
+		previous = got
+	}
+
+	if phi := d.Phi("unknown"); phi != 0 {
+		t.Errorf("unknown node: got phi %.3f, want 0", phi)
+	}
+}
+
+func TestPhiAdaptsToJitter(t *testing.T) {
+	steady := New(testConfig())
+	jittery := New(testConfig())
+	steady.Heartbeat("a", time.Second)
+	jittery.Heartbeat("a", time.Second)
+
+	steady.nodes["a"].intervals = []time.Duration{time.Second, time.Second, time.Second, time.Second}
+	jittery.nodes["a"].intervals = []time.Duration{500 * time.Millisecond, 1500 * time.Millisecond, 500 * time.Millisecond, 1500 * time.Millisecond}
+
+	silence(steady, "a", 1500*time.Millisecond)
+	silence(jittery, "a", 1500*time.Millisecond)
+
+	if s, j := steady.Phi("a"), jittery.Phi("a"); s <= j {
+		t.Errorf("after the same silence, got phi %.3f for steady heartbeats and %.3f for jittery ones, want steady higher", s, j)
+	}
+}
+
+func TestDownAndUp(t *testing.T) {
+	d := New(testConfig())
+	if !d.Heartbeat("a", time.Second) || !d.Heartbeat("b", time.Second) {
+		t.Fatal("first heartbeat did not bring node up")
+	}
+	if d.Heartbeat("a", time.Second) {
+		t.Error("second heartbeat of a node already up reported it coming up")
+	}
+
+	silence(d, "a", 10*time.Second)
+	for i := 1; i < d.config.DownAfter; i++ {
+		if down := d.Check(); len(down) != 0 {
+			t.Fatalf("check %d: declared %v down before %d checks", i, down, d.config.DownAfter)
+		}
+	}
+	if down := d.Check(); !slices.Equal(down, []string{"a"}) {
+		t.Fatalf("got %v down, want [a]", down)
+	}
+	if up := d.Up(); !slices.Equal(up, []string{"b"}) {
+		t.Errorf("got %v up, want [b]", up)
+	}
+	if down := d.Check(); len(down) != 0 {
+		t.Errorf("node already down reported down again: %v", down)
+	}
+
+	intervals := len(d.nodes["a"].intervals)
+	for i := 1; i < d.config.UpAfter; i++ {
+		if d.Heartbeat("a", time.Second) {
+			t.Fatalf("heartbeat %d: readmitted before %d heartbeats", i, d.config.UpAfter)
+		}
+	}
+	if len(d.nodes["a"].intervals) != intervals+d.config.UpAfter-2 {
+		t.Errorf("outage gap was counted as a heartbeat interval")
+	}
+	if !d.Heartbeat("a", time.Second) {
+		t.Fatalf("not readmitted after %d heartbeats", d.config.UpAfter)
+	}
+	if up := d.Up(); !slices.Equal(up, []string{"a", "b"}) {
+		t.Errorf("got %v up, want [a b]", up)
+	}
+
+	d.Remove("b")
+	if up := d.Up(); !slices.Equal(up, []string{"a"}) {
+		t.Errorf("got %v up after removing b, want [a]", up)
+	}
+}
+
+func TestRecoveryStartsOver(t *testing.T) {
+	d := New(testConfig())
+	d.Heartbeat("a", time.Second)
+
+	silence(d, "a", 10*time.Second)
+	for i := 0; i < d.config.DownAfter; i++ {
+		d.Check()
+	}
+
+	d.Heartbeat("a", time.Second)
+	silence(d, "a", 10*time.Second)
+	d.Check() // silent again before readmitted
+
+	for i := 1; i < d.config.UpAfter; i++ {
+		if d.Heartbeat("a", time.Second) {
+			t.Fatalf("heartbeat %d: readmitted counting heartbeats from before the node went silent again", i)
+		}
+	}
+}
+
+func TestWindowSize(t *testing.T) {
+	config := testConfig()
+	config.WindowSize = 3
+	d := New(config)
+
+	for i := 0; i < 10; i++ {
+		d.Heartbeat("a", time.Second)
+	}
+	if got := len(d.nodes["a"].intervals); got != config.WindowSize {
+		t.Errorf("kept %d intervals, want %d", got, config.WindowSize)
+	}
+}
@@ -0,0 +1,178 @@
+package e2e
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// posts of an end-to-end encrypted group are sealed with a group key only its members hold. Each member publishes a
+// public key, and whoever shares the group key seals a copy of it to every member's public key, so servers and the
+// clients relaying gossip store and forward posts and keys they cannot open
+
+// KeySize is the length of public, private and group keys
+const KeySize = 32
+
+const nonceSize = 24
+
+var (
+	ErrInvalidKey = errors.New("key is not a valid base64 encoded 32 byte key")
+	ErrOpen       = errors.New("ciphertext was not sealed with this key or was tampered with")
+)
+
+// KeyPair is a user's key pair. The private key never leaves the client
+type KeyPair struct {
+	Public  *[KeySize]byte
+	Private *[KeySize]byte
+}
+
+// KeyPair as saved to a key file
+type keyFile struct {
+	Public  string `json:"public"`
+	Private string `json:"private"`
+}
+
+// LoadOrCreateKeyPair() reads the key pair saved at path, or generates one and saves it there. Returns whether the key
+// pair was created
+func LoadOrCreateKeyPair(path string) (*KeyPair, bool, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var file keyFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, false, fmt.Errorf("Error parsing key file %s: %v", path, err)
+		}
+
+		public, err := ParseKey(file.Public)
+		if err != nil {
+			return nil, false, fmt.Errorf("Error parsing key file %s: %v", path, err)
+		}
+		private, err := ParseKey(file.Private)
+		if err != nil {
+			return nil, false, fmt.Errorf("Error parsing key file %s: %v", path, err)
+		}
+
+		return &KeyPair{Public: public, Private: private}, false, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, false, fmt.Errorf("Error reading key file: %v", err)
+	}
+
+	public, private, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error generating key pair: %v", err)
+	}
+
+	data, err = json.Marshal(keyFile{Public: encodeKey(public), Private: encodeKey(private)})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, false, fmt.Errorf("Error creating key directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, false, fmt.Errorf("Error writing key file: %v", err)
+	}
+
+	return &KeyPair{Public: public, Private: private}, true, nil
+}
+
+// PublicKey() returns the public key as it is published to the servers
+func (k *KeyPair) PublicKey() string {
+	return encodeKey(k.Public)
+}
+
+// OpenGroupKey() opens a group key sealed to this key pair's public key by SealGroupKey()
+func (k *KeyPair) OpenGroupKey(sealed string) (*[KeySize]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, ErrOpen
+	}
+
+	opened, ok := box.OpenAnonymous(nil, data, k.Public, k.Private)
+	if !ok || len(opened) != KeySize {
+		return nil, ErrOpen
+	}
+
+	key := new([KeySize]byte)
+	copy(key[:], opened)
+	return key, nil
+}
+
+// ParseKey() decodes a key encoded as base64, or returns ErrInvalidKey
+func ParseKey(encoded string) (*[KeySize]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	key := new([KeySize]byte)
+	copy(key[:], data)
+	return key, nil
+}
+
+// NewGroupKey() generates a random group key
+func NewGroupKey() (*[KeySize]byte, error) {
+	key := new([KeySize]byte)
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		return nil, fmt.Errorf("Error generating group key: %v", err)
+	}
+	return key, nil
+}
+
+// SealGroupKey() seals a group key to a member's public key, so only that member can open it
+func SealGroupKey(key *[KeySize]byte, publicKey string) (string, error) {
+	recipient, err := ParseKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := box.SealAnonymous(nil, key[:], recipient, rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("Error sealing group key: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Encrypt() seals a post body with a group key. The result is base64 so it travels wherever a plaintext body did
+func Encrypt(key *[KeySize]byte, body string) (string, error) {
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return "", fmt.Errorf("Error generating nonce: %v", err)
+	}
+
+	sealed := secretbox.Seal(nonce[:], []byte(body), &nonce, key) // nonce goes first, so Decrypt() can find it
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt() opens a post body sealed by Encrypt(), or returns ErrOpen
+func Decrypt(key *[KeySize]byte, ciphertext string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < nonceSize {
+		return "", ErrOpen
+	}
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], data[:nonceSize])
+
+	body, ok := secretbox.Open(nil, data[nonceSize:], &nonce, key)
+	if !ok {
+		return "", ErrOpen
+	}
+
+	return string(body), nil
+}
+
+// encodeKey() encodes a key as base64
+func encodeKey(key *[KeySize]byte) string {
+	return base64.StdEncoding.EncodeToString(key[:])
+}
@@ -0,0 +1,184 @@
+package e2e
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateKeyPair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "alice.json")
+
+	created, isNew, err := LoadOrCreateKeyPair(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isNew {
+		t.Error("first call did not report creating the key pair")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode is %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded, isNew, err := LoadOrCreateKeyPair(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isNew {
+		t.Error("second call created a new key pair instead of loading the saved one")
+	}
+	if *loaded.Public != *created.Public || *loaded.Private != *created.Private {
+		t.Error("loaded key pair differs from the one saved")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"public": "short", "private": "short"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadOrCreateKeyPair(path); err == nil {
+		t.Error("loaded a key file holding invalid keys")
+	}
+}
+
+func TestGroupKeyRoundTrip(t *testing.T) {
+	alice, _, err := LoadOrCreateKeyPair(filepath.Join(t.TempDir(), "alice.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, _, err := LoadOrCreateKeyPair(filepath.Join(t.TempDir(), "bob.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewGroupKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := SealGroupKey(key, alice.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := alice.OpenGroupKey(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *opened != *key {
+		t.Error("opened group key differs from the one sealed")
+	}
+
+	data, _ := base64.StdEncoding.DecodeString(sealed)
+	data[len(data)-1] ^= 1
+
+	tests := []struct {
+		name   string
+		opener *KeyPair
+		sealed string
+	}{
+		{"sealed to someone else", bob, sealed},
+		{"not base64", alice, "!!!"},
+		{"tampered", alice, base64.StdEncoding.EncodeToString(data)},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.opener.OpenGroupKey(tt.sealed); err != ErrOpen {
+			t.Errorf("%s: got %v, want %v", tt.name, err, ErrOpen)
+		}
+	}
+
+	if _, err := SealGroupKey(key, "not a key"); err != ErrInvalidKey {
+		t.Errorf("sealing to an invalid public key: got %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key, err := NewGroupKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewGroupKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"hello", "", "ünïcödé and a longer body that spans more than one block of the cipher"} {
+		ciphertext, err := Encrypt(key, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != "" && ciphertext == body {
+			t.Errorf("%q was not encrypted", body)
+		}
+
+		got, err := Decrypt(key, ciphertext)
+		if err != nil {
+			t.Errorf("%q: %v", body, err)
+		} else if got != body {
+			t.Errorf("got %q, want %q", got, body)
+		}
+	}
+
+	first, _ := Encrypt(key, "hello")
+	second, _ := Encrypt(key, "hello")
+	if first == second {
+		t.Error("encrypting the same body twice gave the same ciphertext, nonces are reused")
+	}
+
+	data, _ := base64.StdEncoding.DecodeString(first)
+	data[nonceSize] ^= 1
+
+	tests := []struct {
+		name       string
+		key        *[KeySize]byte
+		ciphertext string
+	}{
+		{"other key", other, first},
+		{"tampered", key, base64.StdEncoding.EncodeToString(data)},
+		{"shorter than a nonce", key, base64.StdEncoding.EncodeToString(data[:nonceSize-1])},
+		{"not base64", key, "!!!"},
+		{"plaintext", key, "hello"},
+	}
+
+	for _, tt := range tests {
+		if _, err := Decrypt(tt.key, tt.ciphertext); err != ErrOpen {
+			t.Errorf("%s: got %v, want %v", tt.name, err, ErrOpen)
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key, err := NewGroupKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{"valid", encodeKey(key), false},
+		{"empty", "", true},
+		{"not base64", "!!!", true},
+		{"too short", base64.StdEncoding.EncodeToString(key[:KeySize-1]), true},
+		{"too long", base64.StdEncoding.EncodeToString(append(key[:], 0)), true},
+	}
+
+	for _, tt := range tests {
+		parsed, err := ParseKey(tt.encoded)
+		if tt.wantErr {
+			if err != ErrInvalidKey {
+				t.Errorf("%s: got %v, want %v", tt.name, err, ErrInvalidKey)
+			}
+			continue
+		}
+		if err != nil || *parsed != *key {
+			t.Errorf("%s: got %v, %v, want the key encoded", tt.name, parsed, err)
+		}
+	}
+}
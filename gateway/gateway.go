@@ -0,0 +1,473 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sjsu-pub-sub/certs"
+	"sjsu-pub-sub/config"
+	"sjsu-pub-sub/detector"
+	"sjsu-pub-sub/raft"
+	"sjsu-pub-sub/types"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// server that registered with the gateway
+type registeredNode struct {
+	types.Registration
+	up bool // sending heartbeats, so requests and leader queries may be sent to it
+}
+
+const (
+	rosterPollTimeout = 30 * time.Second // how long a client asking for roster changes is kept waiting if there are none
+	shutdownTimeout   = 5 * time.Second  // how long in-flight HTTP requests may take to finish on shutdown
+)
+
+// Gateway routes client requests to the leader among the servers that registered with it, and tells clients which
+// servers are up
+type Gateway struct {
+	config        config.Gateway
+	registry      map[string]*registeredNode // servers that registered, by node id. Down servers stay until they deregister
+	registryMu    sync.Mutex
+	rosterVersion uint64        // bumped whenever a server comes up, goes down or moves
+	rosterChanged chan struct{} // closed and replaced whenever rosterVersion is bumped, to wake up waiting clients
+	leaderNode    string        // node id of the leader
+	leaderMu      sync.Mutex
+	failures      *detector.Detector // decides which servers are up from their heartbeats
+	tls           *certs.Bundle      // certificates every listener and dial uses, nil for plaintext
+	backend       *http.Client       // forwards client requests to the leader
+}
+
+// New() creates a gateway that knows no servers yet
+func New(cfg config.Gateway) (*Gateway, error) {
+	bundle, err := certs.Load(cfg.TLSFiles())
+	if err != nil {
+		return nil, err
+	}
+
+	detectorConfig := detector.DefaultConfig()
+	detectorConfig.Threshold = cfg.Phi
+	detectorConfig.DownAfter = cfg.DownAfter
+	detectorConfig.UpAfter = cfg.UpAfter
+	detectorConfig.AcceptablePause = time.Duration(cfg.AcceptablePause)
+
+	return &Gateway{
+		config:        cfg,
+		registry:      make(map[string]*registeredNode),
+		rosterVersion: 1,
+		rosterChanged: make(chan struct{}),
+		failures:      detector.New(detectorConfig),
+		tls:           bundle,
+		backend: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: bundle.ClientConfig(certs.RoleServer)}, // only forward to servers
+		},
+	}, nil
+}
+
+// Handler() returns the HTTP API clients send requests to, so it can also be mounted in another server
+func (g *Gateway) Handler() http.Handler {
+	router := mux.NewRouter()
+
+	router.HandleFunc("/servers", g.serversHandler).Methods("GET") // answered by the gateway itself
+
+	router.PathPrefix("/").HandlerFunc(g.handleRequest) // intialize router to route requests to leader
+
+	return router
+}
+
+// Run() receives registrations and heartbeats from servers and serves client requests. It blocks until ctx is
+// cancelled, then stops accepting requests and closes the listeners
+func (g *Gateway) Run(ctx context.Context) error {
+	listener, err := certs.Listen(":"+strconv.Itoa(g.config.GatewayServerPort), g.tls.ServerConfig(certs.RoleServer)) // listen for connections from servers, so no other host can register
+	if err != nil {
+		return fmt.Errorf("Error listening for server connections: %v", err)
+	}
+	defer listener.Close()
+
+	httpServer := &http.Server{Addr: ":" + strconv.Itoa(g.config.GatewayHTTPPort), Handler: g.Handler()}
+	httpListener, err := certs.Listen(httpServer.Addr, g.tls.ServerConfig()) // clients prove who they are with session tokens
+	if err != nil {
+		return fmt.Errorf("Error listening for client requests: %v", err)
+	}
+
+	go g.acceptServers(listener) // receives registrations and heartbeats from servers
+
+	go g.detectCrashedServers(ctx, time.Duration(g.config.CheckInterval)) // detects crashed servers
+
+	fmt.Printf("Gateway server listening on port %d...\n", g.config.GatewayHTTPPort)
+	go httpServer.Serve(httpListener) // start HTTP router
+
+	<-ctx.Done()
+
+	fmt.Println("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	httpServer.Shutdown(shutdownCtx)
+
+	return nil
+}
+
+// discoverLeader() asks all servers that are up who the Raft leader is and remembers the one that claims leadership in
+// the highest term
+func (g *Gateway) discoverLeader() {
+	nodes := g.upNodes()
+
+	query := types.RaftMessage{Type: types.RaftLeaderQuery, From: "gateway"}
+
+	var newLeader string
+	var newTerm uint64
+	for _, node := range nodes {
+		reply, err := raft.Send(node.RaftAddress, g.tls.ClientConfig(certs.RoleServer), query)
+		if err != nil {
+			continue
+		}
+
+		if reply.Leader != "" && reply.Leader == reply.From && reply.Term >= newTerm { // node is leader itself
+			newLeader = node.NodeId
+			newTerm = reply.Term
+		}
+	}
+
+	g.leaderMu.Lock()
+	defer g.leaderMu.Unlock()
+
+	if newLeader != g.leaderNode {
+		if newLeader == "" {
+			fmt.Println("No leader found")
+		} else {
+			fmt.Printf("Discovered leader %s in term %d\n", newLeader, newTerm)
+		}
+	}
+	g.leaderNode = newLeader
+}
+
+// acceptServers() accepts connections from servers registering and sending heartbeats, until the listener is closed
+func (g *Gateway) acceptServers(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) { // shutting down
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error accepting connection from server: %v\n", err)
+			continue
+		}
+		fmt.Println("Received connection:", conn.RemoteAddr().String())
+		go g.handleServerConnection(conn)
+	}
+}
+
+// handleServerConnection() receives registrations and heartbeats from a server on a long-lived connection, and admits
+// the server once the detector considers it up
+func (g *Gateway) handleServerConnection(conn net.Conn) {
+	defer conn.Close()
+
+	session, err := types.AcceptSession(conn, "gateway", nil, types.MaxFrameSize)
+	if err != nil {
+		fmt.Printf("Server %v failed handshake: %v\n", conn.RemoteAddr(), err)
+		return
+	}
+
+	for {
+		env, err := session.Receive()
+		if err != nil { // server closed the connection, the detector notices if heartbeats stop
+			return
+		}
+
+		switch env.Type {
+		case types.MsgRegister:
+			var registration types.Registration
+			if err := env.Decode(&registration); err != nil || registration.NodeId == "" {
+				fmt.Printf("Server %v sent bad registration: %v\n", conn.RemoteAddr(), err)
+				continue
+			}
+			g.registerNode(registration)
+		case types.MsgDeregister:
+			var deregistration types.Deregistration
+			if err := env.Decode(&deregistration); err != nil {
+				fmt.Printf("Server %v sent bad deregistration: %v\n", conn.RemoteAddr(), err)
+				continue
+			}
+			g.deregisterNode(deregistration.NodeId)
+		case types.MsgHeartbeat:
+			var heartbeat types.Heartbeat
+			if err := env.Decode(&heartbeat); err != nil {
+				fmt.Printf("Server %v sent bad heartbeat: %v\n", conn.RemoteAddr(), err)
+				continue
+			}
+
+			if !g.isRegistered(heartbeat.NodeId) { // gateway restarted, server registers again shortly
+				continue
+			}
+			if g.failures.Heartbeat(heartbeat.NodeId, heartbeat.Interval) {
+				g.admitNode(heartbeat.NodeId)
+			}
+		}
+	}
+}
+
+// registerNode() adds a server to the registry, or updates the addresses of a server that restarted. The server is
+// admitted once its heartbeats arrive
+func (g *Gateway) registerNode(registration types.Registration) {
+	g.registryMu.Lock()
+	defer g.registryMu.Unlock()
+
+	node, ok := g.registry[registration.NodeId]
+	if !ok {
+		g.registry[registration.NodeId] = &registeredNode{Registration: registration}
+		fmt.Printf("Server %s registered with HTTP address %s\n", registration.NodeId, registration.HTTPAddress)
+		return
+	}
+
+	if node.HTTPAddress != registration.HTTPAddress || node.RaftAddress != registration.RaftAddress || node.ClientAddress != registration.ClientAddress {
+		fmt.Printf("Server %s moved to HTTP address %s\n", registration.NodeId, registration.HTTPAddress)
+		if node.up {
+			g.bumpRoster()
+		}
+	}
+	node.Registration = registration
+}
+
+// deregisterNode() removes a server that shut down from the registry
+func (g *Gateway) deregisterNode(nodeId string) {
+	g.registryMu.Lock()
+	node, ok := g.registry[nodeId]
+	delete(g.registry, nodeId)
+	if ok && node.up {
+		g.bumpRoster()
+	}
+	g.registryMu.Unlock()
+
+	g.failures.Remove(nodeId)
+
+	if !ok {
+		return
+	}
+	fmt.Println("Server", nodeId, "deregistered. Active nodes:", g.activeNodeIds())
+
+	g.leaderMu.Lock()
+	wasLeader := g.leaderNode == nodeId
+	g.leaderMu.Unlock()
+
+	if wasLeader {
+		g.discoverLeader() // remaining servers elect a new leader
+	}
+}
+
+// isRegistered() checks whether a server has registered
+func (g *Gateway) isRegistered(nodeId string) bool {
+	g.registryMu.Lock()
+	defer g.registryMu.Unlock()
+
+	_, ok := g.registry[nodeId]
+	return ok
+}
+
+// admitNode() marks a registered server that came up as up
+func (g *Gateway) admitNode(nodeId string) {
+	g.registryMu.Lock()
+	node, ok := g.registry[nodeId]
+	if ok && !node.up {
+		node.up = true
+		g.bumpRoster()
+	}
+	g.registryMu.Unlock()
+
+	if !ok {
+		return
+	}
+	fmt.Println("Server", nodeId, "is up. Active nodes:", g.activeNodeIds())
+
+	g.discoverLeader() // new node may already know who the leader is
+}
+
+// removeNode() marks a server that went down as down. It stays registered, and is readmitted if heartbeats resume
+func (g *Gateway) removeNode(nodeId string) {
+	g.registryMu.Lock()
+	if node, ok := g.registry[nodeId]; ok && node.up {
+		node.up = false
+		g.bumpRoster()
+	}
+	g.registryMu.Unlock()
+
+	fmt.Println("Server", nodeId, "went down. Active nodes:", g.activeNodeIds())
+}
+
+// upNodes() returns the registrations of all servers that are up
+func (g *Gateway) upNodes() []types.Registration {
+	g.registryMu.Lock()
+	defer g.registryMu.Unlock()
+
+	return g.upNodesLocked()
+}
+
+// upNodesLocked() returns the registrations of all servers that are up. Caller must hold registryMu
+func (g *Gateway) upNodesLocked() []types.Registration {
+	result := []types.Registration{}
+	for _, node := range g.registry {
+		if node.up {
+			result = append(result, node.Registration)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].NodeId < result[j].NodeId
+	})
+
+	return result
+}
+
+// bumpRoster() tells clients waiting for roster changes that the servers that are up changed. Caller must hold
+// registryMu
+func (g *Gateway) bumpRoster() {
+	g.rosterVersion++
+	close(g.rosterChanged)
+	g.rosterChanged = make(chan struct{})
+}
+
+// serversHandler() returns the servers that are up. A client passing the version of the roster it has is kept
+// waiting until the roster changes, or rosterPollTimeout passes, so it learns of changes as soon as they happen
+func (g *Gateway) serversHandler(w http.ResponseWriter, r *http.Request) {
+	var known uint64
+	if version := r.URL.Query().Get("version"); version != "" {
+		var err error
+		known, err = strconv.ParseUint(version, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid version", http.StatusBadRequest)
+			return
+		}
+	}
+
+	g.registryMu.Lock()
+	version := g.rosterVersion
+	changed := g.rosterChanged
+	g.registryMu.Unlock()
+
+	if known == version { // client is up to date, wait for a change
+		select {
+		case <-changed:
+		case <-time.After(rosterPollTimeout):
+		case <-r.Context().Done(): // client gave up
+			return
+		}
+	}
+
+	g.registryMu.Lock()
+	roster := types.Roster{Version: g.rosterVersion, Servers: g.upNodesLocked()}
+	g.registryMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roster)
+}
+
+// activeNodeIds() returns the node ids of all servers that are up, for logging
+func (g *Gateway) activeNodeIds() []string {
+	ids := []string{}
+	for _, node := range g.upNodes() {
+		ids = append(ids, node.NodeId)
+	}
+	return ids
+}
+
+// detectCrashedServers() removes servers whose heartbeats stopped every checkInterval, and rediscovers the leader every
+// 5 seconds or as soon as a server goes down, until ctx is cancelled
+func (g *Gateway) detectCrashedServers(ctx context.Context, checkInterval time.Duration) {
+	lastDiscovery := time.Now()
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		down := g.failures.Check()
+		for _, nodeId := range down {
+			g.removeNode(nodeId)
+		}
+
+		if len(down) > 0 || time.Since(lastDiscovery) >= 5*time.Second {
+			g.discoverLeader() // servers elect a new leader among themselves if the old one went down
+			lastDiscovery = time.Now()
+		}
+	}
+}
+
+// handleRequest() performs a RR to the leader, which replicates writes to secondary servers before responding
+func (g *Gateway) handleRequest(w http.ResponseWriter, r *http.Request) {
+	service := strings.TrimPrefix(r.URL.EscapedPath(), "/")
+
+	g.leaderMu.Lock()
+	leader := g.leaderNode
+	g.leaderMu.Unlock()
+
+	g.registryMu.Lock()
+	node, ok := g.registry[leader]
+	var leaderAddress string
+	if ok {
+		leaderAddress = node.HTTPAddress
+	}
+	g.registryMu.Unlock()
+
+	if !ok {
+		http.Error(w, "No leader available", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := g.forwardRequestAndListen(leaderAddress, service, w, r); err != nil {
+		go g.discoverLeader() // leader may have gone down since it was discovered
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// forwardRequestAndListen() sends a client request to the leader and copies the leader's response back. Returns an
+// error only if nothing was written to w yet
+func (g *Gateway) forwardRequestAndListen(leaderAddress string, service string, w http.ResponseWriter, r *http.Request) error {
+	backendURL := fmt.Sprintf("%s://%s/%s", g.config.Scheme(), leaderAddress, service)
+	if r.URL.RawQuery != "" {
+		backendURL += "?" + r.URL.RawQuery
+	}
+
+	req, err := http.NewRequest(r.Method, backendURL, r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header = r.Header
+
+	resp, err := g.backend.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to backend server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+
+	// the status is already sent, so a failed copy can only be logged and leaves the client with a cut short body
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		fmt.Printf("Error copying response to %s from backend server: %v\n", service, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sjsu-pub-sub/config"
+	"sjsu-pub-sub/types"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestGateway() creates a gateway accepting servers on a free local port, and returns the address servers connect to
+func newTestGateway(t *testing.T) (*Gateway, string) {
+	t.Helper()
+
+	g, err := New(config.DefaultGateway())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go g.acceptServers(listener)
+
+	return g, listener.Addr().String()
+}
+
+// unreachable() returns an address nobody listens on, so the gateway's leader queries fail at once
+func unreachable(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+// connect() registers a server with the gateway and sends its first heartbeat, which brings it up. Returns the session
+// the server sends on
+func connect(t *testing.T, address string, nodeId string) *types.Session {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	session, err := types.StartSession(conn, nodeId, nil, types.MaxFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registration := types.Registration{NodeId: nodeId, HTTPAddress: nodeId + ":8080", ClientAddress: nodeId + ":8081", RaftAddress: unreachable(t)}
+	if _, err := session.Send(types.MsgRegister, registration); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Send(types.MsgHeartbeat, types.Heartbeat{NodeId: nodeId, Seq: 1, Interval: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+// poll() asks the gateway for its roster, passing the version the client has. The answer arrives on the channel
+func poll(h http.Handler, version string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/servers?version="+version, nil))
+		done <- w
+	}()
+	return done
+}
+
+// roster() waits for a poll's answer and decodes it
+func roster(t *testing.T, answer <-chan *httptest.ResponseRecorder) types.Roster {
+	t.Helper()
+
+	var w *httptest.ResponseRecorder
+	select {
+	case w = <-answer:
+	case <-time.After(5 * time.Second):
+		t.Fatal("roster was not answered")
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+
+	var result types.Roster
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// nodeIds() returns the node ids of the servers in a roster
+func nodeIds(r types.Roster) []string {
+	ids := []string{}
+	for _, server := range r.Servers {
+		ids = append(ids, server.NodeId)
+	}
+	return ids
+}
+
+func TestRosterAfterDeregistration(t *testing.T) {
+	g, address := newTestGateway(t)
+	h := g.Handler()
+
+	first := connect(t, address, "alpha")
+	connect(t, address, "beta")
+
+	current := roster(t, poll(h, "0"))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(current.Servers) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got servers %v, want alpha and beta up", nodeIds(current))
+		}
+		time.Sleep(10 * time.Millisecond)
+		current = roster(t, poll(h, "0"))
+	}
+
+	if _, err := first.Send(types.MsgDeregister, types.Deregistration{NodeId: "alpha"}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for g.isRegistered("alpha") {
+		if time.Now().After(deadline) {
+			t.Fatal("deregistered server is still registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	changed := roster(t, poll(h, "0"))
+	if ids := nodeIds(changed); len(ids) != 1 || ids[0] != "beta" || changed.Version <= current.Version {
+		t.Errorf("got servers %v at version %d, want only beta after version %d", ids, changed.Version, current.Version)
+	}
+	if !g.isRegistered("beta") {
+		t.Error("server still up was deregistered too")
+	}
+}
+
+func TestServersLongPoll(t *testing.T) {
+	g, address := newTestGateway(t)
+	h := g.Handler()
+
+	current := roster(t, poll(h, "0")) // client without a roster is answered at once
+	if len(current.Servers) != 0 {
+		t.Fatalf("got servers %v before any registered", nodeIds(current))
+	}
+
+	waiting := poll(h, strconv.FormatUint(current.Version, 10))
+	select {
+	case <-waiting:
+		t.Fatal("client up to date was answered before the roster changed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	connect(t, address, "alpha")
+	changed := roster(t, waiting)
+	if ids := nodeIds(changed); len(ids) != 1 || ids[0] != "alpha" || changed.Version <= current.Version {
+		t.Errorf("got servers %v at version %d, want alpha after version %d", ids, changed.Version, current.Version)
+	}
+
+	stale := roster(t, poll(h, strconv.FormatUint(current.Version, 10)))
+	if stale.Version != changed.Version {
+		t.Errorf("client with an old roster got version %d, want %d at once", stale.Version, changed.Version)
+	}
+
+	g.removeNode("alpha")
+	if down := roster(t, poll(h, strconv.FormatUint(changed.Version, 10))); len(down.Servers) != 0 {
+		t.Errorf("got servers %v after alpha went down, want none", nodeIds(down))
+	}
+
+	if w := <-poll(h, "latest"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid version: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,517 @@
+package gossip
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"sjsu-pub-sub/pool"
+	"sjsu-pub-sub/types"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// bytes of posts sent in one digest, so it stays well within types.MaxFrameSize with the ids and piggybacked updates
+const maxDigestSize = types.MaxFrameSize / 2
+
+// Config tunes how far and how fast posts spread
+type Config struct {
+	Fanout              int           // peers a post is pushed to per round
+	TTL                 int           // hops a post travels from the server before it is no longer forwarded
+	Rounds              int           // rounds a client pushes a new post for, each to Fanout peers it has not pushed to yet
+	RoundInterval       time.Duration // time between rounds
+	AntiEntropyInterval time.Duration // time between digest exchanges with a random peer, 0 to disable
+	Retention           int           // posts per group kept to answer digests
+}
+
+// DefaultConfig() returns settings that spread posts to groups of a few dozen clients within a couple of seconds
+func DefaultConfig() Config {
+	return Config{
+		Fanout:              4,
+		TTL:                 6,
+		Rounds:              1,
+		RoundInterval:       time.Second,
+		AntiEntropyInterval: 10 * time.Second,
+		Retention:           100,
+	}
+}
+
+// Stats counts what an Engine has sent and received
+type Stats struct {
+	Published   uint64 // posts this node started gossiping
+	Received    uint64 // posts received by push gossip, including duplicates
+	Delivered   uint64 // distinct posts delivered, by push gossip or anti-entropy
+	Duplicates  uint64 // posts received by push gossip that were already delivered
+	Forwarded   uint64 // posts sent to peers by push gossip
+	Expired     uint64 // new posts not forwarded because their TTL ran out
+	Recovered   uint64 // distinct posts delivered only through anti-entropy
+	DigestsSent uint64 // digest exchanges started
+	Rejected    uint64 // posts dropped as their signature did not verify, by push gossip or anti-entropy
+}
+
+// Coverage() returns the share of delivered posts that push gossip alone delivered. Well below 1 means Fanout, TTL or
+// Rounds are too low for the group size, and anti-entropy is making up the difference
+func (s Stats) Coverage() float64 {
+	if s.Delivered == 0 {
+		return 1
+	}
+	return float64(s.Delivered-s.Recovered) / float64(s.Delivered)
+}
+
+// Membership tells an Engine which peers are alive. Its updates are piggybacked on gossip and digests
+type Membership interface {
+	Alive(address string) bool          // false once a peer is declared dead
+	Learn(addresses []string)           // adds peers heard of from a post
+	Updates() []types.MemberUpdate      // changes to piggyback on an outgoing message
+	Apply(updates []types.MemberUpdate) // merges changes piggybacked on an incoming message
+}
+
+// Engine spreads posts to groupmates by push gossip, and recovers posts that push gossip missed by periodically
+// exchanging digests with a random groupmate (push-pull anti-entropy)
+type Engine struct {
+	mu      sync.Mutex
+	config  Config
+	pool    *pool.Pool
+	port    string                              // port this node receives gossip on, empty if it does not receive gossip
+	deliver func(msg types.GossipMessage)       // called once for every distinct post received
+	seen    map[uint64]bool                     // ids of the posts kept in recent, forgotten along with them
+	recent  map[string][]types.GossipMessage    // last Retention posts of each group, oldest first
+	peers   map[string]map[string]bool          // addresses of known groupmates of each group
+	members Membership                          // which peers are alive, nil to treat every peer as alive
+	verify  func(msg types.GossipMessage) error // checks a received post is authentic, nil to accept every post
+	stats   Stats
+}
+
+// New() creates an engine sending through pool. port is where this node receives gossip, and deliver is called once
+// for every distinct post it receives. Servers only publish, so they pass an empty port and nil deliver
+func New(config Config, pool *pool.Pool, port string, deliver func(msg types.GossipMessage)) *Engine {
+	return &Engine{
+		config:  config,
+		pool:    pool,
+		port:    port,
+		deliver: deliver,
+		seen:    make(map[uint64]bool),
+		recent:  make(map[string][]types.GossipMessage),
+		peers:   make(map[string]map[string]bool),
+	}
+}
+
+// UseMembership() makes the engine skip peers members declares dead, and piggyback members' updates on its messages.
+// Must be called before the engine sends or receives anything
+func (e *Engine) UseMembership(members Membership) {
+	e.members = members
+}
+
+// UseVerifier() makes the engine check every post it receives with verify before delivering, remembering or forwarding
+// it, and drop and report posts verify rejects. A forged post therefore cannot take the id of a real one, so the real
+// one is not dropped as a duplicate. Must be called before the engine receives anything
+func (e *Engine) UseVerifier(verify func(msg types.GossipMessage) error) {
+	e.verify = verify
+}
+
+// Peers() returns the known groupmates of a group that are not dead, sorted by address
+func (e *Engine) Peers(group string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result := []string{}
+	for peer := range e.peers[group] {
+		if e.alive(peer) {
+			result = append(result, peer)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Stats() returns a copy of the engine's counters
+func (e *Engine) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+// Publish() starts gossiping a post to the given groupmates
+func (e *Engine) Publish(msg types.GossipMessage, peers []string) {
+	msg.TTL = e.config.TTL
+	msg.ConnsToWrite = peers
+
+	e.mu.Lock()
+	e.stats.Published++
+	e.mu.Unlock()
+
+	e.spread(msg)
+}
+
+// Handle() processes a gossip or digest message received from the peer at remoteAddr. Other messages are ignored
+func (e *Engine) Handle(env types.Envelope, remoteAddr net.Addr) error {
+	switch env.Type {
+	case types.MsgGossip:
+		var msg types.GossipMessage
+		if err := env.Decode(&msg); err != nil {
+			return err
+		}
+		e.apply(msg.Members)
+		e.receive(msg, remoteAddr)
+	case types.MsgDigest, types.MsgDigestAck:
+		var digest types.GossipDigest
+		if err := env.Decode(&digest); err != nil {
+			return err
+		}
+		e.apply(digest.Members)
+		return e.receiveDigest(env.Type, digest, remoteAddr)
+	}
+
+	return nil
+}
+
+// Run() exchanges a digest with a random groupmate every AntiEntropyInterval, forever
+func (e *Engine) Run() {
+	if e.config.AntiEntropyInterval <= 0 {
+		return
+	}
+
+	for {
+		time.Sleep(e.config.AntiEntropyInterval)
+
+		e.mu.Lock()
+		group, peer, ok := e.randomPeer()
+		digest := types.GossipDigest{
+			Group: group,
+			Port:  e.port,
+			Ids:   e.recentIds(group),
+		}
+		if ok {
+			e.stats.DigestsSent++
+		}
+		e.mu.Unlock()
+
+		if !ok { // no live groupmates known yet
+			continue
+		}
+
+		digest.Members = e.updates()
+
+		if err := e.pool.Send(peer, types.MsgDigest, digest); err != nil {
+			e.forgetPeer(group, peer)
+		}
+	}
+}
+
+// receive() delivers a post received by push gossip from the peer at remoteAddr and keeps spreading it, unless it was
+// seen before or is not authentic
+func (e *Engine) receive(msg types.GossipMessage, remoteAddr net.Addr) {
+	if !e.authentic(msg, remoteAddr) {
+		return
+	}
+
+	e.mu.Lock()
+	e.stats.Received++
+	if e.seen[msg.Id] {
+		e.stats.Duplicates++
+		e.mu.Unlock()
+		return
+	}
+	e.remember(msg)
+	e.learnPeers(msg.Group, vouched(msg))
+	e.mu.Unlock()
+
+	if e.deliver != nil {
+		e.deliver(msg)
+	}
+
+	ttl := msg.TTL
+	if ttl == 0 { // sent by a server that does not set a TTL
+		ttl = e.config.TTL
+	}
+	if ttl <= 1 {
+		e.mu.Lock()
+		e.stats.Expired++
+		e.mu.Unlock()
+		return
+	}
+
+	msg.TTL = ttl - 1
+	go e.spread(msg)
+}
+
+// spread() pushes a post to Fanout random peers from msg.ConnsToWrite per round, for Rounds rounds. Every peer is
+// sent the list without itself, so it never gossips the post to itself
+func (e *Engine) spread(msg types.GossipMessage) {
+	e.mu.Lock()
+	candidates := []string{}
+	for _, peer := range msg.ConnsToWrite {
+		if e.alive(peer) { // dialing a dead peer only wastes a share of the fanout
+			candidates = append(candidates, peer)
+		}
+	}
+	e.mu.Unlock()
+
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	for round := 0; round < max(e.config.Rounds, 1) && len(candidates) > 0; round++ {
+		if round > 0 {
+			time.Sleep(e.config.RoundInterval)
+		}
+
+		count := min(e.config.Fanout, len(candidates))
+		targets := candidates[:count]
+		candidates = candidates[count:]
+
+		for _, target := range targets {
+			forward := msg
+			forward.ConnsToWrite = without(msg.ConnsToWrite, target)
+			forward.Members = e.updates()
+
+			if err := e.pool.Send(target, types.MsgGossip, forward); err != nil {
+				fmt.Printf("Error gossiping to %s: %v\n", target, err)
+				e.forgetPeer(msg.Group, target)
+				continue
+			}
+
+			e.mu.Lock()
+			e.stats.Forwarded++
+			e.mu.Unlock()
+		}
+	}
+}
+
+// receiveDigest() answers a digest with the posts the sender lacks. A digest answering our own digest is answered
+// once more with the posts the other side lacks, which ends the exchange. Digests are only answered for groupmates
+// learned from the server's signed groupmates of a post, so nobody else can pull a group's posts or become a peer
+func (e *Engine) receiveDigest(msgType string, digest types.GossipDigest, remoteAddr net.Addr) error {
+	host, _, err := net.SplitHostPort(remoteAddr.String())
+	if err != nil {
+		return err
+	}
+	peer := host + digest.Port // digest.Port is ":port" like the listen address
+
+	e.mu.Lock()
+	known := e.peers[digest.Group][peer]
+	e.mu.Unlock()
+	if !known {
+		return fmt.Errorf("ignored digest of group %s from %s, not a known groupmate", digest.Group, peer)
+	}
+
+	authentic := []types.GossipMessage{}
+	for _, msg := range digest.Messages {
+		if e.authentic(msg, remoteAddr) {
+			authentic = append(authentic, msg)
+		}
+	}
+
+	e.mu.Lock()
+	recovered := []types.GossipMessage{}
+	for _, msg := range authentic {
+		if !e.seen[msg.Id] && !e.forgotten(msg) {
+			e.remember(msg)
+			e.stats.Recovered++
+			recovered = append(recovered, msg)
+		}
+	}
+
+	reply := types.GossipDigest{
+		Group:    digest.Group,
+		Port:     e.port,
+		Ids:      e.recentIds(digest.Group),
+		Messages: e.missing(digest.Group, digest.Ids),
+		Final:    msgType == types.MsgDigestAck,
+	}
+	e.mu.Unlock()
+
+	reply.Members = e.updates()
+
+	if e.deliver != nil {
+		for _, msg := range recovered { // recovered posts are not forwarded, the other side's digests catch them up
+			e.deliver(msg)
+		}
+	}
+
+	if digest.Final || (reply.Final && len(reply.Messages) == 0) { // nothing left to send
+		return nil
+	}
+
+	if err := e.pool.Send(peer, types.MsgDigestAck, reply); err != nil {
+		e.forgetPeer(digest.Group, peer)
+		return err
+	}
+
+	return nil
+}
+
+// authentic() checks a post received from the peer at remoteAddr with the verifier, and reports and counts it if it is
+// rejected
+func (e *Engine) authentic(msg types.GossipMessage, remoteAddr net.Addr) bool {
+	if e.verify == nil {
+		return true
+	}
+
+	err := e.verify(msg)
+	if err == nil {
+		return true
+	}
+
+	fmt.Printf("Dropped post %d of group %s from %s: %v\n", msg.Id, msg.Group, remoteAddr, err)
+
+	e.mu.Lock()
+	e.stats.Rejected++
+	e.mu.Unlock()
+
+	return false
+}
+
+// remember() marks a post delivered and keeps it to answer digests. Posts pushed out of the kept ones are no longer
+// marked delivered, so seen does not grow with every post ever received: by then, push gossip of a post has long
+// stopped. Caller must hold lock
+func (e *Engine) remember(msg types.GossipMessage) {
+	e.seen[msg.Id] = true
+	e.stats.Delivered++
+
+	msg.ConnsToWrite = nil // peers are tracked separately
+	posts := append(e.recent[msg.Group], msg)
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Id < posts[j].Id
+	})
+	if len(posts) > e.config.Retention {
+		for _, old := range posts[:len(posts)-e.config.Retention] {
+			delete(e.seen, old.Id)
+		}
+		posts = posts[len(posts)-e.config.Retention:]
+	}
+	e.recent[msg.Group] = posts
+}
+
+// forgotten() reports whether a post is older than every post kept of its group once Retention posts are kept, so it
+// may have been delivered and forgotten since. Digests of groupmates keeping older posts would otherwise deliver it
+// again. Caller must hold lock
+func (e *Engine) forgotten(msg types.GossipMessage) bool {
+	posts := e.recent[msg.Group]
+	return len(posts) > 0 && len(posts) >= e.config.Retention && msg.Id < posts[0].Id
+}
+
+// recentIds() returns the ids of the posts of a group kept to answer digests. Caller must hold lock
+func (e *Engine) recentIds(group string) []uint64 {
+	ids := []uint64{}
+	for _, msg := range e.recent[group] {
+		ids = append(ids, msg.Id)
+	}
+	return ids
+}
+
+// missing() returns the kept posts of a group whose id is not in ids, oldest first and no more than fit in a digest.
+// Caller must hold lock
+func (e *Engine) missing(group string, ids []uint64) []types.GossipMessage {
+	has := make(map[uint64]bool, len(ids))
+	for _, id := range ids {
+		has[id] = true
+	}
+
+	result := []types.GossipMessage{}
+	size := 0
+	for _, msg := range e.recent[group] {
+		if has[msg.Id] {
+			continue
+		}
+
+		data, err := json.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		size += len(data)
+		if size > maxDigestSize { // the rest is sent in a later exchange
+			break
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+// learnPeers() adds groupmates to exchange digests with. Caller must hold lock
+func (e *Engine) learnPeers(group string, peers []string) {
+	if group == "" {
+		return
+	}
+	if e.peers[group] == nil {
+		e.peers[group] = make(map[string]bool)
+	}
+	for _, peer := range peers {
+		e.peers[group][peer] = true
+	}
+	if e.members != nil {
+		e.members.Learn(peers)
+	}
+}
+
+// vouched() returns the peers a post may be gossiped on to that the server listed among the groupmates it signed, so
+// a relaying client cannot make others exchange digests with addresses of its choosing. Self is never among them
+func vouched(msg types.GossipMessage) []string {
+	result := []string{}
+	for _, peer := range msg.ConnsToWrite {
+		if slices.Contains(msg.GroupMates, peer) {
+			result = append(result, peer)
+		}
+	}
+	return result
+}
+
+// forgetPeer() stops exchanging digests with a groupmate that could not be reached
+func (e *Engine) forgetPeer(group string, peer string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.peers[group], peer)
+}
+
+// randomPeer() picks a random known groupmate of a random group. Caller must hold lock
+func (e *Engine) randomPeer() (string, string, bool) {
+	candidates := [][2]string{}
+	for group, peers := range e.peers {
+		for peer := range peers {
+			if e.alive(peer) {
+				candidates = append(candidates, [2]string{group, peer})
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", "", false
+	}
+
+	pick := candidates[rand.Intn(len(candidates))]
+	return pick[0], pick[1], true
+}
+
+// alive() checks whether a peer may be sent to
+func (e *Engine) alive(peer string) bool {
+	return e.members == nil || e.members.Alive(peer)
+}
+
+// updates() returns the membership changes to piggyback on an outgoing message
+func (e *Engine) updates() []types.MemberUpdate {
+	if e.members == nil {
+		return nil
+	}
+	return e.members.Updates()
+}
+
+// apply() merges membership changes piggybacked on an incoming message
+func (e *Engine) apply(updates []types.MemberUpdate) {
+	if e.members != nil && len(updates) > 0 {
+		e.members.Apply(updates)
+	}
+}
+
+// without() returns list without any occurrence of value
+func without(list []string, value string) []string {
+	result := []string{}
+	for _, elem := range list {
+		if elem != value {
+			result = append(result, elem)
+		}
+	}
+	return result
+}
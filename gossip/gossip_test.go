@@ -0,0 +1,290 @@
+package gossip
+
+import (
+	"encoding/json"
+	"net"
+	"sjsu-pub-sub/pool"
+	"sjsu-pub-sub/types"
+	"slices"
+	"testing"
+	"time"
+)
+
+// peer is a client listening for gossip, recording every message it receives
+type peer struct {
+	address  string
+	received chan types.Envelope
+}
+
+// newPeer() starts a peer on a free local port
+func newPeer(t *testing.T) *peer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	p := &peer{address: listener.Addr().String(), received: make(chan types.Envelope, 100)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				session, err := types.AcceptSession(conn, "peer", nil, types.MaxFrameSize)
+				if err != nil {
+					return
+				}
+				for {
+					env, err := session.Receive()
+					if err != nil {
+						return
+					}
+					p.received <- env
+				}
+			}()
+		}
+	}()
+	return p
+}
+
+// port() returns the peer's port as a digest announces it
+func (p *peer) port() string {
+	_, port, _ := net.SplitHostPort(p.address)
+	return ":" + port
+}
+
+// next() returns the next message the peer received, or false if none arrives within timeout
+func (p *peer) next(timeout time.Duration) (types.Envelope, bool) {
+	select {
+	case env := <-p.received:
+		return env, true
+	case <-time.After(timeout):
+		return types.Envelope{}, false
+	}
+}
+
+// remote() returns the address messages from a local peer come from. Only the host has to match the one it listens on
+func remote() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+}
+
+// newEngine() creates an engine receiving gossip on port, sending through a pool closed when the test ends
+func newEngine(t *testing.T, config Config, port string, deliver func(msg types.GossipMessage)) *Engine {
+	t.Helper()
+
+	p := pool.New("test", nil, pool.DefaultIdleTTL, nil)
+	t.Cleanup(p.Close)
+	return New(config, p, port, deliver)
+}
+
+// envelope() wraps a payload as it arrives from a peer
+func envelope(t *testing.T, msgType string, payload interface{}) types.Envelope {
+	t.Helper()
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.Envelope{Type: msgType, Version: types.ProtocolVersion, Payload: data}
+}
+
+func TestDigestFromStranger(t *testing.T) {
+	e := newEngine(t, DefaultConfig(), ":9999", nil)
+	groupmate := newPeer(t)
+	stranger := newPeer(t)
+
+	post := types.GossipMessage{
+		Id:           types.PostId(1),
+		Group:        "books",
+		Body:         "hello",
+		GroupMates:   []string{groupmate.address},
+		ConnsToWrite: []string{groupmate.address, stranger.address}, // stranger added by a relaying client
+		TTL:          1,                                             // not forwarded
+	}
+	if err := e.Handle(envelope(t, types.MsgGossip, post), remote()); err != nil {
+		t.Fatal(err)
+	}
+	if peers := e.Peers("books"); !slices.Equal(peers, []string{groupmate.address}) {
+		t.Fatalf("got peers %v, want only the groupmate the server signed", peers)
+	}
+
+	digest := types.GossipDigest{Group: "books", Port: stranger.port(), Ids: []uint64{}}
+	if err := e.Handle(envelope(t, types.MsgDigest, digest), remote()); err == nil {
+		t.Error("answered a digest from a peer that is not a known groupmate")
+	}
+	if env, ok := stranger.next(200 * time.Millisecond); ok {
+		t.Errorf("stranger was sent a %s", env.Type)
+	}
+	if peers := e.Peers("books"); !slices.Equal(peers, []string{groupmate.address}) {
+		t.Errorf("got peers %v after the stranger's digest, want it not learned", peers)
+	}
+
+	digest.Port = groupmate.port()
+	if err := e.Handle(envelope(t, types.MsgDigest, digest), remote()); err != nil {
+		t.Fatal(err)
+	}
+	env, ok := groupmate.next(2 * time.Second)
+	if !ok {
+		t.Fatal("groupmate's digest was not answered")
+	}
+	var reply types.GossipDigest
+	if err := env.Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if env.Type != types.MsgDigestAck || len(reply.Messages) != 1 || reply.Messages[0].Id != post.Id {
+		t.Errorf("got %s with %d posts, want %s with the post the groupmate lacks", env.Type, len(reply.Messages), types.MsgDigestAck)
+	}
+}
+
+func TestSeenForgottenWithRetention(t *testing.T) {
+	config := DefaultConfig()
+	config.Retention = 2
+	delivered := make(chan uint64, 10)
+	e := newEngine(t, config, ":9999", func(msg types.GossipMessage) { delivered <- msg.Id })
+	groupmate := newPeer(t)
+
+	post := func(index uint64) types.GossipMessage {
+		return types.GossipMessage{Id: types.PostId(index), Group: "books", Body: "hello", GroupMates: []string{groupmate.address}, ConnsToWrite: []string{groupmate.address}, TTL: 1}
+	}
+	for _, index := range []uint64{1, 2, 3, 3} {
+		if err := e.Handle(envelope(t, types.MsgGossip, post(index)), remote()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e.mu.Lock()
+	seen := len(e.seen)
+	e.mu.Unlock()
+	if seen != config.Retention {
+		t.Errorf("%d posts marked seen, want only the %d kept", seen, config.Retention)
+	}
+
+	digest := types.GossipDigest{Group: "books", Port: groupmate.port(), Ids: []uint64{}, Messages: []types.GossipMessage{post(1)}, Final: true}
+	if err := e.Handle(envelope(t, types.MsgDigestAck, digest), remote()); err != nil {
+		t.Fatal(err)
+	}
+
+	close(delivered)
+	got := []uint64{}
+	for id := range delivered {
+		got = append(got, id)
+	}
+	if want := []uint64{types.PostId(1), types.PostId(2), types.PostId(3)}; !slices.Equal(got, want) {
+		t.Errorf("delivered %v, want %v once each", got, want)
+	}
+}
+
+func TestTTLAndDuplicates(t *testing.T) {
+	delivered := make(chan uint64, 10)
+	e := newEngine(t, DefaultConfig(), ":9999", func(msg types.GossipMessage) { delivered <- msg.Id })
+	first := newPeer(t)
+	second := newPeer(t)
+
+	post := types.GossipMessage{
+		Id:           types.PostId(1),
+		Group:        "books",
+		Body:         "hello",
+		GroupMates:   []string{first.address, second.address},
+		ConnsToWrite: []string{first.address, second.address},
+		TTL:          2,
+	}
+	for i := 0; i < 2; i++ { // second copy arrives from another groupmate
+		if err := e.Handle(envelope(t, types.MsgGossip, post), remote()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, p := range []*peer{first, second} {
+		env, ok := p.next(2 * time.Second)
+		if !ok {
+			t.Fatalf("post was not forwarded to %s", p.address)
+		}
+		var forwarded types.GossipMessage
+		if err := env.Decode(&forwarded); err != nil {
+			t.Fatal(err)
+		}
+		if forwarded.TTL != 1 || slices.Contains(forwarded.ConnsToWrite, p.address) {
+			t.Errorf("%s got TTL %d to write to %v, want TTL 1 without itself", p.address, forwarded.TTL, forwarded.ConnsToWrite)
+		}
+		if env, ok := p.next(200 * time.Millisecond); ok {
+			t.Errorf("%s was sent a %s again, duplicates must not be forwarded", p.address, env.Type)
+		}
+	}
+
+	last := post
+	last.Id = types.PostId(2)
+	last.TTL = 1
+	if err := e.Handle(envelope(t, types.MsgGossip, last), remote()); err != nil {
+		t.Fatal(err)
+	}
+	if env, ok := first.next(200 * time.Millisecond); ok {
+		t.Errorf("post whose TTL ran out was forwarded as a %s", env.Type)
+	}
+
+	if len(delivered) != 2 {
+		t.Errorf("delivered %d posts, want each of the 2 once", len(delivered))
+	}
+	stats := e.Stats()
+	if stats.Received != 3 || stats.Duplicates != 1 || stats.Forwarded != 2 || stats.Expired != 1 {
+		t.Errorf("got %+v, want 3 received, 1 duplicate, 2 forwarded and 1 expired", stats)
+	}
+}
+
+func TestDigestRepair(t *testing.T) {
+	delivered := make(chan uint64, 10)
+	e := newEngine(t, DefaultConfig(), ":9999", func(msg types.GossipMessage) { delivered <- msg.Id })
+	groupmate := newPeer(t)
+
+	post := func(index uint64) types.GossipMessage {
+		return types.GossipMessage{Id: types.PostId(index), Group: "books", Body: "hello", GroupMates: []string{groupmate.address}, ConnsToWrite: []string{groupmate.address}, TTL: 1}
+	}
+	for _, index := range []uint64{1, 2} {
+		if err := e.Handle(envelope(t, types.MsgGossip, post(index)), remote()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// groupmate has posts 1 and 3, and starts an exchange
+	digest := types.GossipDigest{Group: "books", Port: groupmate.port(), Ids: []uint64{types.PostId(1), types.PostId(3)}}
+	if err := e.Handle(envelope(t, types.MsgDigest, digest), remote()); err != nil {
+		t.Fatal(err)
+	}
+	env, ok := groupmate.next(2 * time.Second)
+	if !ok {
+		t.Fatal("digest was not answered")
+	}
+	var reply types.GossipDigest
+	if err := env.Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Messages) != 1 || reply.Messages[0].Id != types.PostId(2) || !slices.Equal(reply.Ids, []uint64{types.PostId(1), types.PostId(2)}) {
+		t.Fatalf("got %d posts and ids %v, want post 2 the groupmate lacks and the ids kept", len(reply.Messages), reply.Ids)
+	}
+
+	missed := post(3)
+	missed.ConnsToWrite = nil
+	final := types.GossipDigest{Group: "books", Port: groupmate.port(), Messages: []types.GossipMessage{missed}, Final: true}
+	if err := e.Handle(envelope(t, types.MsgDigestAck, final), remote()); err != nil {
+		t.Fatal(err)
+	}
+	if env, ok := groupmate.next(200 * time.Millisecond); ok {
+		t.Errorf("final digest was answered with a %s", env.Type)
+	}
+
+	close(delivered)
+	got := []uint64{}
+	for id := range delivered {
+		got = append(got, id)
+	}
+	if want := []uint64{types.PostId(1), types.PostId(2), types.PostId(3)}; !slices.Equal(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+	if stats := e.Stats(); stats.Recovered != 1 {
+		t.Errorf("%d posts recovered by anti-entropy, want 1", stats.Recovered)
+	}
+}
@@ -0,0 +1,427 @@
+package membership
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sjsu-pub-sub/pool"
+	"sjsu-pub-sub/types"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config tunes how fast failed clients are detected
+type Config struct {
+	ProtocolPeriod   time.Duration // time between probes of a random member
+	PingTimeout      time.Duration // time to wait for a direct ack before asking others to probe
+	IndirectChecks   int           // members asked to probe a member that did not answer directly
+	SuspicionPeriods int           // protocol periods a suspected member has to refute before it is declared dead
+	RetransmitMult   int           // each update is piggybacked RetransmitMult * log2(members) times
+	MaxPiggyback     int           // most updates piggybacked on a single message
+	DeadRetention    time.Duration // how long a dead member is remembered, so stale lists do not bring it back
+}
+
+// DefaultConfig() returns settings that detect a failed client within about 10 seconds
+func DefaultConfig() Config {
+	return Config{
+		ProtocolPeriod:   time.Second,
+		PingTimeout:      300 * time.Millisecond,
+		IndirectChecks:   3,
+		SuspicionPeriods: 5,
+		RetransmitMult:   3,
+		MaxPiggyback:     6,
+		DeadRetention:    time.Minute,
+	}
+}
+
+// another client, as this client sees it
+type member struct {
+	state       string
+	incarnation uint64
+	changed     time.Time // when state last changed
+}
+
+// membership update waiting to be piggybacked
+type queuedUpdate struct {
+	update    types.MemberUpdate
+	transmits int // times left to piggyback it
+}
+
+// List is a client's view of which other clients are alive, kept up to date with the SWIM protocol: every protocol
+// period a random member is pinged directly, then indirectly through others, and suspected if neither answers.
+// Suspected members that do not refute in time are declared dead. Changes spread by piggybacking on other messages
+type List struct {
+	mu          sync.Mutex
+	config      Config
+	pool        *pool.Pool
+	port        string // port this client receives gossip on
+	self        string // this client's address as others see it, empty until another client pings it
+	incarnation uint64
+	members     map[string]*member
+	probeOrder  []string // members left to probe this round, in random order
+	seq         uint64
+	acks        map[uint64]func() // called when the ack with the given seq arrives
+	updates     []*queuedUpdate
+}
+
+// New() creates an empty membership list sending through pool. port is where this client receives gossip
+func New(config Config, pool *pool.Pool, port string) *List {
+	return &List{
+		config:  config,
+		pool:    pool,
+		port:    port,
+		members: make(map[string]*member),
+		acks:    make(map[uint64]func()),
+	}
+}
+
+// Learn() adds clients this client has heard of, e.g. from a post's groupmates, as alive. Clients already known keep
+// their state, so a dead client is not dialed again just because a stale list still names it
+func (l *List) Learn(addresses []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, address := range addresses {
+		if address == l.self {
+			continue
+		}
+		if _, ok := l.members[address]; !ok {
+			l.members[address] = &member{state: types.MemberAlive, changed: time.Now()}
+		}
+	}
+}
+
+// Alive() checks whether a client may be gossiped to. Unknown and suspected clients may be, dead ones may not
+func (l *List) Alive(address string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m, ok := l.members[address]
+	return !ok || m.state != types.MemberDead
+}
+
+// Members() returns the address and state of every known client, sorted by address
+func (l *List) Members() []types.MemberUpdate {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := []types.MemberUpdate{}
+	for address, m := range l.members {
+		result = append(result, types.MemberUpdate{Address: address, State: m.state, Incarnation: m.incarnation})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Address < result[j].Address
+	})
+
+	return result
+}
+
+// Updates() returns the membership changes to piggyback on an outgoing message
+func (l *List) Updates() []types.MemberUpdate {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sort.SliceStable(l.updates, func(i, j int) bool { // least spread updates first
+		return l.updates[i].transmits > l.updates[j].transmits
+	})
+
+	result := []types.MemberUpdate{}
+	remaining := []*queuedUpdate{}
+	for _, queued := range l.updates {
+		if len(result) < l.config.MaxPiggyback {
+			result = append(result, queued.update)
+			queued.transmits--
+		}
+		if queued.transmits > 0 {
+			remaining = append(remaining, queued)
+		}
+	}
+	l.updates = remaining
+
+	return result
+}
+
+// Apply() merges membership changes piggybacked on an incoming message
+func (l *List) Apply(updates []types.MemberUpdate) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, update := range updates {
+		l.apply(update)
+	}
+}
+
+// Handle() answers a SWIM probe received from the client at remoteAddr. Other messages are ignored
+func (l *List) Handle(env types.Envelope, remoteAddr net.Addr) error {
+	switch env.Type {
+	case types.MsgSwimPing, types.MsgSwimPingReq, types.MsgSwimAck:
+	default:
+		return nil
+	}
+
+	var msg types.SwimMessage
+	if err := env.Decode(&msg); err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr.String())
+	if err != nil {
+		return err
+	}
+	sender := host + msg.Port // msg.Port is ":port" like the listen address
+
+	l.mu.Lock()
+	l.apply(types.MemberUpdate{Address: sender, State: types.MemberAlive}) // sender is evidently alive
+	for _, update := range msg.Members {
+		l.apply(update)
+	}
+	if env.Type == types.MsgSwimPing && l.self == "" {
+		l.self = msg.Target // learn own address from the first client to ping us
+		delete(l.members, l.self)
+	}
+	l.mu.Unlock()
+
+	switch env.Type {
+	case types.MsgSwimPing:
+		return l.send(sender, types.MsgSwimAck, types.SwimMessage{Seq: msg.Seq})
+	case types.MsgSwimPingReq:
+		go l.probeFor(sender, msg)
+	case types.MsgSwimAck:
+		l.mu.Lock()
+		onAck, ok := l.acks[msg.Seq]
+		delete(l.acks, msg.Seq)
+		l.mu.Unlock()
+
+		if ok {
+			onAck()
+		}
+	}
+
+	return nil
+}
+
+// Run() probes one member every protocol period, forever
+func (l *List) Run() {
+	for {
+		start := time.Now()
+
+		if target, ok := l.nextTarget(); ok {
+			l.probe(target)
+		}
+		l.expireSuspects()
+
+		time.Sleep(l.config.ProtocolPeriod - time.Since(start))
+	}
+}
+
+// probe() pings a member directly, then through others, and suspects it if no ack arrives within the protocol period
+func (l *List) probe(target string) {
+	acked := make(chan struct{})
+	var once sync.Once
+	seq := l.expectAck(func() { once.Do(func() { close(acked) }) })
+	defer l.forgetAck(seq)
+
+	if err := l.send(target, types.MsgSwimPing, types.SwimMessage{Seq: seq, Target: target}); err == nil {
+		select {
+		case <-acked:
+			return
+		case <-time.After(l.config.PingTimeout):
+		}
+	}
+
+	for _, helper := range l.randomMembers(l.config.IndirectChecks, target) {
+		l.send(helper, types.MsgSwimPingReq, types.SwimMessage{Seq: seq, Target: target})
+	}
+
+	select {
+	case <-acked:
+	case <-time.After(l.config.ProtocolPeriod - l.config.PingTimeout):
+		l.mu.Lock()
+		if m, ok := l.members[target]; ok && m.state == types.MemberAlive {
+			fmt.Printf("Suspecting %s is down\n", target)
+			l.apply(types.MemberUpdate{Address: target, State: types.MemberSuspect, Incarnation: m.incarnation})
+		}
+		l.mu.Unlock()
+	}
+}
+
+// probeFor() pings a member on behalf of another member that could not reach it, and relays the ack
+func (l *List) probeFor(requester string, req types.SwimMessage) {
+	acked := make(chan struct{})
+	var once sync.Once
+	seq := l.expectAck(func() { once.Do(func() { close(acked) }) })
+	defer l.forgetAck(seq)
+
+	if err := l.send(req.Target, types.MsgSwimPing, types.SwimMessage{Seq: seq, Target: req.Target}); err != nil {
+		return
+	}
+
+	select {
+	case <-acked:
+		l.send(requester, types.MsgSwimAck, types.SwimMessage{Seq: req.Seq})
+	case <-time.After(l.config.ProtocolPeriod):
+	}
+}
+
+// send() sends a SWIM message with piggybacked updates
+func (l *List) send(address string, msgType string, msg types.SwimMessage) error {
+	msg.Port = l.port
+	msg.Members = l.Updates()
+	return l.pool.Send(address, msgType, msg)
+}
+
+// expectAck() reserves a sequence number and registers what to do when its ack arrives
+func (l *List) expectAck(onAck func()) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	l.acks[l.seq] = onAck
+	return l.seq
+}
+
+// forgetAck() stops waiting for an ack
+func (l *List) forgetAck(seq uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.acks, seq)
+}
+
+// nextTarget() picks the next member to probe. Every live member is probed once per round, in random order
+func (l *List) nextTarget() (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for {
+		if len(l.probeOrder) == 0 {
+			for address, m := range l.members {
+				if m.state != types.MemberDead {
+					l.probeOrder = append(l.probeOrder, address)
+				}
+			}
+			if len(l.probeOrder) == 0 {
+				return "", false
+			}
+			rand.Shuffle(len(l.probeOrder), func(i, j int) {
+				l.probeOrder[i], l.probeOrder[j] = l.probeOrder[j], l.probeOrder[i]
+			})
+		}
+
+		target := l.probeOrder[0]
+		l.probeOrder = l.probeOrder[1:]
+
+		if m, ok := l.members[target]; ok && m.state != types.MemberDead { // member may have died since round started
+			return target, true
+		}
+	}
+}
+
+// randomMembers() picks up to count random live members other than exclude
+func (l *List) randomMembers(count int, exclude string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	candidates := []string{}
+	for address, m := range l.members {
+		if address != exclude && m.state == types.MemberAlive {
+			candidates = append(candidates, address)
+		}
+	}
+
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	return candidates[:min(count, len(candidates))]
+}
+
+// expireSuspects() declares members dead that did not refute suspicion in time, and forgets long dead members
+func (l *List) expireSuspects() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	suspicionTimeout := time.Duration(l.config.SuspicionPeriods) * l.config.ProtocolPeriod
+
+	for address, m := range l.members {
+		switch {
+		case m.state == types.MemberSuspect && time.Since(m.changed) > suspicionTimeout:
+			fmt.Printf("Declaring %s dead\n", address)
+			l.apply(types.MemberUpdate{Address: address, State: types.MemberDead, Incarnation: m.incarnation})
+		case m.state == types.MemberDead && time.Since(m.changed) > l.config.DeadRetention:
+			delete(l.members, address)
+		}
+	}
+}
+
+// apply() merges a single update following SWIM's precedence rules: a higher incarnation always wins, and at the
+// same incarnation dead overrides suspect, which overrides alive. Caller must hold lock
+func (l *List) apply(update types.MemberUpdate) {
+	if update.Address == "" {
+		return
+	}
+
+	if update.Address == l.self {
+		if update.State != types.MemberAlive && update.Incarnation >= l.incarnation { // refute being suspected or declared dead
+			l.incarnation = update.Incarnation + 1
+			l.queue(types.MemberUpdate{Address: l.self, State: types.MemberAlive, Incarnation: l.incarnation})
+		}
+		return
+	}
+
+	m, ok := l.members[update.Address]
+	if !ok {
+		if update.State == types.MemberDead {
+			return // nothing to forget
+		}
+		m = &member{state: update.State, incarnation: update.Incarnation, changed: time.Now()}
+		l.members[update.Address] = m
+		l.queue(update)
+		return
+	}
+
+	if update.Incarnation < m.incarnation {
+		return // stale
+	}
+	if update.Incarnation == m.incarnation && rank(update.State) <= rank(m.state) {
+		return // nothing new
+	}
+
+	if update.State == types.MemberAlive && m.state != types.MemberAlive {
+		fmt.Printf("%s is alive again\n", update.Address)
+	}
+
+	m.state = update.State
+	m.incarnation = update.Incarnation
+	m.changed = time.Now()
+	l.queue(update)
+}
+
+// queue() schedules an update to be piggybacked on enough messages to reach every member. Caller must hold lock
+func (l *List) queue(update types.MemberUpdate) {
+	transmits := l.config.RetransmitMult * int(math.Ceil(math.Log2(float64(len(l.members)+2))))
+
+	for _, queued := range l.updates {
+		if queued.update.Address == update.Address { // newer update replaces older one
+			queued.update = update
+			queued.transmits = transmits
+			return
+		}
+	}
+
+	l.updates = append(l.updates, &queuedUpdate{update: update, transmits: transmits})
+}
+
+// rank() orders states of the same incarnation
+func rank(state string) int {
+	switch state {
+	case types.MemberSuspect:
+		return 1
+	case types.MemberDead:
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,199 @@
+package membership
+
+import (
+	"encoding/json"
+	"net"
+	"sjsu-pub-sub/pool"
+	"sjsu-pub-sub/types"
+	"testing"
+	"time"
+)
+
+// newList() creates a list probing quickly, sending through a pool closed when the test ends
+func newList(t *testing.T) *List {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.ProtocolPeriod = 100 * time.Millisecond
+	config.PingTimeout = 30 * time.Millisecond
+	config.SuspicionPeriods = 2
+
+	p := pool.New("test", nil, pool.DefaultIdleTTL, nil)
+	t.Cleanup(p.Close)
+	return New(config, p, ":9999")
+}
+
+// envelope() wraps a SWIM message as it arrives from another client
+func envelope(t *testing.T, msgType string, msg types.SwimMessage) types.Envelope {
+	t.Helper()
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.Envelope{Type: msgType, Version: types.ProtocolVersion, Payload: data}
+}
+
+// listen() starts a client on a free local port that passes every SWIM message it receives to handle
+func listen(t *testing.T, handle func(env types.Envelope)) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				session, err := types.AcceptSession(conn, "client", nil, types.MaxFrameSize)
+				if err != nil {
+					return
+				}
+				for {
+					env, err := session.Receive()
+					if err != nil {
+						return
+					}
+					handle(env)
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// unreachable() returns an address nobody listens on
+func unreachable(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+// state() returns the state a list holds for a member, empty if it does not know it
+func (l *List) state(address string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if m, ok := l.members[address]; ok {
+		return m.state
+	}
+	return ""
+}
+
+func TestProbeAnswered(t *testing.T) {
+	l := newList(t)
+
+	address := listen(t, func(env types.Envelope) {
+		var ping types.SwimMessage
+		if env.Type != types.MsgSwimPing || env.Decode(&ping) != nil {
+			return
+		}
+		l.Handle(envelope(t, types.MsgSwimAck, types.SwimMessage{Seq: ping.Seq, Port: ":1"}), &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	})
+	l.Learn([]string{address})
+
+	l.probe(address)
+	if state := l.state(address); state != types.MemberAlive {
+		t.Errorf("member that acked is %s, want %s", state, types.MemberAlive)
+	}
+}
+
+func TestSuspectThenDead(t *testing.T) {
+	l := newList(t)
+	address := unreachable(t)
+	l.Learn([]string{address})
+
+	l.probe(address)
+	if state := l.state(address); state != types.MemberSuspect {
+		t.Fatalf("member that did not ack is %s, want %s", state, types.MemberSuspect)
+	}
+	if !l.Alive(address) {
+		t.Error("suspected member is no longer gossiped to")
+	}
+
+	l.expireSuspects()
+	if state := l.state(address); state != types.MemberSuspect {
+		t.Errorf("member is %s before its suspicion timed out, want %s", state, types.MemberSuspect)
+	}
+
+	time.Sleep(time.Duration(l.config.SuspicionPeriods)*l.config.ProtocolPeriod + 50*time.Millisecond)
+	l.expireSuspects()
+	if state := l.state(address); state != types.MemberDead {
+		t.Errorf("member that did not refute is %s, want %s", state, types.MemberDead)
+	}
+	if l.Alive(address) {
+		t.Error("dead member is still gossiped to")
+	}
+
+	l.Learn([]string{address}) // stale groupmates list still naming it
+	if state := l.state(address); state != types.MemberDead {
+		t.Errorf("learning a dead member again made it %s", state)
+	}
+}
+
+func TestMemberRefutes(t *testing.T) {
+	l := newList(t)
+	const address = "10.0.0.2:9000"
+	l.Learn([]string{address})
+
+	tests := []struct {
+		name   string
+		update types.MemberUpdate
+		want   string
+	}{
+		{"suspected", types.MemberUpdate{Address: address, State: types.MemberSuspect}, types.MemberSuspect},
+		{"alive at the same incarnation", types.MemberUpdate{Address: address, State: types.MemberAlive}, types.MemberSuspect},
+		{"refutes with a higher incarnation", types.MemberUpdate{Address: address, State: types.MemberAlive, Incarnation: 1}, types.MemberAlive},
+		{"stale suspicion", types.MemberUpdate{Address: address, State: types.MemberSuspect}, types.MemberAlive},
+		{"declared dead", types.MemberUpdate{Address: address, State: types.MemberDead, Incarnation: 1}, types.MemberDead},
+		{"rejoins with a higher incarnation", types.MemberUpdate{Address: address, State: types.MemberAlive, Incarnation: 2}, types.MemberAlive},
+	}
+
+	for _, tt := range tests {
+		l.Apply([]types.MemberUpdate{tt.update})
+		if state := l.state(address); state != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, state, tt.want)
+		}
+	}
+}
+
+func TestSelfRefutes(t *testing.T) {
+	l := newList(t)
+	const self = "10.0.0.1:9999"
+
+	// first ping tells the list its own address
+	sender := listen(t, func(env types.Envelope) {})
+	host, port, _ := net.SplitHostPort(sender)
+	ping := types.SwimMessage{Seq: 1, Target: self, Port: ":" + port}
+	if err := l.Handle(envelope(t, types.MsgSwimPing, ping), &net.TCPAddr{IP: net.ParseIP(host)}); err != nil {
+		t.Fatal(err)
+	}
+
+	l.Apply([]types.MemberUpdate{{Address: self, State: types.MemberSuspect}})
+
+	refuted := false
+	for _, update := range l.Updates() {
+		if update.Address == self && update.State == types.MemberAlive && update.Incarnation == 1 {
+			refuted = true
+		}
+	}
+	if !refuted {
+		t.Error("suspicion of itself was not refuted with a higher incarnation")
+	}
+	if state := l.state(self); state != "" {
+		t.Errorf("list holds itself as a %s member", state)
+	}
+}
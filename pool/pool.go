@@ -0,0 +1,230 @@
+package pool
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sjsu-pub-sub/certs"
+	"sjsu-pub-sub/types"
+	"sync"
+	"time"
+)
+
+const (
+	dialTimeout    = 2 * time.Second
+	writeTimeout   = 2 * time.Second
+	pingInterval   = 5 * time.Second
+	pongTimeout    = 3 * pingInterval // connection is dead if no pong arrives for this long
+	DefaultIdleTTL = 2 * time.Minute  // how long an unused connection is kept open by default
+)
+
+var ErrClosed = errors.New("connection pool is closed")
+
+// single long-lived connection to a peer
+type peerConn struct {
+	mu       sync.Mutex // held while writing, so messages are never interleaved
+	conn     net.Conn
+	session  *types.Session
+	lastUsed time.Time
+	lastPong time.Time
+}
+
+// Pool keeps one long-lived connection to each peer it sends messages to, keyed by address. Connections are reused
+// for every message, closed when the peer goes away or stops answering pings, and evicted once idle
+type Pool struct {
+	mu           sync.Mutex
+	from         string
+	capabilities []string
+	idleTTL      time.Duration
+	tls          *tls.Config // dials peers over TLS if set
+	conns        map[string]*peerConn
+	closed       bool
+	done         chan struct{}
+}
+
+// New() creates a pool whose connections introduce themselves as from, and are closed after idleTTL without use.
+// Peers are dialed over TLS if tlsConfig is set
+func New(from string, capabilities []string, idleTTL time.Duration, tlsConfig *tls.Config) *Pool {
+	return &Pool{
+		from:         from,
+		capabilities: append([]string{types.CapPing}, capabilities...), // health check peers that answer pings
+		idleTTL:      idleTTL,
+		tls:          tlsConfig,
+		conns:        make(map[string]*peerConn),
+		done:         make(chan struct{}),
+	}
+}
+
+// Run() pings open connections and evicts dead and idle ones until the pool is closed
+func (p *Pool) Run() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		conns := make(map[string]*peerConn, len(p.conns))
+		for address, pc := range p.conns {
+			conns[address] = pc
+		}
+		p.mu.Unlock()
+
+		for address, pc := range conns {
+			pc.mu.Lock()
+			idle := time.Since(pc.lastUsed) > p.idleTTL
+			silent := pc.session.Supports(types.CapPing) && time.Since(pc.lastPong) > pongTimeout
+			pc.mu.Unlock()
+
+			if idle || silent {
+				p.evict(address, pc)
+				continue
+			}
+
+			if pc.session.Supports(types.CapPing) {
+				if err := p.write(pc, types.MsgPing, struct{}{}); err != nil {
+					p.evict(address, pc)
+				}
+			}
+		}
+	}
+}
+
+// Send() sends a message to the peer at address, dialing it if there is no open connection. A connection that turns
+// out to be broken is replaced once
+func (p *Pool) Send(address string, msgType string, payload interface{}) error {
+	for attempt := 0; ; attempt++ {
+		pc, err := p.get(address)
+		if err != nil {
+			return err
+		}
+
+		err = p.write(pc, msgType, payload)
+		if err == nil {
+			return nil
+		}
+
+		p.evict(address, pc)
+		if attempt > 0 { // fresh connection failed too, peer is unreachable
+			return err
+		}
+	}
+}
+
+// Close() closes every connection. Sending on a closed pool fails with ErrClosed
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	conns := p.conns
+	p.conns = make(map[string]*peerConn)
+	p.mu.Unlock()
+
+	for _, pc := range conns {
+		pc.conn.Close()
+	}
+}
+
+// get() returns the open connection to address, or dials a new one
+func (p *Pool) get(address string) (*peerConn, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrClosed
+	}
+	pc, ok := p.conns[address]
+	p.mu.Unlock()
+
+	if ok {
+		return pc, nil
+	}
+
+	conn, err := certs.Dial(address, dialTimeout, p.tls)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %v", address, err)
+	}
+
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	session, err := types.StartSession(conn, p.from, p.capabilities, types.MaxFrameSize)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed handshake with %s: %v", address, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	pc = &peerConn{
+		conn:     conn,
+		session:  session,
+		lastUsed: time.Now(),
+		lastPong: time.Now(),
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		conn.Close()
+		return nil, ErrClosed
+	}
+	if existing, ok := p.conns[address]; ok { // dialed the same peer concurrently, keep the first connection
+		p.mu.Unlock()
+		conn.Close()
+		return existing, nil
+	}
+	p.conns[address] = pc
+	p.mu.Unlock()
+
+	go p.read(address, pc)
+
+	return pc, nil
+}
+
+// write() sends a single message on a connection
+func (p *Pool) write(pc *peerConn, msgType string, payload interface{}) error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := pc.session.Send(msgType, payload)
+	if msgType != types.MsgPing {
+		pc.lastUsed = time.Now()
+	}
+
+	return err
+}
+
+// read() receives pongs on a connection, and evicts it as soon as the peer closes it
+func (p *Pool) read(address string, pc *peerConn) {
+	for {
+		env, err := pc.session.Receive()
+		if err != nil {
+			p.evict(address, pc)
+			return
+		}
+
+		if env.Type == types.MsgPong {
+			pc.mu.Lock()
+			pc.lastPong = time.Now()
+			pc.mu.Unlock()
+		}
+	}
+}
+
+// evict() closes a connection and forgets it, unless it was already replaced
+func (p *Pool) evict(address string, pc *peerConn) {
+	p.mu.Lock()
+	if p.conns[address] == pc {
+		delete(p.conns, address)
+	}
+	p.mu.Unlock()
+
+	pc.conn.Close()
+}
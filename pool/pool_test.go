@@ -0,0 +1,145 @@
+package pool
+
+import (
+	"net"
+	"sjsu-pub-sub/types"
+	"testing"
+	"time"
+)
+
+// peer is a server accepting pooled connections, recording each connection and every message it receives
+type peer struct {
+	address  string
+	accepted chan net.Conn
+	received chan types.Envelope
+}
+
+// newPeer() starts a peer on a free local port
+func newPeer(t *testing.T) *peer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	p := &peer{address: listener.Addr().String(), accepted: make(chan net.Conn, 10), received: make(chan types.Envelope, 10)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			p.accepted <- conn
+
+			go func() {
+				defer conn.Close()
+				session, err := types.AcceptSession(conn, "peer", nil, types.MaxFrameSize)
+				if err != nil {
+					return
+				}
+				for {
+					env, err := session.Receive()
+					if err != nil {
+						return
+					}
+					p.received <- env
+				}
+			}()
+		}
+	}()
+	return p
+}
+
+// next() returns the next message the peer received, failing the test if none arrives in time
+func (p *peer) next(t *testing.T) types.Envelope {
+	t.Helper()
+
+	select {
+	case env := <-p.received:
+		return env
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+		return types.Envelope{}
+	}
+}
+
+// open() returns how many connections the pool holds
+func (p *Pool) open() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.conns)
+}
+
+func TestSendReusesConnection(t *testing.T) {
+	server := newPeer(t)
+	p := New("test", nil, DefaultIdleTTL, nil)
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := p.Send(server.address, types.MsgGossip, i); err != nil {
+			t.Fatal(err)
+		}
+		if env := server.next(t); env.Type != types.MsgGossip {
+			t.Errorf("got %s, want %s", env.Type, types.MsgGossip)
+		}
+	}
+
+	if accepted := len(server.accepted); accepted != 1 {
+		t.Errorf("peer accepted %d connections, want one reused for every message", accepted)
+	}
+	if open := p.open(); open != 1 {
+		t.Errorf("pool holds %d connections, want 1", open)
+	}
+}
+
+func TestSendRedialsClosedConnection(t *testing.T) {
+	server := newPeer(t)
+	p := New("test", nil, DefaultIdleTTL, nil)
+	defer p.Close()
+
+	if err := p.Send(server.address, types.MsgGossip, 1); err != nil {
+		t.Fatal(err)
+	}
+	server.next(t)
+	(<-server.accepted).Close() // peer restarts
+
+	deadline := time.Now().Add(2 * time.Second)
+	for p.open() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("connection closed by the peer was not evicted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := p.Send(server.address, types.MsgGossip, 2); err != nil {
+		t.Fatal(err)
+	}
+	server.next(t)
+	if accepted := len(server.accepted); accepted != 1 {
+		t.Errorf("peer accepted %d new connections, want 1", accepted)
+	}
+}
+
+func TestSendUnreachableAndClosed(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close() // nobody listens there anymore
+
+	p := New("test", nil, DefaultIdleTTL, nil)
+	if err := p.Send(address, types.MsgGossip, 1); err == nil {
+		t.Error("sent to a peer nobody listens for")
+	}
+	if open := p.open(); open != 0 {
+		t.Errorf("pool holds %d connections to an unreachable peer", open)
+	}
+
+	p.Close()
+	if err := p.Send(newPeer(t).address, types.MsgGossip, 1); err != ErrClosed {
+		t.Errorf("sending on a closed pool: got %v, want %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,934 @@
+package raft
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sjsu-pub-sub/certs"
+	"sjsu-pub-sub/types"
+	"sync"
+	"time"
+)
+
+const (
+	heartbeatInterval  = 500 * time.Millisecond
+	minElectionTimeout = 1500 * time.Millisecond
+	maxElectionTimeout = 3000 * time.Millisecond
+	rpcTimeout         = 1 * time.Second
+	snapshotTimeout    = 30 * time.Second
+	startupGrace       = 2 * maxElectionTimeout // how long a rejoining server waits to hear from a leader
+	compactThreshold   = 1000                   // applied entries kept in the log before it is compacted
+	snapshotChunkSize  = 1024 * 1024            // bytes of snapshot sent per InstallSnapshot message
+	maxBatchSize       = 4 * 1024 * 1024        // bytes of commands sent per message, so it stays within types.MaxRaftFrameSize
+	snapshotRetry      = 5 * time.Second        // time between snapshots sent to the same peer, so a down peer does not cost one per heartbeat
+)
+
+var (
+	ErrNotLeader      = errors.New("not the leader")
+	ErrLeadershipLost = errors.New("leadership lost before entry was committed")
+	ErrTimeout        = errors.New("timed out waiting for entry to be committed")
+)
+
+type State int
+
+const (
+	Follower State = iota
+	Candidate
+	Leader
+)
+
+func (s State) String() string {
+	switch s {
+	case Follower:
+		return "follower"
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	}
+	return "unknown"
+}
+
+type Config struct {
+	Id        string      // host:port other servers send Raft messages to, identifying this server
+	Peers     []string    // host:port of all other servers
+	StatePath string      // file the term and vote are written to. The log is appended to a file next to it, see logPath()
+	TLS       *tls.Config // dials other servers over TLS if set. The listener passed to HandleConn() must match
+
+	// number of servers, including the leader, that must persist an entry before it is committed and
+	// acknowledged. Raised to a majority if lower, and capped at the cluster size
+	Quorum int
+
+	// called once per committed entry, in log order, on every server. Entries with no command are
+	// no-ops appended by a new leader and are not passed on
+	Apply func(entry types.LogEntry) error
+
+	// Snapshot captures everything Apply has written so far, and Restore replaces it. Used to bring a
+	// rejoining server up to date, and any server the leader has compacted entries away for
+	Snapshot func() ([]byte, error)
+	Restore  func(data []byte) error
+
+	// whether what Apply wrote survives a restart. A restarted server whose writes are durable and whose log still
+	// overlaps the leader's is only sent the entries it missed, instead of a snapshot
+	Durable bool
+}
+
+// result of applying an entry, handed to the Propose() call waiting on it
+type pendingEntry struct {
+	term uint64
+	done chan error
+}
+
+// Node is a single server taking part in Raft leader election and log replication
+type Node struct {
+	mu sync.Mutex
+
+	id        string
+	peers     []string
+	statePath string
+	logPath   string
+	logFile   *os.File // log appended to, so a new entry costs a single write instead of rewriting the log
+	tls       *tls.Config
+	quorum    int
+	apply     func(entry types.LogEntry) error
+	snapshot  func() ([]byte, error)
+	restore   func(data []byte) error
+	durable   bool
+
+	applyMu sync.Mutex // held while applying entries or taking and restoring snapshots. Acquire before mu
+
+	state       State
+	currentTerm uint64
+	votedFor    string
+	log         []types.LogEntry // log[0] is a sentinel holding the index and term of the last compacted entry
+	commitIndex uint64
+	lastApplied uint64
+	leaderId    string
+	ready       bool // caught up with the cluster, so may serve reads and stand for election
+
+	snapshotIndex uint64 // follower only: index of the snapshot being received in chunks
+	snapshotTerm  uint64
+	snapshotData  []byte // chunks of the snapshot received so far
+
+	nextIndex       map[string]uint64    // leader only: next entry to send to each peer
+	matchIndex      map[string]uint64    // leader only: highest entry known to be replicated on each peer
+	needsSnapshot   map[string]bool      // leader only: peers that asked for a snapshot
+	sendingSnapshot map[string]bool      // leader only: peers a snapshot is currently being sent to
+	nextSnapshot    map[string]time.Time // leader only: when the next snapshot may be sent to each peer
+	pending         map[uint64]pendingEntry
+
+	applyNotify chan struct{} // signalled whenever commitIndex advances
+
+	lastContact     time.Time
+	electionTimeout time.Duration
+	lastHeartbeat   time.Time
+}
+
+// NewNode() creates a follower, restoring any term, vote and log persisted at config.StatePath
+func NewNode(config Config) (*Node, error) {
+	n := &Node{
+		id:              config.Id,
+		peers:           config.Peers,
+		statePath:       config.StatePath,
+		logPath:         logPath(config.StatePath),
+		tls:             config.TLS,
+		quorum:          config.Quorum,
+		apply:           config.Apply,
+		snapshot:        config.Snapshot,
+		restore:         config.Restore,
+		durable:         config.Durable,
+		state:           Follower,
+		log:             []types.LogEntry{{Index: 0, Term: 0}},
+		ready:           len(config.Peers) == 0, // nobody to catch up from
+		nextIndex:       make(map[string]uint64),
+		matchIndex:      make(map[string]uint64),
+		needsSnapshot:   make(map[string]bool),
+		sendingSnapshot: make(map[string]bool),
+		nextSnapshot:    make(map[string]time.Time),
+		pending:         make(map[uint64]pendingEntry),
+		applyNotify:     make(chan struct{}, 1),
+	}
+
+	majority := len(n.peers)/2 + 1
+	if n.quorum < majority {
+		n.quorum = majority
+	}
+	if n.quorum > len(n.peers)+1 {
+		n.quorum = len(n.peers) + 1
+	}
+
+	// state that must survive a restart so a server never votes twice in a term, forgets entries or applies one twice
+	ps, err := readState(n.statePath)
+	if err != nil {
+		return nil, err
+	}
+	n.currentTerm = ps.CurrentTerm
+	n.votedFor = ps.VotedFor
+
+	log, lastApplied, complete, err := readLog(n.logPath)
+	if err != nil {
+		return nil, err
+	}
+	if log != nil {
+		n.log = log
+	}
+	n.lastApplied = lastApplied
+	n.commitIndex = lastApplied // anything applied was committed
+
+	if log == nil || !complete {
+		n.rewriteLog() // start the log file, or drop a record cut short by a crash
+	} else if n.logFile, err = os.OpenFile(n.logPath, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return nil, fmt.Errorf("failed to open raft log: %v", err)
+	}
+	if n.logFile == nil {
+		return nil, fmt.Errorf("failed to write raft log %s", n.logPath)
+	}
+	n.resetElectionTimer()
+
+	return n, nil
+}
+
+// IsLeader() reports whether this server currently believes it is leader
+func (n *Node) IsLeader() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.state == Leader
+}
+
+// Ready() reports whether this server has caught up with the cluster since starting
+func (n *Node) Ready() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ready
+}
+
+// Leader() returns the leader this server knows of, and the current term
+func (n *Node) Leader() (string, uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leaderId, n.currentTerm
+}
+
+// Propose() appends command to the leader's log and blocks until it is committed by a quorum and applied
+// locally, returning the entry's index and the error Apply produced for it
+func (n *Node) Propose(command []byte, timeout time.Duration) (uint64, error) {
+	n.mu.Lock()
+	if n.state != Leader {
+		n.mu.Unlock()
+		return 0, ErrNotLeader
+	}
+
+	entry := types.LogEntry{
+		Index:   n.lastIndex() + 1,
+		Term:    n.currentTerm,
+		Command: command,
+	}
+	n.log = append(n.log, entry)
+	n.appendLog(entry)
+
+	done := make(chan error, 1)
+	n.pending[entry.Index] = pendingEntry{term: entry.Term, done: done}
+	n.advanceCommitIndex() // single server clusters commit right away
+	n.mu.Unlock()
+
+	n.broadcastAppendEntries() // don't wait for the next heartbeat
+
+	select {
+	case err := <-done:
+		return entry.Index, err
+	case <-time.After(timeout):
+		n.mu.Lock()
+		delete(n.pending, entry.Index)
+		n.mu.Unlock()
+		return entry.Index, ErrTimeout
+	}
+}
+
+// Run() drives election timeouts, leader heartbeats and applying committed entries. It never returns
+func (n *Node) Run() {
+	go n.applyCommitted()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n.mu.Lock()
+		if !n.ready && time.Since(n.lastContact) >= startupGrace { // no leader to catch up from, cluster is starting
+			fmt.Println("No leader found, joining elections...")
+			n.ready = true
+			n.resetElectionTimer()
+		}
+		state := n.state
+		ready := n.ready
+		electionDue := time.Since(n.lastContact) >= n.electionTimeout
+		heartbeatDue := time.Since(n.lastHeartbeat) >= heartbeatInterval
+		n.mu.Unlock()
+
+		if state == Leader && heartbeatDue {
+			n.broadcastAppendEntries()
+		} else if state != Leader && ready && electionDue {
+			n.startElection()
+		}
+	}
+}
+
+// HandleConn() answers a single RaftMessage received on the leader port
+func (n *Node) HandleConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(rpcTimeout))
+
+	session, err := types.AcceptSession(conn, n.id, nil, types.MaxRaftFrameSize)
+	if err != nil {
+		fmt.Println("Error accepting raft connection:", err)
+		return
+	}
+
+	env, err := session.Receive()
+	if err != nil {
+		return
+	}
+	if env.Type != types.MsgRaft {
+		fmt.Println("Unexpected message on raft port:", env.Type)
+		return
+	}
+
+	var msg types.RaftMessage
+	if err := env.Decode(&msg); err != nil {
+		return
+	}
+
+	var reply types.RaftReply
+	switch msg.Type {
+	case types.RaftRequestVote:
+		reply = n.handleRequestVote(msg)
+	case types.RaftAppendEntries:
+		reply = n.handleAppendEntries(msg)
+	case types.RaftInstallSnapshot:
+		conn.SetDeadline(time.Now().Add(snapshotTimeout)) // restoring the DB takes longer than other messages
+		reply = n.handleInstallSnapshot(msg)
+	case types.RaftLeaderQuery:
+		reply = n.handleLeaderQuery()
+	default:
+		fmt.Println("Unknown raft message type:", msg.Type)
+		return
+	}
+
+	session.Reply(env, types.MsgRaftReply, reply)
+}
+
+// Send() delivers msg to the server at address, over TLS if tlsConfig is set, and waits for its reply
+func Send(address string, tlsConfig *tls.Config, msg types.RaftMessage) (types.RaftReply, error) {
+	var reply types.RaftReply
+
+	timeout := rpcTimeout
+	if msg.Type == types.RaftInstallSnapshot {
+		timeout = snapshotTimeout
+	}
+
+	conn, err := certs.Dial(address, rpcTimeout, tlsConfig)
+	if err != nil {
+		return reply, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	session, err := types.StartSession(conn, msg.From, nil, types.MaxRaftFrameSize)
+	if err != nil {
+		return reply, err
+	}
+
+	id, err := session.Send(types.MsgRaft, msg)
+	if err != nil {
+		return reply, err
+	}
+
+	env, err := session.Receive()
+	if err != nil {
+		return reply, err
+	}
+	if env.Type != types.MsgRaftReply || env.Id != id {
+		return reply, fmt.Errorf("expected reply to message %d, got %s %d", id, env.Type, env.Id)
+	}
+
+	if err := env.Decode(&reply); err != nil {
+		return reply, err
+	}
+
+	return reply, nil
+}
+
+// startElection() turns this server into a candidate and requests votes from all peers
+func (n *Node) startElection() {
+	n.mu.Lock()
+	n.state = Candidate
+	n.currentTerm++
+	n.votedFor = n.id
+	n.leaderId = ""
+	n.resetElectionTimer()
+	n.saveState()
+
+	term := n.currentTerm
+	msg := types.RaftMessage{
+		Type:         types.RaftRequestVote,
+		Term:         term,
+		From:         n.id,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.lastTerm(),
+	}
+	votes := 1 // vote for self
+	if n.hasMajority(votes) {
+		n.becomeLeader()
+		n.mu.Unlock()
+		return
+	}
+	n.mu.Unlock()
+
+	fmt.Printf("Starting election for term %d...\n", term)
+
+	for _, peer := range n.peers {
+		go func(peer string) {
+			reply, err := Send(peer, n.tls, msg)
+			if err != nil {
+				return
+			}
+
+			n.mu.Lock()
+			defer n.mu.Unlock()
+
+			if reply.Term > n.currentTerm {
+				n.becomeFollower(reply.Term)
+				return
+			}
+			if n.state != Candidate || n.currentTerm != term || !reply.Success {
+				return
+			}
+
+			votes++
+			if n.hasMajority(votes) {
+				n.becomeLeader()
+			}
+		}(peer)
+	}
+}
+
+// broadcastAppendEntries() sends heartbeats, and any entries a peer is missing, to all peers
+func (n *Node) broadcastAppendEntries() {
+	n.mu.Lock()
+	n.lastHeartbeat = time.Now()
+	n.mu.Unlock()
+
+	for _, peer := range n.peers {
+		go n.replicateTo(peer)
+	}
+}
+
+// replicateTo() sends one AppendEntries to a peer and updates its progress from the reply
+func (n *Node) replicateTo(peer string) {
+	n.mu.Lock()
+	if n.state != Leader {
+		n.mu.Unlock()
+		return
+	}
+
+	if n.needsSnapshot[peer] || n.nextIndex[peer] <= n.firstIndex() { // peer needs entries we no longer have
+		if !n.sendingSnapshot[peer] && time.Now().After(n.nextSnapshot[peer]) {
+			n.sendingSnapshot[peer] = true
+			go n.sendSnapshot(peer)
+		}
+		n.mu.Unlock()
+		return
+	}
+
+	term := n.currentTerm
+	prevIndex := n.nextIndex[peer] - 1
+	entries := n.batchAfter(prevIndex)
+
+	msg := types.RaftMessage{
+		Type:         types.RaftAppendEntries,
+		Term:         term,
+		From:         n.id,
+		PrevLogIndex: prevIndex,
+		PrevLogTerm:  n.entryAt(prevIndex).Term,
+		Entries:      entries,
+		LeaderCommit: n.commitIndex,
+	}
+	n.mu.Unlock()
+
+	reply, err := Send(peer, n.tls, msg)
+	if err != nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if reply.Term > n.currentTerm {
+		n.becomeFollower(reply.Term)
+		return
+	}
+	if n.state != Leader || n.currentTerm != term {
+		return
+	}
+
+	if reply.Success {
+		match := prevIndex + uint64(len(entries))
+		if match > n.matchIndex[peer] {
+			n.matchIndex[peer] = match
+		}
+		n.nextIndex[peer] = n.matchIndex[peer] + 1
+		n.advanceCommitIndex()
+	} else if reply.NeedSnapshot {
+		fmt.Printf("Server %s is rejoining and needs a snapshot\n", peer)
+		n.needsSnapshot[peer] = true
+		go n.replicateTo(peer)
+	} else if reply.MatchIndex+1 < n.nextIndex[peer] { // back off to where the follower's log may still match
+		n.nextIndex[peer] = reply.MatchIndex + 1
+	} else if n.nextIndex[peer] > 1 {
+		n.nextIndex[peer]--
+	}
+}
+
+// handleRequestVote() grants a vote if the candidate's term is current and its log is at least as up to date
+func (n *Node) handleRequestVote(msg types.RaftMessage) types.RaftReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if msg.Term > n.currentTerm {
+		n.becomeFollower(msg.Term)
+	}
+
+	granted := false
+	if msg.Term == n.currentTerm && (n.votedFor == "" || n.votedFor == msg.From) && n.isUpToDate(msg.LastLogIndex, msg.LastLogTerm) {
+		granted = true
+		n.votedFor = msg.From
+		n.resetElectionTimer()
+		n.saveState()
+		fmt.Printf("Voted for %s in term %d\n", msg.From, msg.Term)
+	}
+
+	return types.RaftReply{Term: n.currentTerm, From: n.id, Success: granted, Leader: n.leaderId}
+}
+
+// handleAppendEntries() accepts heartbeats and entries from the leader if the logs match at PrevLogIndex
+func (n *Node) handleAppendEntries(msg types.RaftMessage) types.RaftReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	reply := types.RaftReply{Term: n.currentTerm, From: n.id}
+
+	if msg.Term < n.currentTerm { // stale leader
+		reply.Leader = n.leaderId
+		return reply
+	}
+
+	if msg.Term > n.currentTerm || n.state != Follower {
+		n.becomeFollower(msg.Term)
+	}
+	if n.leaderId != msg.From {
+		fmt.Printf("Following leader %s in term %d\n", msg.From, msg.Term)
+	}
+	n.leaderId = msg.From
+	n.resetElectionTimer()
+
+	reply.Term = n.currentTerm
+	reply.Leader = n.leaderId
+
+	if !n.ready && !n.durable { // DB may have lost writes, so catch up from a snapshot before taking any entries
+		reply.NeedSnapshot = true
+		return reply
+	}
+
+	if msg.PrevLogIndex < n.firstIndex() { // skip entries already compacted into our DB, they are committed
+		skip := n.firstIndex() - msg.PrevLogIndex
+		if skip > uint64(len(msg.Entries)) {
+			reply.Success = true
+			reply.MatchIndex = msg.PrevLogIndex + uint64(len(msg.Entries))
+			return reply
+		}
+		msg.Entries = msg.Entries[skip:]
+		msg.PrevLogIndex = n.firstIndex()
+		msg.PrevLogTerm = n.entryAt(msg.PrevLogIndex).Term
+	}
+
+	if msg.PrevLogIndex > n.lastIndex() { // missing entries, leader should back off to our last index
+		reply.MatchIndex = n.lastIndex()
+		return reply
+	}
+	if n.entryAt(msg.PrevLogIndex).Term != msg.PrevLogTerm { // conflicting entry, leader should back off past it
+		reply.MatchIndex = msg.PrevLogIndex - 1
+		return reply
+	}
+
+	for i, entry := range msg.Entries {
+		index := msg.PrevLogIndex + 1 + uint64(i)
+		if index <= n.lastIndex() {
+			if n.entryAt(index).Term == entry.Term {
+				continue // already have this entry
+			}
+			n.log = n.log[:index-n.firstIndex()] // drop conflicting entry and everything after it
+		}
+		n.log = append(n.log, msg.Entries[i:]...)
+		n.appendLog(msg.Entries[i:]...) // replaying the log drops the conflicting entries again
+		break
+	}
+
+	match := msg.PrevLogIndex + uint64(len(msg.Entries))
+	if msg.LeaderCommit > n.commitIndex && match > n.commitIndex {
+		n.commitIndex = min(msg.LeaderCommit, match)
+		n.notifyApply()
+	}
+
+	if !n.ready && match >= msg.LeaderCommit { // persisted log overlaps the leader's, and now holds every committed entry
+		n.ready = true
+		fmt.Printf("Caught up with leader %s at index %d from the persisted log\n", msg.From, match)
+	}
+
+	reply.Success = true
+	reply.MatchIndex = match
+	return reply
+}
+
+// handleInstallSnapshot() collects the chunks of the leader's snapshot, then replaces the DB and log with the snapshot
+// and the entries after it
+func (n *Node) handleInstallSnapshot(msg types.RaftMessage) types.RaftReply {
+	n.mu.Lock()
+	reply := types.RaftReply{Term: n.currentTerm, From: n.id, Leader: n.leaderId}
+	if msg.Term < n.currentTerm { // stale leader
+		n.mu.Unlock()
+		return reply
+	}
+	if msg.Term > n.currentTerm || n.state != Follower {
+		n.becomeFollower(msg.Term)
+	}
+	n.leaderId = msg.From
+	n.resetElectionTimer()
+	reply.Term = n.currentTerm
+	reply.Leader = n.leaderId
+
+	if msg.SnapshotOffset == 0 { // leader is starting a new snapshot
+		n.snapshotIndex = msg.SnapshotIndex
+		n.snapshotTerm = msg.SnapshotTerm
+		n.snapshotData = nil
+	} else if msg.SnapshotIndex != n.snapshotIndex || msg.SnapshotTerm != n.snapshotTerm || msg.SnapshotOffset != uint64(len(n.snapshotData)) {
+		n.mu.Unlock()
+		reply.NeedSnapshot = true // missed a chunk, leader starts over
+		return reply
+	}
+	n.snapshotData = append(n.snapshotData, msg.Snapshot...)
+
+	if !msg.SnapshotDone {
+		n.mu.Unlock()
+		reply.Success = true
+		return reply
+	}
+
+	data := n.snapshotData
+	n.snapshotData = nil
+	n.mu.Unlock()
+
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+
+	n.mu.Lock()
+	n.ready = false // DB is about to be replaced
+	n.mu.Unlock()
+
+	fmt.Printf("Installing snapshot at index %d from leader %s...\n", msg.SnapshotIndex, msg.From)
+
+	if err := n.restore(data); err != nil {
+		fmt.Println("Error restoring snapshot:", err)
+		reply.NeedSnapshot = true
+		return reply
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.log = append([]types.LogEntry{{Index: msg.SnapshotIndex, Term: msg.SnapshotTerm}}, msg.Entries...)
+	n.lastApplied = msg.SnapshotIndex
+	n.commitIndex = max(msg.SnapshotIndex, min(msg.LeaderCommit, n.lastIndex()))
+	n.ready = true
+	n.resetElectionTimer()
+	n.rewriteLog()
+	n.notifyApply() // apply the committed part of the tail
+
+	fmt.Printf("Caught up with leader %s at index %d\n", msg.From, msg.SnapshotIndex)
+
+	reply.Term = n.currentTerm
+	reply.Leader = n.leaderId
+	reply.Success = true
+	reply.MatchIndex = n.lastIndex()
+	return reply
+}
+
+// sendSnapshot() sends a peer a snapshot of the DB as of the last applied entry, plus the log after it
+func (n *Node) sendSnapshot(peer string) {
+	defer func() {
+		n.mu.Lock()
+		n.sendingSnapshot[peer] = false
+		n.nextSnapshot[peer] = time.Now().Add(snapshotRetry)
+		n.mu.Unlock()
+	}()
+
+	n.applyMu.Lock() // DB must not change between reading lastApplied and taking the snapshot
+	n.mu.Lock()
+	if n.state != Leader {
+		n.mu.Unlock()
+		n.applyMu.Unlock()
+		return
+	}
+
+	term := n.currentTerm
+	msg := types.RaftMessage{
+		Type:          types.RaftInstallSnapshot,
+		Term:          term,
+		From:          n.id,
+		SnapshotIndex: n.lastApplied,
+		SnapshotTerm:  n.entryAt(n.lastApplied).Term,
+		Entries:       n.batchAfter(n.lastApplied), // the rest follows in AppendEntries
+		LeaderCommit:  n.commitIndex,
+	}
+	n.mu.Unlock()
+
+	data, err := n.snapshot()
+	n.applyMu.Unlock()
+	if err != nil {
+		fmt.Println("Error taking snapshot:", err)
+		return
+	}
+	entries := msg.Entries
+
+	fmt.Printf("Sending snapshot at index %d to %s in %d bytes...\n", msg.SnapshotIndex, peer, len(data))
+
+	var reply types.RaftReply
+	for offset := 0; ; offset += snapshotChunkSize { // a chunk at a time, so no message grows with the DB
+		end := min(offset+snapshotChunkSize, len(data))
+		msg.SnapshotOffset = uint64(offset)
+		msg.Snapshot = data[offset:end]
+		msg.SnapshotDone = end == len(data)
+		msg.Entries = nil
+		if msg.SnapshotDone {
+			msg.Entries = entries
+		}
+
+		reply, err = Send(peer, n.tls, msg)
+		if err != nil {
+			return
+		}
+
+		n.mu.Lock()
+		if reply.Term > n.currentTerm {
+			n.becomeFollower(reply.Term)
+		}
+		stop := n.state != Leader || n.currentTerm != term || !reply.Success
+		n.mu.Unlock()
+
+		if stop || msg.SnapshotDone {
+			break
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.state != Leader || n.currentTerm != term || !reply.Success { // retried on a heartbeat once snapshotRetry passed
+		return
+	}
+
+	n.needsSnapshot[peer] = false
+	if reply.MatchIndex > n.matchIndex[peer] {
+		n.matchIndex[peer] = reply.MatchIndex
+	}
+	n.nextIndex[peer] = n.matchIndex[peer] + 1
+	n.advanceCommitIndex()
+}
+
+// handleLeaderQuery() tells the gateway who this server believes the leader is
+func (n *Node) handleLeaderQuery() types.RaftReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return types.RaftReply{Term: n.currentTerm, From: n.id, Leader: n.leaderId}
+}
+
+// advanceCommitIndex() commits the highest entry of the current term stored on a quorum of servers. Caller must hold n.mu
+func (n *Node) advanceCommitIndex() {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		if n.entryAt(index).Term != n.currentTerm { // only entries from the current term are committed by counting
+			break
+		}
+
+		count := 1 // leader has every entry
+		for _, peer := range n.peers {
+			if n.matchIndex[peer] >= index {
+				count++
+			}
+		}
+
+		if count >= n.quorum {
+			n.commitIndex = index
+			n.notifyApply()
+			break
+		}
+	}
+}
+
+// applyCommitted() applies committed entries in log order as commitIndex advances
+func (n *Node) applyCommitted() {
+	for range n.applyNotify {
+		for {
+			n.applyMu.Lock()
+			n.mu.Lock()
+			if n.lastApplied >= n.commitIndex {
+				n.mu.Unlock()
+				n.applyMu.Unlock()
+				break
+			}
+			entry := n.entryAt(n.lastApplied + 1)
+			n.mu.Unlock()
+
+			var err error
+			if len(entry.Command) > 0 {
+				err = n.apply(entry)
+				if err != nil {
+					fmt.Printf("Applying entry %d: %v\n", entry.Index, err)
+				}
+			}
+
+			n.mu.Lock()
+			n.lastApplied = entry.Index
+			n.appendApplied(entry.Index)
+			if p, ok := n.pending[entry.Index]; ok {
+				if p.term == entry.Term {
+					p.done <- err
+				} else { // our entry was overwritten by another leader
+					p.done <- ErrLeadershipLost
+				}
+				delete(n.pending, entry.Index)
+			}
+			if n.lastApplied-n.firstIndex() >= compactThreshold {
+				n.compact()
+			}
+			n.mu.Unlock()
+			n.applyMu.Unlock()
+		}
+	}
+}
+
+// compact() drops applied entries from the log, since the DB now holds their effect. Caller must hold n.mu
+func (n *Node) compact() {
+	last := n.entryAt(n.lastApplied)
+	n.log = append([]types.LogEntry{{Index: last.Index, Term: last.Term}}, n.entriesAfter(last.Index)...)
+	n.rewriteLog()
+}
+
+// notifyApply() wakes up applyCommitted() without blocking. Caller must hold n.mu
+func (n *Node) notifyApply() {
+	select {
+	case n.applyNotify <- struct{}{}:
+	default:
+	}
+}
+
+// becomeFollower() steps down to follower in the given term. Caller must hold n.mu
+func (n *Node) becomeFollower(term uint64) {
+	if n.state == Leader {
+		fmt.Printf("Stepping down as leader in term %d\n", term)
+		for index, p := range n.pending {
+			p.done <- ErrLeadershipLost
+			delete(n.pending, index)
+		}
+	}
+
+	n.state = Follower
+	if term > n.currentTerm {
+		n.currentTerm = term
+		n.votedFor = ""
+		n.leaderId = ""
+		n.saveState()
+	}
+	n.resetElectionTimer()
+}
+
+// becomeLeader() takes over as leader for the current term. Caller must hold n.mu
+func (n *Node) becomeLeader() {
+	n.state = Leader
+	n.leaderId = n.id
+	for _, peer := range n.peers {
+		n.nextIndex[peer] = n.lastIndex() + 1
+		n.matchIndex[peer] = 0
+	}
+
+	// entries from earlier terms only commit once an entry from this term does, so start with a no-op
+	noop := types.LogEntry{Index: n.lastIndex() + 1, Term: n.currentTerm}
+	n.log = append(n.log, noop)
+	n.appendLog(noop)
+	n.advanceCommitIndex()
+
+	fmt.Printf("Elected leader for term %d\n", n.currentTerm)
+
+	go n.broadcastAppendEntries() // assert leadership right away
+}
+
+// isUpToDate() checks whether a candidate's log is at least as up to date as ours. Caller must hold n.mu
+func (n *Node) isUpToDate(lastIndex uint64, lastTerm uint64) bool {
+	if lastTerm != n.lastTerm() {
+		return lastTerm > n.lastTerm()
+	}
+	return lastIndex >= n.lastIndex()
+}
+
+// hasMajority() checks whether count servers, including this one, form a majority of the cluster
+func (n *Node) hasMajority(count int) bool {
+	return count > (len(n.peers)+1)/2
+}
+
+// entryAt() returns the entry at index, which must not have been compacted. Caller must hold n.mu
+func (n *Node) entryAt(index uint64) types.LogEntry {
+	return n.log[index-n.firstIndex()]
+}
+
+// entriesAfter() copies all entries after index. Caller must hold n.mu
+func (n *Node) entriesAfter(index uint64) []types.LogEntry {
+	entries := make([]types.LogEntry, len(n.log[index-n.firstIndex()+1:]))
+	copy(entries, n.log[index-n.firstIndex()+1:])
+	return entries
+}
+
+// batchAfter() copies the entries after index that fit in one message, and at least one if there are any. Caller must
+// hold n.mu
+func (n *Node) batchAfter(index uint64) []types.LogEntry {
+	entries := n.log[index-n.firstIndex()+1:]
+
+	size := 0
+	for i, entry := range entries {
+		size += len(entry.Command)
+		if i > 0 && size > maxBatchSize {
+			entries = entries[:i]
+			break
+		}
+	}
+
+	return append([]types.LogEntry{}, entries...)
+}
+
+func (n *Node) firstIndex() uint64 {
+	return n.log[0].Index
+}
+
+func (n *Node) lastIndex() uint64 {
+	return n.log[len(n.log)-1].Index
+}
+
+func (n *Node) lastTerm() uint64 {
+	return n.log[len(n.log)-1].Term
+}
+
+// resetElectionTimer() restarts the election timeout with a new random duration. Caller must hold n.mu
+func (n *Node) resetElectionTimer() {
+	n.lastContact = time.Now()
+	n.electionTimeout = minElectionTimeout + time.Duration(rand.Int63n(int64(maxElectionTimeout-minElectionTimeout)))
+}
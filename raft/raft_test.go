@@ -0,0 +1,374 @@
+package raft
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sjsu-pub-sub/types"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// machine is the state a test node applies committed commands to, standing in for a server's DB
+type machine struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (m *machine) apply(entry types.LogEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = append(m.commands, string(entry.Command))
+	return nil
+}
+
+func (m *machine) snapshot() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return json.Marshal(m.commands)
+}
+
+func (m *machine) restore(data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = nil
+	return json.Unmarshal(data, &m.commands)
+}
+
+func (m *machine) applied() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.commands)
+}
+
+// newTestNode() creates a node keeping its state in dir, applying committed commands to m
+func newTestNode(t *testing.T, id string, peers []string, dir string, durable bool, m *machine) *Node {
+	t.Helper()
+
+	n, err := NewNode(Config{
+		Id:        id,
+		Peers:     peers,
+		StatePath: filepath.Join(dir, "raft.json"),
+		Apply:     m.apply,
+		Snapshot:  m.snapshot,
+		Restore:   m.restore,
+		Durable:   durable,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// entries() returns one entry per term given, starting at index first
+func entries(first uint64, terms ...uint64) []types.LogEntry {
+	result := []types.LogEntry{}
+	for i, term := range terms {
+		index := first + uint64(i)
+		result = append(result, types.LogEntry{Index: index, Term: term, Command: []byte(fmt.Sprint("command ", index))})
+	}
+	return result
+}
+
+// eventually() waits up to timeout for done to hold
+func eventually(t *testing.T, timeout time.Duration, what string, done func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRequestVote(t *testing.T) {
+	n := newTestNode(t, "a", []string{"b", "c"}, t.TempDir(), true, &machine{})
+	n.currentTerm = 2
+	n.log = append(n.log, entries(1, 1, 2)...)
+
+	tests := []struct {
+		name      string
+		msg       types.RaftMessage
+		want      bool
+		wantTerm  uint64
+		wantVoted string
+	}{
+		{"stale term", types.RaftMessage{Term: 1, From: "b", LastLogIndex: 2, LastLogTerm: 2}, false, 2, ""},
+		{"log of older term", types.RaftMessage{Term: 3, From: "b", LastLogIndex: 5, LastLogTerm: 1}, false, 3, ""},
+		{"shorter log", types.RaftMessage{Term: 3, From: "b", LastLogIndex: 1, LastLogTerm: 2}, false, 3, ""},
+		{"up to date log", types.RaftMessage{Term: 3, From: "c", LastLogIndex: 2, LastLogTerm: 2}, true, 3, "c"},
+		{"second candidate in term", types.RaftMessage{Term: 3, From: "b", LastLogIndex: 9, LastLogTerm: 3}, false, 3, "c"},
+		{"same candidate again", types.RaftMessage{Term: 3, From: "c", LastLogIndex: 2, LastLogTerm: 2}, true, 3, "c"},
+		{"candidate in new term", types.RaftMessage{Term: 4, From: "b", LastLogIndex: 2, LastLogTerm: 2}, true, 4, "b"},
+	}
+
+	for _, tt := range tests {
+		tt.msg.Type = types.RaftRequestVote
+		reply := n.handleRequestVote(tt.msg)
+		if reply.Success != tt.want || reply.Term != tt.wantTerm || n.votedFor != tt.wantVoted {
+			t.Errorf("%s: got granted %v term %d voted for %q, want %v %d %q", tt.name, reply.Success, reply.Term, n.votedFor, tt.want, tt.wantTerm, tt.wantVoted)
+		}
+	}
+}
+
+func TestAppendEntries(t *testing.T) {
+	m := &machine{}
+	n := newTestNode(t, "b", []string{"a", "c"}, t.TempDir(), true, m)
+	n.currentTerm = 1
+	go n.applyCommitted()
+
+	tests := []struct {
+		name      string
+		msg       types.RaftMessage
+		want      bool
+		wantMatch uint64
+		wantLog   []uint64 // term of each entry after the sentinel
+	}{
+		{"stale leader", types.RaftMessage{Term: 0, From: "a", Entries: entries(1, 0)}, false, 0, []uint64{}},
+		{"gap before entries", types.RaftMessage{Term: 1, From: "a", PrevLogIndex: 2, PrevLogTerm: 1, Entries: entries(3, 1)}, false, 0, []uint64{}},
+		{"first entries", types.RaftMessage{Term: 1, From: "a", Entries: entries(1, 1, 1, 1)}, true, 3, []uint64{1, 1, 1}},
+		{"same entries again", types.RaftMessage{Term: 1, From: "a", PrevLogIndex: 1, PrevLogTerm: 1, Entries: entries(2, 1)}, true, 2, []uint64{1, 1, 1}},
+		{"previous term differs", types.RaftMessage{Term: 2, From: "c", PrevLogIndex: 3, PrevLogTerm: 2, Entries: entries(4, 2)}, false, 2, []uint64{1, 1, 1}},
+		{"conflicting entries", types.RaftMessage{Term: 2, From: "c", PrevLogIndex: 2, PrevLogTerm: 1, Entries: entries(3, 2, 2)}, true, 4, []uint64{1, 1, 2, 2}},
+		{"heartbeat commits", types.RaftMessage{Term: 2, From: "c", PrevLogIndex: 4, PrevLogTerm: 2, LeaderCommit: 3}, true, 4, []uint64{1, 1, 2, 2}},
+	}
+
+	for _, tt := range tests {
+		tt.msg.Type = types.RaftAppendEntries
+		reply := n.handleAppendEntries(tt.msg)
+
+		n.mu.Lock()
+		terms := []uint64{}
+		for _, entry := range n.log[1:] {
+			terms = append(terms, entry.Term)
+		}
+		n.mu.Unlock()
+
+		if reply.Success != tt.want || reply.MatchIndex != tt.wantMatch || !slices.Equal(terms, tt.wantLog) {
+			t.Errorf("%s: got success %v match %d log %v, want %v %d %v", tt.name, reply.Success, reply.MatchIndex, terms, tt.want, tt.wantMatch, tt.wantLog)
+		}
+	}
+
+	eventually(t, time.Second, "committed entries to be applied", func() bool { return len(m.applied()) == 3 })
+	if want := []string{"command 1", "command 2", "command 3"}; !slices.Equal(m.applied(), want) {
+		t.Errorf("applied %v, want %v", m.applied(), want)
+	}
+}
+
+// TestAppendEntriesNeedsSnapshot checks a server that lost its DB on restart asks for a snapshot before taking entries
+func TestAppendEntriesNeedsSnapshot(t *testing.T) {
+	n := newTestNode(t, "b", []string{"a"}, t.TempDir(), false, &machine{})
+
+	reply := n.handleAppendEntries(types.RaftMessage{Type: types.RaftAppendEntries, Term: 1, From: "a", Entries: entries(1, 1)})
+	if reply.Success || !reply.NeedSnapshot {
+		t.Errorf("got success %v need snapshot %v, want a request for a snapshot", reply.Success, reply.NeedSnapshot)
+	}
+}
+
+func TestInstallSnapshot(t *testing.T) {
+	m := &machine{}
+	n := newTestNode(t, "b", []string{"a"}, t.TempDir(), false, m)
+	go n.applyCommitted()
+
+	data, _ := json.Marshal([]string{"command 1", "command 2"})
+	first, rest := data[:5], data[5:]
+
+	tests := []struct {
+		name     string
+		msg      types.RaftMessage
+		want     bool
+		wantNeed bool
+	}{
+		{"first chunk", types.RaftMessage{SnapshotIndex: 2, SnapshotTerm: 1, Snapshot: first}, true, false},
+		{"chunk at wrong offset", types.RaftMessage{SnapshotIndex: 2, SnapshotTerm: 1, SnapshotOffset: 1, Snapshot: rest, SnapshotDone: true}, false, true},
+		{"first chunk again", types.RaftMessage{SnapshotIndex: 2, SnapshotTerm: 1, Snapshot: first}, true, false},
+		{"last chunk", types.RaftMessage{SnapshotIndex: 2, SnapshotTerm: 1, SnapshotOffset: uint64(len(first)), Snapshot: rest, SnapshotDone: true, Entries: entries(3, 1), LeaderCommit: 3}, true, false},
+	}
+
+	for _, tt := range tests {
+		tt.msg.Type = types.RaftInstallSnapshot
+		tt.msg.Term = 1
+		tt.msg.From = "a"
+		reply := n.handleInstallSnapshot(tt.msg)
+		if reply.Success != tt.want || reply.NeedSnapshot != tt.wantNeed {
+			t.Errorf("%s: got success %v need snapshot %v, want %v %v", tt.name, reply.Success, reply.NeedSnapshot, tt.want, tt.wantNeed)
+		}
+	}
+
+	if !n.Ready() {
+		t.Error("not ready after installing snapshot")
+	}
+	eventually(t, time.Second, "entry after snapshot to be applied", func() bool { return len(m.applied()) == 3 })
+	if want := []string{"command 1", "command 2", "command 3"}; !slices.Equal(m.applied(), want) {
+		t.Errorf("applied %v, want %v", m.applied(), want)
+	}
+}
+
+// TestRestart checks a restarted node keeps its term, vote, log and applied index, so it never votes twice in a term
+// nor applies an entry twice
+func TestRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	n := newTestNode(t, "b", []string{"a"}, dir, true, &machine{})
+	n.handleRequestVote(types.RaftMessage{Type: types.RaftRequestVote, Term: 1, From: "a"})
+	n.handleAppendEntries(types.RaftMessage{Type: types.RaftAppendEntries, Term: 1, From: "a", Entries: entries(1, 1, 1)})
+	n.handleAppendEntries(types.RaftMessage{Type: types.RaftAppendEntries, Term: 2, From: "a", PrevLogIndex: 1, PrevLogTerm: 1, Entries: entries(2, 2)})
+	n.mu.Lock()
+	n.lastApplied = 1
+	n.appendApplied(1)
+	n.mu.Unlock()
+
+	restarted := newTestNode(t, "b", []string{"a"}, dir, true, &machine{})
+
+	terms := []uint64{}
+	for _, entry := range restarted.log[1:] {
+		terms = append(terms, entry.Term)
+	}
+	if restarted.currentTerm != 2 || restarted.votedFor != "" {
+		t.Errorf("got term %d vote %q, want term 2 with no vote yet", restarted.currentTerm, restarted.votedFor)
+	}
+	if !slices.Equal(terms, []uint64{1, 2}) {
+		t.Errorf("got log terms %v, want [1 2] as entry 2 of term 1 was overwritten", terms)
+	}
+	if restarted.lastApplied != 1 || restarted.commitIndex != 1 {
+		t.Errorf("got applied %d committed %d, want 1 and 1", restarted.lastApplied, restarted.commitIndex)
+	}
+}
+
+// TestSnapshotRetry checks a leader waits before sending another snapshot to a peer that could not take the last one
+func TestSnapshotRetry(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := listener.Addr().String()
+	listener.Close() // nothing listens, so every message to the peer fails
+
+	n := newTestNode(t, "a", []string{down}, t.TempDir(), true, &machine{})
+	n.mu.Lock()
+	n.currentTerm = 1
+	n.becomeLeader()
+	n.needsSnapshot[down] = true
+	n.sendingSnapshot[down] = true
+	n.mu.Unlock()
+
+	n.sendSnapshot(down)
+
+	n.mu.Lock()
+	sending, next := n.sendingSnapshot[down], n.nextSnapshot[down]
+	n.mu.Unlock()
+	if sending || !next.After(time.Now()) {
+		t.Fatalf("got sending %v next snapshot at %v, want a snapshot only after a wait", sending, next)
+	}
+
+	n.replicateTo(down)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.sendingSnapshot[down] {
+		t.Error("sent another snapshot before the wait passed")
+	}
+}
+
+// TestCluster runs three nodes over TCP: they elect one leader, replicate every proposal in order, compact their logs
+// and bring a node that joins late up to date with a snapshot
+func TestCluster(t *testing.T) {
+	const size = 3
+
+	listeners := make([]net.Listener, size)
+	addresses := make([]string, size)
+	for i := range listeners {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners[i] = listener
+		addresses[i] = listener.Addr().String()
+	}
+	listeners[size-1].Close() // last node joins once the others compacted their logs
+
+	nodes := make([]*Node, size)
+	machines := make([]*machine, size)
+	start := func(i int, listener net.Listener) {
+		peers := slices.Delete(slices.Clone(addresses), i, i+1)
+		machines[i] = &machine{}
+		nodes[i] = newTestNode(t, addresses[i], peers, t.TempDir(), i < size-1, machines[i])
+
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go nodes[i].HandleConn(conn)
+			}
+		}()
+		go nodes[i].Run()
+		t.Cleanup(func() { listener.Close() })
+	}
+	for i := 0; i < size-1; i++ {
+		start(i, listeners[i])
+	}
+
+	leader := func() *Node {
+		for _, n := range nodes {
+			if n != nil && n.IsLeader() {
+				return n
+			}
+		}
+		return nil
+	}
+	eventually(t, 15*time.Second, "a leader to be elected", func() bool { return leader() != nil })
+
+	for _, n := range nodes[:size-1] {
+		if n != leader() {
+			if _, err := n.Propose([]byte("from follower"), time.Second); err != ErrNotLeader {
+				t.Errorf("proposing to a follower: got %v, want %v", err, ErrNotLeader)
+			}
+		}
+	}
+
+	proposals := compactThreshold + 10
+	want := []string{}
+	for i := 0; i < proposals; i++ {
+		command := fmt.Sprint("command ", i)
+		want = append(want, command)
+		if _, err := leader().Propose([]byte(command), 5*time.Second); err != nil {
+			t.Fatalf("proposing %s: %v", command, err)
+		}
+	}
+
+	for i := 0; i < size-1; i++ {
+		eventually(t, 5*time.Second, "proposals to be applied on every node", func() bool { return len(machines[i].applied()) == proposals })
+		if !slices.Equal(machines[i].applied(), want) {
+			t.Errorf("node %d applied proposals out of order", i)
+		}
+	}
+
+	l := leader()
+	l.mu.Lock()
+	compacted := l.firstIndex() > 0
+	l.mu.Unlock()
+	if !compacted {
+		t.Fatalf("leader did not compact its log after %d entries", proposals)
+	}
+
+	listener, err := net.Listen("tcp", addresses[size-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	start(size-1, listener)
+
+	eventually(t, 20*time.Second, "the late node to catch up", func() bool { return len(machines[size-1].applied()) == proposals })
+	if !slices.Equal(machines[size-1].applied(), want) {
+		t.Error("late node applied a different history")
+	}
+	if !nodes[size-1].Ready() {
+		t.Error("late node is not ready after catching up")
+	}
+}
@@ -0,0 +1,206 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sjsu-pub-sub/types"
+	"strings"
+)
+
+// term and vote, rewritten whenever either changes
+type persistentState struct {
+	CurrentTerm uint64 `json:"currentTerm"`
+	VotedFor    string `json:"votedFor"`
+}
+
+// single line of the log file. The first record of the file is the sentinel entry, and every entry record after it
+// replaces the entry at its index and everything after it, so entries a new leader overwrote are dropped on replay
+type logRecord struct {
+	Entry   *types.LogEntry `json:"entry,omitempty"`
+	Applied uint64          `json:"applied,omitempty"` // every entry up to this index has been applied
+}
+
+// logPath() returns the file the log is appended to, next to the state file: raft.json keeps its log in raft.log
+func logPath(statePath string) string {
+	path := strings.TrimSuffix(statePath, filepath.Ext(statePath)) + ".log"
+	if path == statePath {
+		path += ".log"
+	}
+	return path
+}
+
+// readState() reads the term and vote persisted at path, or returns the zero state if nothing was persisted yet
+func readState(path string) (persistentState, error) {
+	var ps persistentState
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ps, nil
+	}
+	if err != nil {
+		return ps, fmt.Errorf("failed to read raft state: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &ps); err != nil {
+		return ps, fmt.Errorf("failed to decode raft state: %v", err)
+	}
+
+	return ps, nil
+}
+
+// readLog() replays the log file at path, returning the log starting with its sentinel and the last applied index.
+// Returns a nil log if there is no log file yet, and complete false if the last record was cut short by a crash
+func readLog(path string) ([]types.LogEntry, uint64, bool, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, true, nil
+	}
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to open raft log: %v", err)
+	}
+	defer file.Close()
+
+	log := []types.LogEntry{}
+	var lastApplied uint64
+
+	decoder := json.NewDecoder(file)
+	for {
+		var record logRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil { // entries are synced before they are acknowledged, so a cut short record was never relied on
+			fmt.Println("Dropping incomplete record at the end of the raft log:", err)
+			if len(log) == 0 {
+				return nil, 0, false, nil
+			}
+			return log, lastApplied, false, nil
+		}
+
+		if entry := record.Entry; entry != nil {
+			switch {
+			case len(log) == 0:
+				log = append(log, *entry)
+			case entry.Index > log[0].Index && entry.Index <= log[len(log)-1].Index+1:
+				log = append(log[:entry.Index-log[0].Index], *entry)
+			default:
+				return nil, 0, false, fmt.Errorf("raft log entry %d does not follow entry %d", entry.Index, log[len(log)-1].Index)
+			}
+		}
+		lastApplied = max(lastApplied, record.Applied)
+	}
+
+	if len(log) == 0 {
+		return nil, 0, false, fmt.Errorf("raft log %s has no sentinel entry", path)
+	}
+
+	return log, lastApplied, true, nil
+}
+
+// saveState() writes term and vote to disk before replying to any peer. Caller must hold n.mu
+func (n *Node) saveState() {
+	data, err := json.Marshal(persistentState{CurrentTerm: n.currentTerm, VotedFor: n.votedFor})
+	if err != nil {
+		fmt.Println("Error marshalling raft state:", err)
+		return
+	}
+
+	if err := writeFileAtomic(n.statePath, data); err != nil {
+		fmt.Println("Error writing raft state:", err)
+	}
+}
+
+// appendLog() appends entries to the log file and syncs it before replying to any peer. Caller must hold n.mu
+func (n *Node) appendLog(entries ...types.LogEntry) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := range entries {
+		if err := encoder.Encode(logRecord{Entry: &entries[i]}); err != nil {
+			fmt.Println("Error marshalling raft log entry:", err)
+			return
+		}
+	}
+
+	if _, err := n.logFile.Write(buf.Bytes()); err != nil {
+		fmt.Println("Error writing raft log:", err)
+		return
+	}
+	if err := n.logFile.Sync(); err != nil {
+		fmt.Println("Error syncing raft log:", err)
+	}
+}
+
+// appendApplied() records that every entry up to index has been applied. It is not synced, since losing it only
+// makes a restarted server apply the last few entries again, which the stores already have no effect for. Caller must
+// hold n.mu
+func (n *Node) appendApplied(index uint64) {
+	data, err := json.Marshal(logRecord{Applied: index})
+	if err != nil {
+		fmt.Println("Error marshalling raft applied index:", err)
+		return
+	}
+
+	if _, err := n.logFile.Write(append(data, '\n')); err != nil {
+		fmt.Println("Error writing raft log:", err)
+	}
+}
+
+// rewriteLog() replaces the log file with the current log and applied index, after compaction or installing a
+// snapshot dropped entries from the front of the log. Caller must hold n.mu
+func (n *Node) rewriteLog() {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := range n.log {
+		if err := encoder.Encode(logRecord{Entry: &n.log[i]}); err != nil {
+			fmt.Println("Error marshalling raft log entry:", err)
+			return
+		}
+	}
+	if err := encoder.Encode(logRecord{Applied: n.lastApplied}); err != nil {
+		fmt.Println("Error marshalling raft applied index:", err)
+		return
+	}
+
+	if err := writeFileAtomic(n.logPath, buf.Bytes()); err != nil {
+		fmt.Println("Error writing raft log:", err)
+		return
+	}
+
+	file, err := os.OpenFile(n.logPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Println("Error opening raft log:", err)
+		return
+	}
+	if n.logFile != nil {
+		n.logFile.Close()
+	}
+	n.logFile = file
+}
+
+// writeFileAtomic() replaces the file at path with data, so a crash leaves either the old or the new file
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
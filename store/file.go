@@ -0,0 +1,645 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sjsu-pub-sub/types"
+	"sort"
+	"sync"
+)
+
+// kinds of fileRecord appended to the log
+const (
+	recordCreateUser  = "createuser"
+	recordSetPassword = "setpassword"
+	recordJoinGroup   = "joingroup"
+	recordLeaveGroup  = "leavegroup"
+	recordAddPost     = "addpost"
+	recordCreateGroup = "creategroup"
+	recordDeleteGroup = "deletegroup"
+	recordSetOwner    = "setowner"
+	recordSetACL      = "setacl"
+	recordSetKey      = "setpublickey"
+	recordEncryption  = "setencryption"
+	recordOffset      = "commitoffset"
+	recordSnapshot    = "snapshot" // replaces everything before it
+)
+
+// single change appended to a FileStore's log, one JSON object per line
+type fileRecord struct {
+	Op         string                 `json:"op"`
+	Username   string                 `json:"username,omitempty"`
+	Group      string                 `json:"group,omitempty"`
+	Post       *types.Post            `json:"post,omitempty"`
+	Offset     uint64                 `json:"offset,omitempty"`
+	Acked      []uint64               `json:"acked,omitempty"`    // posts received after Offset
+	Password   string                 `json:"password,omitempty"` // password hash
+	ACL        *types.GroupACL        `json:"acl,omitempty"`
+	Key        string                 `json:"key,omitempty"` // public key
+	Encryption *types.GroupEncryption `json:"encryption,omitempty"`
+	Snapshot   *types.Snapshot        `json:"snapshot,omitempty"`
+}
+
+// FileStore keeps users, groups, posts and offsets in memory, and appends every change to a log file it replays on startup.
+// It needs no database, so servers can run anywhere
+type FileStore struct {
+	sync.RWMutex
+	path    string
+	file    *os.File // nil if store is in memory only
+	users   map[string]*types.User
+	groups  map[string]*types.Group
+	posts   map[string][]types.Post            // posts of each group in id order
+	offsets map[string]map[string]types.Offset // committed offset of each user (key) and group (inner key)
+}
+
+// NewFileStore() opens the log at path, creating it if needed, and replays it. An empty path keeps
+// everything in memory only
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		users:   make(map[string]*types.User),
+		groups:  make(map[string]*types.Group),
+		posts:   make(map[string][]types.Post),
+		offsets: make(map[string]map[string]types.Offset),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store file: %v", err)
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024) // snapshot records hold the whole store
+	for scanner.Scan() {
+		var record fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to decode store record: %v", err)
+		}
+		s.apply(record)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read store file: %v", err)
+	}
+
+	s.path = path
+	s.file = file
+
+	return s, nil
+}
+
+func (s *FileStore) CreateUser(username string, passwordHash string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.users[username]; ok {
+		return ErrUserExists
+	}
+
+	return s.append(fileRecord{Op: recordCreateUser, Username: username, Password: passwordHash})
+}
+
+func (s *FileStore) SetPasswordHash(username string, passwordHash string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.users[username]; !ok {
+		return ErrUserNotFound
+	}
+
+	return s.append(fileRecord{Op: recordSetPassword, Username: username, Password: passwordHash})
+}
+
+func (s *FileStore) SetPublicKey(username string, publicKey string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.users[username]; !ok {
+		return ErrUserNotFound
+	}
+
+	return s.append(fileRecord{Op: recordSetKey, Username: username, Key: publicKey})
+}
+
+func (s *FileStore) GetUser(username string) (types.User, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return types.User{}, ErrUserNotFound
+	}
+
+	return copyUser(user), nil
+}
+
+func (s *FileStore) UserExists(username string) (bool, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, ok := s.users[username]
+	return ok, nil
+}
+
+func (s *FileStore) ListGroups() ([]types.Group, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var groups []types.Group
+	for _, group := range s.groups {
+		groups = append(groups, copyGroup(group))
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].GroupName < groups[j].GroupName
+	})
+
+	return groups, nil
+}
+
+func (s *FileStore) ListGroupSummaries(viewer string) ([]types.GroupSummary, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	summaries := []types.GroupSummary{}
+	for _, group := range s.groups {
+		if group.VisibleTo(viewer) {
+			summaries = append(summaries, group.Summary())
+		}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].GroupName < summaries[j].GroupName
+	})
+
+	return summaries, nil
+}
+
+func (s *FileStore) GetGroup(name string) (types.Group, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	group, ok := s.groups[name]
+	if !ok {
+		return types.Group{}, ErrGroupNotFound
+	}
+
+	return copyGroup(group), nil
+}
+
+func (s *FileStore) CreateGroup(name string, creator string, visibility string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.groups[name]; ok {
+		return ErrGroupExists
+	}
+
+	return s.append(fileRecord{Op: recordCreateGroup, Username: creator, Group: name, ACL: &types.GroupACL{Visibility: visibility}})
+}
+
+func (s *FileStore) DeleteGroup(name string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.groups[name]; !ok {
+		return ErrGroupNotFound
+	}
+
+	return s.append(fileRecord{Op: recordDeleteGroup, Group: name})
+}
+
+func (s *FileStore) SetGroupOwner(name string, owner string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.groups[name]; !ok {
+		return ErrGroupNotFound
+	}
+
+	return s.append(fileRecord{Op: recordSetOwner, Username: owner, Group: name})
+}
+
+func (s *FileStore) SetGroupACL(name string, acl types.GroupACL) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.groups[name]; !ok {
+		return ErrGroupNotFound
+	}
+
+	return s.append(fileRecord{Op: recordSetACL, Group: name, ACL: &acl})
+}
+
+func (s *FileStore) SetGroupEncryption(name string, encryption types.GroupEncryption) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.groups[name]; !ok {
+		return ErrGroupNotFound
+	}
+
+	return s.append(fileRecord{Op: recordEncryption, Group: name, Encryption: &encryption})
+}
+
+func (s *FileStore) JoinGroup(username string, group string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.groups[group]; !ok {
+		return ErrGroupNotFound
+	}
+
+	return s.append(fileRecord{Op: recordJoinGroup, Username: username, Group: group})
+}
+
+func (s *FileStore) LeaveGroup(username string, group string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.groups[group]; !ok {
+		return ErrGroupNotFound
+	}
+
+	return s.append(fileRecord{Op: recordLeaveGroup, Username: username, Group: group})
+}
+
+func (s *FileStore) AddPost(post types.Post) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.groups[post.Group]; !ok {
+		return ErrGroupNotFound
+	}
+
+	posts := s.posts[post.Group]
+	if post.Id > 0 && len(posts) > 0 && posts[len(posts)-1].Id >= post.Id { // post already added
+		return nil
+	}
+
+	return s.append(fileRecord{Op: recordAddPost, Post: &post})
+}
+
+func (s *FileStore) ListPosts(group string, query PostQuery) ([]types.Post, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if _, ok := s.groups[group]; !ok {
+		return nil, ErrGroupNotFound
+	}
+
+	posts := []types.Post{}
+	for _, post := range s.posts[group] {
+		if len(posts) >= query.Limit {
+			break
+		}
+		if query.matches(post) {
+			posts = append(posts, post)
+		}
+	}
+
+	return posts, nil
+}
+
+func (s *FileStore) CommitOffset(username string, group string, offset uint64) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.groups[group]; !ok {
+		return ErrGroupNotFound
+	}
+
+	current := s.offsets[username][group]
+	if current.Offset >= offset { // only ever move the offset forward
+		return nil
+	}
+
+	var acked []uint64
+	for _, id := range current.Acked {
+		if id > offset { // ids up to offset are now covered by it
+			acked = append(acked, id)
+		}
+	}
+
+	return s.append(fileRecord{Op: recordOffset, Username: username, Group: group, Offset: offset, Acked: acked})
+}
+
+func (s *FileStore) SetOffset(offset types.Offset) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.groups[offset.Group]; !ok {
+		return ErrGroupNotFound
+	}
+
+	return s.append(fileRecord{Op: recordOffset, Username: offset.Username, Group: offset.Group, Offset: offset.Offset, Acked: offset.Acked})
+}
+
+func (s *FileStore) GetOffsets(username string) (map[string]types.Offset, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	offsets := make(map[string]types.Offset)
+	for group, offset := range s.offsets[username] {
+		offsets[group] = copyOffset(offset)
+	}
+
+	return offsets, nil
+}
+
+func (s *FileStore) Snapshot() (types.Snapshot, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.snapshot(), nil
+}
+
+// Restore() replaces the store with snapshot, and rewrites the log as a single snapshot record
+func (s *FileStore) Restore(snapshot types.Snapshot) error {
+	s.Lock()
+	defer s.Unlock()
+
+	record := fileRecord{Op: recordSnapshot, Snapshot: &snapshot}
+	if s.file != nil {
+		if err := s.rewrite(record); err != nil {
+			return err
+		}
+	}
+
+	s.apply(record)
+	return nil
+}
+
+func (s *FileStore) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// append() writes record to the log before applying it, so a crash never loses an applied change. Caller must hold lock
+func (s *FileStore) append(record fileRecord) error {
+	if s.file != nil {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode store record: %v", err)
+		}
+
+		if _, err := s.file.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write store record: %v", err)
+		}
+		if err := s.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync store file: %v", err)
+		}
+	}
+
+	s.apply(record)
+	return nil
+}
+
+// rewrite() replaces the log with a single record. The record is written to a temporary file in the same directory,
+// synced and renamed over the log, so a crash leaves either the old log or the new one, never an empty one. Caller
+// must hold lock
+func (s *FileStore) rewrite(record fileRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode store record: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create store file: %v", err)
+	}
+	defer os.Remove(tmp.Name()) // no longer exists once renamed
+
+	_, err = tmp.Write(append(data, '\n'))
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write store file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace store file: %v", err)
+	}
+	if dir, err := os.Open(filepath.Dir(s.path)); err == nil { // persist the rename itself
+		dir.Sync()
+		dir.Close()
+	}
+
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen store file: %v", err)
+	}
+	s.file.Close()
+	s.file = file
+
+	return nil
+}
+
+// apply() updates the in-memory index with a record. Caller must hold lock
+func (s *FileStore) apply(record fileRecord) {
+	switch record.Op {
+	case recordCreateUser:
+		s.users[record.Username] = &types.User{Username: record.Username, Groups: []string{}, PasswordHash: record.Password}
+	case recordSetPassword:
+		s.users[record.Username].PasswordHash = record.Password
+	case recordSetKey:
+		s.users[record.Username].PublicKey = record.Key
+	case recordJoinGroup:
+		group := s.groups[record.Group]
+		group.GroupMates = addString(group.GroupMates, record.Username) // add user to groupmates of group
+		if user, ok := s.users[record.Username]; ok {
+			user.Groups = addString(user.Groups, record.Group) // add group to groups of user
+		}
+	case recordLeaveGroup:
+		group := s.groups[record.Group]
+		group.GroupMates = removeString(group.GroupMates, record.Username) // remove user from groupmates of group
+		if user, ok := s.users[record.Username]; ok {
+			user.Groups = removeString(user.Groups, record.Group) // remove group from groups of user
+		}
+	case recordAddPost:
+		s.posts[record.Post.Group] = append(s.posts[record.Post.Group], *record.Post) // append post to posts of group
+	case recordCreateGroup:
+		s.groups[record.Group] = &types.Group{
+			GroupName:  record.Group,
+			Creator:    record.Username,
+			Owner:      record.Username,
+			GroupMates: []string{},
+			ACL:        copyACL(*record.ACL),
+		}
+	case recordDeleteGroup:
+		for _, mate := range s.groups[record.Group].GroupMates {
+			if user, ok := s.users[mate]; ok {
+				user.Groups = removeString(user.Groups, record.Group) // remove group from groups of all its groupmates
+			}
+		}
+		delete(s.groups, record.Group)
+		delete(s.posts, record.Group)
+		for _, offsets := range s.offsets {
+			delete(offsets, record.Group)
+		}
+	case recordSetOwner:
+		s.groups[record.Group].Owner = record.Username
+	case recordSetACL:
+		s.groups[record.Group].ACL = copyACL(*record.ACL)
+	case recordEncryption:
+		s.groups[record.Group].Encryption = copyEncryption(*record.Encryption)
+	case recordOffset:
+		if s.offsets[record.Username] == nil {
+			s.offsets[record.Username] = make(map[string]types.Offset)
+		}
+		s.offsets[record.Username][record.Group] = copyOffset(types.Offset{
+			Username: record.Username,
+			Group:    record.Group,
+			Offset:   record.Offset,
+			Acked:    record.Acked,
+		})
+	case recordSnapshot:
+		s.users = make(map[string]*types.User)
+		for _, user := range record.Snapshot.Users {
+			user := copyUser(&user)
+			s.users[user.Username] = &user
+		}
+		s.groups = make(map[string]*types.Group)
+		s.posts = make(map[string][]types.Post)
+		for _, group := range record.Snapshot.Groups {
+			copied := copyGroup(&group)
+			s.groups[copied.GroupName] = &copied
+		}
+		for _, post := range record.Snapshot.Posts {
+			s.posts[post.Group] = append(s.posts[post.Group], post)
+		}
+		s.offsets = make(map[string]map[string]types.Offset)
+		for _, offset := range record.Snapshot.Offsets {
+			if s.offsets[offset.Username] == nil {
+				s.offsets[offset.Username] = make(map[string]types.Offset)
+			}
+			s.offsets[offset.Username][offset.Group] = copyOffset(offset)
+		}
+	}
+}
+
+// snapshot() copies all users, groups, posts and offsets. Caller must hold lock
+func (s *FileStore) snapshot() types.Snapshot {
+	snapshot := types.Snapshot{
+		Users:   []types.User{},
+		Groups:  []types.Group{},
+		Posts:   []types.Post{},
+		Offsets: []types.Offset{},
+	}
+
+	for _, user := range s.users {
+		snapshot.Users = append(snapshot.Users, copyUser(user))
+	}
+	for _, group := range s.groups {
+		snapshot.Groups = append(snapshot.Groups, copyGroup(group))
+	}
+	for _, posts := range s.posts {
+		snapshot.Posts = append(snapshot.Posts, posts...)
+	}
+
+	sort.SliceStable(snapshot.Posts, func(i, j int) bool {
+		return snapshot.Posts[i].Id < snapshot.Posts[j].Id
+	})
+	for _, offsets := range s.offsets {
+		for _, offset := range offsets {
+			snapshot.Offsets = append(snapshot.Offsets, copyOffset(offset))
+		}
+	}
+
+	return snapshot
+}
+
+func copyUser(user *types.User) types.User {
+	return types.User{
+		Username:     user.Username,
+		Groups:       append([]string{}, user.Groups...),
+		PasswordHash: user.PasswordHash,
+		PublicKey:    user.PublicKey,
+	}
+}
+
+func copyGroup(group *types.Group) types.Group {
+	return types.Group{
+		GroupName:  group.GroupName,
+		Creator:    group.Creator,
+		Owner:      group.Owner,
+		GroupMates: append([]string{}, group.GroupMates...),
+		ACL:        copyACL(group.ACL),
+		Encryption: copyEncryption(group.Encryption),
+	}
+}
+
+func copyACL(acl types.GroupACL) types.GroupACL {
+	copied := types.GroupACL{Visibility: acl.Visibility}
+	if len(acl.Roles) > 0 {
+		copied.Roles = make(map[string]string, len(acl.Roles))
+		for username, role := range acl.Roles {
+			copied.Roles[username] = role
+		}
+	}
+	if len(acl.Invited) > 0 {
+		copied.Invited = append([]string{}, acl.Invited...)
+	}
+	if len(acl.Requested) > 0 {
+		copied.Requested = append([]string{}, acl.Requested...)
+	}
+	return copied
+}
+
+func copyEncryption(encryption types.GroupEncryption) types.GroupEncryption {
+	copied := types.GroupEncryption{Enabled: encryption.Enabled}
+	for _, key := range encryption.Keys {
+		sealed := make(map[string]string, len(key.Sealed))
+		for username, value := range key.Sealed {
+			sealed[username] = value
+		}
+		copied.Keys = append(copied.Keys, types.GroupKey{Epoch: key.Epoch, Sealed: sealed})
+	}
+	return copied
+}
+
+func copyOffset(offset types.Offset) types.Offset {
+	copied := offset
+	copied.Acked = nil
+	if len(offset.Acked) > 0 {
+		copied.Acked = append([]uint64{}, offset.Acked...)
+	}
+	return copied
+}
+
+// addString() appends value to list unless it is already there
+func addString(list []string, value string) []string {
+	for _, elem := range list {
+		if elem == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// removeString() returns list without any occurrence of value
+func removeString(list []string, value string) []string {
+	result := []string{}
+	for _, elem := range list {
+		if elem != value {
+			result = append(result, elem)
+		}
+	}
+	return result
+}
@@ -0,0 +1,248 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"sjsu-pub-sub/types"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fill() writes a user, a group with a groupmate, posts and an offset to a store
+func fill(t *testing.T, s Store) {
+	t.Helper()
+
+	steps := []struct {
+		name string
+		err  error
+	}{
+		{"create alice", s.CreateUser("alice", "hash")},
+		{"create bob", s.CreateUser("bob", "hash")},
+		{"create group", s.CreateGroup("books", "alice", types.VisibilityPublic)},
+		{"alice joins", s.JoinGroup("alice", "books")},
+		{"bob joins", s.JoinGroup("bob", "books")},
+		{"first post", s.AddPost(types.Post{Id: types.PostId(5), Group: "books", Author: "alice", Body: "one", Timestamp: time.Unix(100, 0).UTC()})},
+		{"second post", s.AddPost(types.Post{Id: types.PostId(7), Group: "books", Author: "bob", Body: "two", Timestamp: time.Unix(200, 0).UTC()})},
+		{"second post again", s.AddPost(types.Post{Id: types.PostId(7), Group: "books", Author: "bob", Body: "two", Timestamp: time.Unix(200, 0).UTC()})},
+		{"bob's offset", s.SetOffset(types.Offset{Username: "bob", Group: "books", Offset: types.PostId(4), Acked: []uint64{types.PostId(7)}})},
+	}
+	for _, step := range steps {
+		if step.err != nil {
+			t.Fatalf("%s: %v", step.name, step.err)
+		}
+	}
+}
+
+func TestFileStoreErrors(t *testing.T) {
+	s, err := NewFileStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, s)
+
+	_, getUserErr := s.GetUser("carol")
+	_, getGroupErr := s.GetGroup("films")
+	_, listErr := s.ListPosts("films", PostQuery{Limit: 10})
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"create existing user", s.CreateUser("alice", "hash"), ErrUserExists},
+		{"create existing group", s.CreateGroup("books", "bob", types.VisibilityPublic), ErrGroupExists},
+		{"get unknown user", getUserErr, ErrUserNotFound},
+		{"get unknown group", getGroupErr, ErrGroupNotFound},
+		{"join unknown group", s.JoinGroup("alice", "films"), ErrGroupNotFound},
+		{"post to unknown group", s.AddPost(types.Post{Id: types.PostId(9), Group: "films"}), ErrGroupNotFound},
+		{"list posts of unknown group", listErr, ErrGroupNotFound},
+		{"set password of unknown user", s.SetPasswordHash("carol", "hash"), ErrUserNotFound},
+		{"leave group not joined", s.LeaveGroup("carol", "books"), nil},
+	}
+
+	for _, tt := range tests {
+		if tt.err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.err, tt.want)
+		}
+	}
+}
+
+func TestFileStoreQueries(t *testing.T) {
+	s, err := NewFileStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, s)
+
+	tests := []struct {
+		name  string
+		query PostQuery
+		want  []string
+	}{
+		{"all", PostQuery{Limit: 10}, []string{"one", "two"}},
+		{"limit", PostQuery{Limit: 1}, []string{"one"}},
+		{"after", PostQuery{After: types.PostId(5), Limit: 10}, []string{"two"}},
+		{"author", PostQuery{Author: "bob", Limit: 10}, []string{"two"}},
+		{"since", PostQuery{Since: time.Unix(200, 0), Limit: 10}, []string{"two"}},
+		{"until", PostQuery{Until: time.Unix(200, 0), Limit: 10}, []string{"one"}},
+	}
+
+	for _, tt := range tests {
+		posts, err := s.ListPosts("books", tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		got := []string{}
+		for _, post := range posts {
+			got = append(got, post.Body)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileStoreOffsets(t *testing.T) {
+	s, err := NewFileStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, s)
+
+	tests := []struct {
+		name      string
+		commit    uint64
+		wantAt    uint64
+		wantAcked []uint64
+	}{
+		{"commit lower offset", types.PostId(2), types.PostId(4), []uint64{types.PostId(7)}},
+		{"commit past acked post", types.PostId(7), types.PostId(7), nil},
+	}
+
+	for _, tt := range tests {
+		if err := s.CommitOffset("bob", "books", tt.commit); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		offsets, err := s.GetOffsets("bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := offsets["books"]; got.Offset != tt.wantAt || !slices.Equal(got.Acked, tt.wantAcked) {
+			t.Errorf("%s: got offset %d acked %v, want %d acked %v", tt.name, got.Offset, got.Acked, tt.wantAt, tt.wantAcked)
+		}
+	}
+}
+
+// TestFileStoreReplay checks a store reopened from its log holds everything written before it was closed
+func TestFileStoreReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pubsub.log")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, s)
+	if err := s.LeaveGroup("alice", "books"); err != nil {
+		t.Fatal(err)
+	}
+	want, err := s.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	got, err := reopened.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := reopened.GetGroup("books")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(group.GroupMates, []string{"bob"}) {
+		t.Errorf("groupmates after replay: got %v, want [bob]", group.GroupMates)
+	}
+	if len(got.Users) != len(want.Users) || len(got.Posts) != len(want.Posts) || len(got.Offsets) != len(want.Offsets) {
+		t.Errorf("replayed %d users, %d posts and %d offsets, want %d, %d and %d", len(got.Users), len(got.Posts), len(got.Offsets), len(want.Users), len(want.Posts), len(want.Offsets))
+	}
+	if len(got.Posts) != 2 {
+		t.Errorf("replayed %d posts, want 2 as adding a post twice has no effect", len(got.Posts))
+	}
+}
+
+// TestFileStoreRestore checks a restored store rewrites its log in place of the old one, and keeps appending to it
+func TestFileStoreRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pubsub.log")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateUser("carol", "hash"); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := NewFileStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, source)
+	snapshot, err := source.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateUser("dave", "hash"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files after restoring, want only the log", len(entries))
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	tests := []struct {
+		username string
+		want     error
+	}{
+		{"alice", nil},
+		{"bob", nil},
+		{"dave", nil},
+		{"carol", ErrUserNotFound},
+	}
+
+	for _, tt := range tests {
+		if _, err := reopened.GetUser(tt.username); err != tt.want {
+			t.Errorf("%s after restoring and reopening: got %v, want %v", tt.username, err, tt.want)
+		}
+	}
+
+	posts, err := reopened.ListPosts("books", PostQuery{Limit: 10})
+	if err != nil || len(posts) != 2 {
+		t.Errorf("got %d posts, %v after restoring and reopening, want 2", len(posts), err)
+	}
+}
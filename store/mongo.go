@@ -0,0 +1,770 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sjsu-pub-sub/types"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	restoreSuffix    = "_restore" // staging collections a snapshot is loaded into before replacing the live ones
+	restoreBatchSize = 1000       // documents inserted at once while restoring a snapshot
+)
+
+// MongoStore keeps users, groups, posts and offsets in the Users, Groups, Posts and Offsets collections of a MongoDB
+// database
+type MongoStore struct {
+	client *mongo.Client
+	db     *mongo.Database
+}
+
+// NewMongoStore() makes a connection to a MongoDB instance and uses the named database
+func NewMongoStore(uri string, database string) (*MongoStore, error) {
+	clientOptions := options.Client().ApplyURI(uri)
+
+	ctx := context.TODO()
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &MongoStore{
+		client: client,
+		db:     client.Database(database),
+	}
+
+	if err := s.createIndexes(""); err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// createIndexes() makes sure posts can be looked up by group and id, optionally filtered by author, without a
+// collection scan, on the collections whose names end in suffix. Creating an index that already exists has no effect
+func (s *MongoStore) createIndexes(suffix string) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "group", Value: 1}, {Key: "id", Value: 1}}},
+		{Keys: bson.D{{Key: "group", Value: 1}, {Key: "author", Value: 1}, {Key: "id", Value: 1}}},
+	}
+
+	_, err := s.db.Collection("Posts"+suffix).Indexes().CreateMany(context.TODO(), indexes)
+	if err != nil {
+		return fmt.Errorf("Error creating Posts indexes: %v", err)
+	}
+
+	offsetsIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}, {Key: "group", Value: 1}},
+		Options: options.Index().SetUnique(true), // one offset per user and group
+	}
+
+	_, err = s.db.Collection("Offsets"+suffix).Indexes().CreateOne(context.TODO(), offsetsIndex)
+	if err != nil {
+		return fmt.Errorf("Error creating Offsets indexes: %v", err)
+	}
+
+	return nil
+}
+
+func (s *MongoStore) CreateUser(username string, passwordHash string) error {
+	exists, err := s.UserExists(username)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrUserExists
+	}
+
+	newUser := types.User{
+		Username:     username,
+		Groups:       []string{},
+		PasswordHash: passwordHash,
+	}
+
+	_, err = s.db.Collection("Users").InsertOne(context.Background(), newUser)
+	if err != nil {
+		return fmt.Errorf("Error inserting username: %v", err)
+	}
+
+	return nil
+}
+
+func (s *MongoStore) SetPasswordHash(username string, passwordHash string) error {
+	filter := bson.M{"username": username}
+
+	update := bson.M{
+		"$set": bson.M{
+			"passwordHash": passwordHash,
+		},
+	}
+
+	result, err := s.db.Collection("Users").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("Error updating Users table: %v", err)
+	}
+
+	if result.MatchedCount == 0 { // check if user exists
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoStore) SetPublicKey(username string, publicKey string) error {
+	filter := bson.M{"username": username}
+
+	update := bson.M{
+		"$set": bson.M{
+			"publicKey": publicKey,
+		},
+	}
+
+	result, err := s.db.Collection("Users").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("Error updating Users table: %v", err)
+	}
+
+	if result.MatchedCount == 0 { // check if user exists
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoStore) GetUser(username string) (types.User, error) {
+	var user types.User
+
+	err := s.db.Collection("Users").FindOne(context.Background(), bson.M{"username": username}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, ErrUserNotFound
+	}
+	if err != nil {
+		return user, fmt.Errorf("Error retrieving user: %v", err)
+	}
+
+	return user, nil
+}
+
+func (s *MongoStore) UserExists(username string) (bool, error) {
+	count, err := s.db.Collection("Users").CountDocuments(context.Background(), bson.M{"username": username}) // get all users with input username
+	if err != nil {
+		return false, fmt.Errorf("Error checking username: %v", err)
+	}
+
+	return count > 0, nil
+}
+
+func (s *MongoStore) ListGroups() ([]types.Group, error) {
+	var groups []types.Group
+
+	ctx := context.TODO()
+
+	cursor, err := s.db.Collection("Groups").Find(ctx, bson.M{}) // get all groups
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving groups: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var group types.Group
+		if err := cursor.Decode(&group); err != nil {
+			return nil, fmt.Errorf("Error decoding group document: %v", err)
+		}
+		groups = append(groups, group)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("Error iterating through groups: %v", err)
+	}
+
+	return groups, nil
+}
+
+func (s *MongoStore) ListGroupSummaries(viewer string) ([]types.GroupSummary, error) {
+	ctx := context.TODO()
+
+	opts := options.Find().SetProjection(bson.M{"posts": 0}) // leave out posts, which can be large
+
+	cursor, err := s.db.Collection("Groups").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving groups: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	summaries := []types.GroupSummary{}
+	for cursor.Next(ctx) {
+		var group types.Group
+		if err := cursor.Decode(&group); err != nil {
+			return nil, fmt.Errorf("Error decoding group document: %v", err)
+		}
+		if group.VisibleTo(viewer) {
+			summaries = append(summaries, group.Summary())
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("Error iterating through groups: %v", err)
+	}
+
+	return summaries, nil
+}
+
+func (s *MongoStore) GetGroup(name string) (types.Group, error) {
+	var group types.Group
+
+	err := s.db.Collection("Groups").FindOne(context.Background(), bson.M{"groupname": name}).Decode(&group)
+	if err == mongo.ErrNoDocuments {
+		return group, ErrGroupNotFound
+	}
+	if err != nil {
+		return group, fmt.Errorf("Error retrieving group: %v", err)
+	}
+
+	return group, nil
+}
+
+func (s *MongoStore) CreateGroup(name string, creator string, visibility string) error {
+	groupsCollection := s.db.Collection("Groups")
+
+	count, err := groupsCollection.CountDocuments(context.Background(), bson.M{"groupname": name}) // check if group exists
+	if err != nil {
+		return fmt.Errorf("Error validating group name: %v", err)
+	}
+
+	if count > 0 {
+		return ErrGroupExists
+	}
+
+	newGroup := types.Group{
+		GroupName:  name,
+		Creator:    creator,
+		Owner:      creator,
+		GroupMates: []string{},
+		ACL:        types.GroupACL{Visibility: visibility},
+	}
+
+	_, err = groupsCollection.InsertOne(context.Background(), newGroup)
+	if err != nil {
+		return fmt.Errorf("Error inserting group: %v", err)
+	}
+
+	return nil
+}
+
+func (s *MongoStore) DeleteGroup(name string) error {
+	result, err := s.db.Collection("Groups").DeleteOne(context.Background(), bson.M{"groupname": name})
+	if err != nil {
+		return fmt.Errorf("Error deleting group: %v", err)
+	}
+
+	if result.DeletedCount == 0 { // check if group exists
+		return ErrGroupNotFound
+	}
+
+	_, err = s.db.Collection("Posts").DeleteMany(context.Background(), bson.M{"group": name})
+	if err != nil {
+		return fmt.Errorf("Error updating Posts table: %v", err)
+	}
+
+	_, err = s.db.Collection("Offsets").DeleteMany(context.Background(), bson.M{"group": name})
+	if err != nil {
+		return fmt.Errorf("Error updating Offsets table: %v", err)
+	}
+
+	filter := bson.M{"groups": name}
+
+	update := bson.M{
+		"$pull": bson.M{
+			"groups": name, // remove group from groups of all its groupmates
+		},
+	}
+
+	_, err = s.db.Collection("Users").UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("Error updating Users table: %v", err)
+	}
+
+	return nil
+}
+
+func (s *MongoStore) SetGroupOwner(name string, owner string) error {
+	filter := bson.M{"groupname": name}
+
+	update := bson.M{
+		"$set": bson.M{
+			"owner": owner,
+		},
+	}
+
+	result, err := s.db.Collection("Groups").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("Error updating Groups table: %v", err)
+	}
+
+	if result.MatchedCount == 0 { // check if group exists
+		return ErrGroupNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoStore) SetGroupACL(name string, acl types.GroupACL) error {
+	filter := bson.M{"groupname": name}
+
+	update := bson.M{
+		"$set": bson.M{
+			"acl": acl,
+		},
+	}
+
+	result, err := s.db.Collection("Groups").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("Error updating Groups table: %v", err)
+	}
+
+	if result.MatchedCount == 0 { // check if group exists
+		return ErrGroupNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoStore) SetGroupEncryption(name string, encryption types.GroupEncryption) error {
+	filter := bson.M{"groupname": name}
+
+	update := bson.M{
+		"$set": bson.M{
+			"encryption": encryption,
+		},
+	}
+
+	result, err := s.db.Collection("Groups").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("Error updating Groups table: %v", err)
+	}
+
+	if result.MatchedCount == 0 { // check if group exists
+		return ErrGroupNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoStore) JoinGroup(username string, group string) error {
+	groupsCollection := s.db.Collection("Groups")
+
+	filter := bson.M{"groupname": group}
+
+	update := bson.M{
+		"$addToSet": bson.M{
+			"groupmates": username, // add user to groupmates of group, if not already there
+		},
+	}
+
+	result, err := groupsCollection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("Error updating Groups table: %v", err)
+	}
+
+	if result.MatchedCount == 0 { // check if group exists
+		return ErrGroupNotFound
+	}
+
+	usersCollection := s.db.Collection("Users")
+
+	// can assume username has already been validated at login
+
+	filter = bson.M{"username": username}
+
+	update = bson.M{
+		"$addToSet": bson.M{
+			"groups": group, // add group to groups of user, if not already there
+		},
+	}
+
+	_, err = usersCollection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("Error updating Users table: %v", err)
+	}
+
+	return nil
+}
+
+func (s *MongoStore) LeaveGroup(username string, group string) error {
+	filter := bson.M{"groupname": group}
+
+	update := bson.M{
+		"$pull": bson.M{
+			"groupmates": username, // remove user from groupmates of group
+		},
+	}
+
+	result, err := s.db.Collection("Groups").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("Error updating Groups table: %v", err)
+	}
+
+	if result.MatchedCount == 0 { // check if group exists
+		return ErrGroupNotFound
+	}
+
+	filter = bson.M{"username": username}
+
+	update = bson.M{
+		"$pull": bson.M{
+			"groups": group, // remove group from groups of user
+		},
+	}
+
+	_, err = s.db.Collection("Users").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("Error updating Users table: %v", err)
+	}
+
+	return nil
+}
+
+func (s *MongoStore) AddPost(post types.Post) error {
+	if err := s.checkGroup(post.Group); err != nil {
+		return err
+	}
+
+	filter := bson.M{"group": post.Group, "id": post.Id}
+
+	opts := options.Replace().SetUpsert(true) // a post applied again after a crash replaces itself
+
+	_, err := s.db.Collection("Posts").ReplaceOne(context.Background(), filter, post, opts)
+	if err != nil {
+		return fmt.Errorf("Error updating Posts table: %v", err)
+	}
+
+	return nil
+}
+
+func (s *MongoStore) ListPosts(group string, query PostQuery) ([]types.Post, error) {
+	ctx := context.TODO()
+
+	if err := s.checkGroup(group); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"group": group}
+	if query.After > 0 {
+		filter["id"] = bson.M{"$gt": query.After}
+	}
+	if query.Author != "" {
+		filter["author"] = query.Author
+	}
+	timeRange := bson.M{}
+	if !query.Since.IsZero() {
+		timeRange["$gte"] = query.Since
+	}
+	if !query.Until.IsZero() {
+		timeRange["$lt"] = query.Until
+	}
+	if len(timeRange) > 0 {
+		filter["timestamp"] = timeRange
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "id", Value: 1}}).SetLimit(int64(query.Limit))
+
+	cursor, err := s.db.Collection("Posts").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving posts: %v", err)
+	}
+
+	posts := []types.Post{}
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, fmt.Errorf("Error decoding posts: %v", err)
+	}
+
+	return posts, nil
+}
+
+func (s *MongoStore) CommitOffset(username string, group string, offset uint64) error {
+	if err := s.checkGroup(group); err != nil {
+		return err
+	}
+
+	filter := bson.M{"username": username, "group": group}
+
+	update := bson.M{
+		"$max": bson.M{
+			"offset": offset, // only ever move the offset forward
+		},
+		"$pull": bson.M{
+			"acked": bson.M{"$lte": offset}, // now covered by the offset
+		},
+	}
+
+	opts := options.Update().SetUpsert(true)
+
+	_, err := s.db.Collection("Offsets").UpdateOne(context.Background(), filter, update, opts)
+	if err != nil {
+		return fmt.Errorf("Error updating Offsets table: %v", err)
+	}
+
+	return nil
+}
+
+func (s *MongoStore) SetOffset(offset types.Offset) error {
+	if err := s.checkGroup(offset.Group); err != nil {
+		return err
+	}
+
+	filter := bson.M{"username": offset.Username, "group": offset.Group}
+
+	opts := options.Replace().SetUpsert(true)
+
+	_, err := s.db.Collection("Offsets").ReplaceOne(context.Background(), filter, offset, opts)
+	if err != nil {
+		return fmt.Errorf("Error updating Offsets table: %v", err)
+	}
+
+	return nil
+}
+
+func (s *MongoStore) GetOffsets(username string) (map[string]types.Offset, error) {
+	ctx := context.TODO()
+
+	cursor, err := s.db.Collection("Offsets").Find(ctx, bson.M{"username": username})
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving offsets: %v", err)
+	}
+
+	var offsets []types.Offset
+	if err := cursor.All(ctx, &offsets); err != nil {
+		return nil, fmt.Errorf("Error decoding offsets: %v", err)
+	}
+
+	result := make(map[string]types.Offset)
+	for _, offset := range offsets {
+		result[offset.Group] = offset
+	}
+
+	return result, nil
+}
+
+func (s *MongoStore) Snapshot() (types.Snapshot, error) {
+	ctx := context.TODO()
+
+	snapshot := types.Snapshot{
+		Users:   []types.User{},
+		Groups:  []types.Group{},
+		Posts:   []types.Post{},
+		Offsets: []types.Offset{},
+	}
+
+	cursor, err := s.db.Collection("Users").Find(ctx, bson.M{})
+	if err != nil {
+		return snapshot, fmt.Errorf("Error retrieving users: %v", err)
+	}
+	if err := cursor.All(ctx, &snapshot.Users); err != nil {
+		return snapshot, fmt.Errorf("Error decoding users: %v", err)
+	}
+
+	cursor, err = s.db.Collection("Groups").Find(ctx, bson.M{})
+	if err != nil {
+		return snapshot, fmt.Errorf("Error retrieving groups: %v", err)
+	}
+	if err := cursor.All(ctx, &snapshot.Groups); err != nil {
+		return snapshot, fmt.Errorf("Error decoding groups: %v", err)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "id", Value: 1}})
+
+	cursor, err = s.db.Collection("Posts").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return snapshot, fmt.Errorf("Error retrieving posts: %v", err)
+	}
+	if err := cursor.All(ctx, &snapshot.Posts); err != nil {
+		return snapshot, fmt.Errorf("Error decoding posts: %v", err)
+	}
+
+	cursor, err = s.db.Collection("Offsets").Find(ctx, bson.M{})
+	if err != nil {
+		return snapshot, fmt.Errorf("Error retrieving offsets: %v", err)
+	}
+	if err := cursor.All(ctx, &snapshot.Offsets); err != nil {
+		return snapshot, fmt.Errorf("Error decoding offsets: %v", err)
+	}
+
+	return snapshot, nil
+}
+
+// Restore() replaces every collection with the snapshot's. Documents are loaded in batches into staging collections,
+// which are only renamed over the live ones once all of them are loaded, so an error while loading leaves the live
+// collections untouched
+func (s *MongoStore) Restore(snapshot types.Snapshot) error {
+	ctx := context.TODO()
+
+	staged := []struct {
+		name      string
+		documents []interface{}
+	}{
+		{"Users", toDocuments(snapshot.Users)},
+		{"Groups", toDocuments(snapshot.Groups)},
+		{"Posts", toDocuments(snapshot.Posts)},
+		{"Offsets", toDocuments(snapshot.Offsets)},
+	}
+
+	for _, collection := range staged {
+		staging := s.db.Collection(collection.name + restoreSuffix)
+		if err := staging.Drop(ctx); err != nil { // left over from an interrupted restore
+			return fmt.Errorf("Error clearing %s table: %v", staging.Name(), err)
+		}
+		if err := s.db.CreateCollection(ctx, staging.Name()); err != nil {
+			return fmt.Errorf("Error creating %s table: %v", staging.Name(), err)
+		}
+
+		for start := 0; start < len(collection.documents); start += restoreBatchSize {
+			batch := collection.documents[start:min(start+restoreBatchSize, len(collection.documents))]
+			if _, err := staging.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false)); err != nil {
+				return fmt.Errorf("Error inserting into %s table: %v", staging.Name(), err)
+			}
+		}
+	}
+
+	// renamed collections keep their indexes, so build them on the staging collections first
+	if err := s.createIndexes(restoreSuffix); err != nil {
+		return err
+	}
+
+	for _, collection := range staged {
+		rename := bson.D{
+			{Key: "renameCollection", Value: s.db.Name() + "." + collection.name + restoreSuffix},
+			{Key: "to", Value: s.db.Name() + "." + collection.name},
+			{Key: "dropTarget", Value: true},
+		}
+		if err := s.client.Database("admin").RunCommand(ctx, rename).Err(); err != nil {
+			return fmt.Errorf("Error replacing %s table: %v", collection.name, err)
+		}
+	}
+
+	return nil
+}
+
+// toDocuments() converts a slice of documents to the type InsertMany() takes
+func toDocuments[T any](values []T) []interface{} {
+	documents := make([]interface{}, len(values))
+	for i, value := range values {
+		documents[i] = value
+	}
+	return documents
+}
+
+// MigrateEmbeddedPosts() moves posts still embedded in the posts array of Groups documents, as stored before posts
+// had their own collection, into the Posts collection. Every post gets its own id below types.FirstPostId, increasing
+// in the order the posts were written. Returns how many posts were moved. Safe to run again if interrupted, and has no
+// effect once every group has been migrated
+func (s *MongoStore) MigrateEmbeddedPosts() (int, error) {
+	ctx := context.TODO()
+
+	// group document as stored before posts had their own collection
+	type legacyGroup struct {
+		GroupName    string       `bson:"groupname"`
+		Posts        []types.Post `bson:"posts"`
+		MigratedFrom uint64       `bson:"migratedFrom,omitempty"` // first id given to the group's posts by a run that was interrupted
+	}
+
+	groupsCollection := s.db.Collection("Groups")
+	postsCollection := s.db.Collection("Posts")
+
+	cursor, err := groupsCollection.Find(ctx, bson.M{"posts": bson.M{"$exists": true}}, options.Find().SetSort(bson.D{{Key: "groupname", Value: 1}})) // get all groups not yet migrated
+	if err != nil {
+		return 0, fmt.Errorf("Error retrieving groups: %v", err)
+	}
+
+	var groups []legacyGroup
+	if err := cursor.All(ctx, &groups); err != nil {
+		return 0, fmt.Errorf("Error decoding groups: %v", err)
+	}
+
+	// continue after the highest id already given out, including to posts an interrupted run did not copy yet
+	var last types.Post
+	opts := options.FindOne().SetSort(bson.D{{Key: "id", Value: -1}})
+	err = postsCollection.FindOne(ctx, bson.M{"id": bson.M{"$lt": types.FirstPostId}}, opts).Decode(&last)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return 0, fmt.Errorf("Error retrieving posts: %v", err)
+	}
+	next := last.Id + 1
+	for _, group := range groups {
+		if group.MigratedFrom != 0 {
+			next = max(next, group.MigratedFrom+uint64(len(group.Posts)))
+		}
+	}
+
+	moved := 0
+
+	for _, group := range groups {
+		first := group.MigratedFrom
+		if first != 0 { // drop the posts an interrupted run already copied, as they are copied again below
+			filter := bson.M{"group": group.GroupName, "id": bson.M{"$gte": first, "$lt": first + uint64(len(group.Posts))}}
+			if _, err := postsCollection.DeleteMany(ctx, filter); err != nil {
+				return moved, fmt.Errorf("Error updating Posts table: %v", err)
+			}
+		} else {
+			first = next
+
+			// remember the ids given out before copying, so a run after an interruption gives out the same ones
+			update := bson.M{"$set": bson.M{"migratedFrom": first}}
+			if _, err := groupsCollection.UpdateOne(ctx, bson.M{"groupname": group.GroupName}, update); err != nil {
+				return moved, fmt.Errorf("Error updating Groups table: %v", err)
+			}
+			next += uint64(len(group.Posts))
+		}
+
+		// insert every post, as posts written before ids existed may be identical
+		for i, post := range group.Posts {
+			post.Group = group.GroupName
+			post.Id = first + uint64(i) // posts were appended to the array in the order they were written
+
+			if _, err := postsCollection.InsertOne(ctx, post); err != nil {
+				return moved, fmt.Errorf("Error inserting post: %v", err)
+			}
+			moved++
+		}
+
+		update := bson.M{
+			"$unset": bson.M{
+				"posts":        "", // remove posts from group only once all of them have been copied
+				"migratedFrom": "",
+			},
+		}
+
+		if _, err := groupsCollection.UpdateOne(ctx, bson.M{"groupname": group.GroupName}, update); err != nil {
+			return moved, fmt.Errorf("Error updating Groups table: %v", err)
+		}
+	}
+
+	return moved, nil
+}
+
+// checkGroup() returns ErrGroupNotFound if a group does not exist
+func (s *MongoStore) checkGroup(name string) error {
+	count, err := s.db.Collection("Groups").CountDocuments(context.Background(), bson.M{"groupname": name})
+	if err != nil {
+		return fmt.Errorf("Error validating group name: %v", err)
+	}
+
+	if count == 0 {
+		return ErrGroupNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoStore) Close() error {
+	return s.client.Disconnect(context.TODO())
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"errors"
+	"sjsu-pub-sub/types"
+	"time"
+)
+
+var (
+	ErrUserExists    = errors.New("username already exists")
+	ErrUserNotFound  = errors.New("username does not exist")
+	ErrGroupNotFound = errors.New("group name does not exist")
+	ErrGroupExists   = errors.New("group name already exists")
+)
+
+// PostQuery selects a page of a group's posts
+type PostQuery struct {
+	After  uint64    // only posts with a larger id, 0 to start from the oldest post
+	Limit  int       // most posts to return
+	Author string    // only posts by this user, empty for any
+	Since  time.Time // only posts at or after this time, zero for any
+	Until  time.Time // only posts before this time, zero for any
+}
+
+// matches() checks whether a post passes every filter of the query except Limit
+func (q PostQuery) matches(post types.Post) bool {
+	if q.After > 0 && post.Id <= q.After {
+		return false
+	}
+	if q.Author != "" && post.Author != q.Author {
+		return false
+	}
+	if !q.Since.IsZero() && post.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !post.Timestamp.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Store holds the users, groups, memberships and posts a server serves and applies replicated writes to
+type Store interface {
+	// CreateUser() inserts a new user with a password hash, or returns ErrUserExists
+	CreateUser(username string, passwordHash string) error
+	// SetPasswordHash() replaces a user's password hash, or returns ErrUserNotFound
+	SetPasswordHash(username string, passwordHash string) error
+	// GetUser() returns a user, or ErrUserNotFound
+	GetUser(username string) (types.User, error)
+	// SetPublicKey() replaces the public key a user's client published, or returns ErrUserNotFound
+	SetPublicKey(username string, publicKey string) error
+	// UserExists() checks whether a user has registered
+	UserExists(username string) (bool, error)
+
+	// ListGroups() returns all groups with their groupmates
+	ListGroups() ([]types.Group, error)
+	// ListGroupSummaries() returns the name, creator, owner, member count and visibility of all groups viewer may see
+	ListGroupSummaries(viewer string) ([]types.GroupSummary, error)
+	// GetGroup() returns a group, or ErrGroupNotFound
+	GetGroup(name string) (types.Group, error)
+	// CreateGroup() inserts an empty group owned by its creator with a visibility, or returns ErrGroupExists
+	CreateGroup(name string, creator string, visibility string) error
+	// DeleteGroup() removes a group with its posts and offsets and removes it from its groupmates' groups, or returns
+	// ErrGroupNotFound
+	DeleteGroup(name string) error
+	// SetGroupOwner() hands a group over to a new owner, or returns ErrGroupNotFound
+	SetGroupOwner(name string, owner string) error
+	// SetGroupACL() replaces a group's visibility, roles, invites and requests to join, or returns ErrGroupNotFound
+	SetGroupACL(name string, acl types.GroupACL) error
+	// SetGroupEncryption() replaces whether a group is end-to-end encrypted and its sealed keys, or returns
+	// ErrGroupNotFound
+	SetGroupEncryption(name string, encryption types.GroupEncryption) error
+
+	// JoinGroup() adds a user to a group's groupmates and the group to the user's groups, or returns ErrGroupNotFound.
+	// Joining a group twice has no effect
+	JoinGroup(username string, group string) error
+	// LeaveGroup() undoes JoinGroup(), or returns ErrGroupNotFound. Leaving a group the user is not in has no effect
+	LeaveGroup(username string, group string) error
+	// AddPost() stores a post in its group, or returns ErrGroupNotFound. Adding a post with the same group and id
+	// again has no effect
+	AddPost(post types.Post) error
+	// ListPosts() returns the posts of a group selected by query in id order, or ErrGroupNotFound
+	ListPosts(group string, query PostQuery) ([]types.Post, error)
+
+	// CommitOffset() records that a user has received every post of a group up to offset, or returns
+	// ErrGroupNotFound. Never lowers an offset already committed
+	CommitOffset(username string, group string, offset uint64) error
+	// SetOffset() replaces the offset of a user in a group together with the posts after it they received, or returns
+	// ErrGroupNotFound
+	SetOffset(offset types.Offset) error
+	// GetOffsets() returns the committed offset of each group of a user. Groups with no committed offset are left out
+	GetOffsets(username string) (map[string]types.Offset, error)
+
+	// Snapshot() copies all users, groups, posts and offsets, and Restore() replaces them
+	Snapshot() (types.Snapshot, error)
+	Restore(snapshot types.Snapshot) error
+
+	Close() error
+}
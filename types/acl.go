@@ -0,0 +1,99 @@
+package types
+
+import "slices"
+
+// who may see a group
+const (
+	VisibilityPublic  = "public"  // listed to everyone, and anyone may join
+	VisibilityPrivate = "private" // only listed to groupmates and invited users, who join by invite or approved request
+)
+
+// what a groupmate may do in a group. Higher roles may do everything lower ones may
+const (
+	RoleReadOnly  = "readonly"  // receives and reads posts
+	RoleMember    = "member"    // also writes posts
+	RoleModerator = "moderator" // also invites users and approves or declines requests to join
+	RoleOwner     = "owner"     // also changes roles and visibility, hands the group over and deletes it
+)
+
+// GroupACL decides who may see, join and write to a group. The zero value is a public group every groupmate may write to
+type GroupACL struct {
+	Visibility string            `bson:"visibility,omitempty" json:"visibility,omitempty"` // VisibilityPublic or VisibilityPrivate. Empty means public
+	Roles      map[string]string `bson:"roles,omitempty" json:"roles,omitempty"`           // role of each groupmate who is neither the owner nor a plain member
+	Invited    []string          `bson:"invited,omitempty" json:"invited,omitempty"`       // users invited who have not joined yet
+	Requested  []string          `bson:"requested,omitempty" json:"requested,omitempty"`   // users waiting for their request to join to be approved
+}
+
+// Private() checks whether a group is only visible to its groupmates and invited users
+func (g Group) Private() bool {
+	return g.ACL.Visibility == VisibilityPrivate
+}
+
+// OwnerName() returns who owns a group. Groups created before ownership existed are owned by their creator
+func (g Group) OwnerName() string {
+	if g.Owner == "" {
+		return g.Creator
+	}
+	return g.Owner
+}
+
+// Role() returns a user's role in a group, or an empty string if they are not a groupmate
+func (g Group) Role(username string) string {
+	if !slices.Contains(g.GroupMates, username) {
+		return ""
+	}
+	if username == g.OwnerName() {
+		return RoleOwner
+	}
+	if role, ok := g.ACL.Roles[username]; ok {
+		return role
+	}
+	return RoleMember
+}
+
+// Allows() checks whether a user's role in a group is at least role. Users outside the group have no role
+func (g Group) Allows(username string, role string) bool {
+	return roleRank(g.Role(username)) >= roleRank(role)
+}
+
+// VisibleTo() checks whether a user may see that a group exists. Invited users may see a private group, but only read
+// its posts once they joined
+func (g Group) VisibleTo(username string) bool {
+	return !g.Private() || slices.Contains(g.GroupMates, username) || slices.Contains(g.ACL.Invited, username)
+}
+
+// Readable() checks whether a user may read a group's posts
+func (g Group) Readable(username string) bool {
+	return !g.Private() || slices.Contains(g.GroupMates, username)
+}
+
+// Summary() returns what /groups lists of a group
+func (g Group) Summary() GroupSummary {
+	visibility := g.ACL.Visibility
+	if visibility == "" {
+		visibility = VisibilityPublic
+	}
+	return GroupSummary{
+		GroupName:   g.GroupName,
+		Creator:     g.Creator,
+		Owner:       g.Owner,
+		MemberCount: len(g.GroupMates),
+		Visibility:  visibility,
+		Encrypted:   g.Encryption.Enabled,
+	}
+}
+
+// roleRank() orders roles, 0 for users outside the group
+func roleRank(role string) int {
+	switch role {
+	case RoleReadOnly:
+		return 1
+	case RoleMember:
+		return 2
+	case RoleModerator:
+		return 3
+	case RoleOwner:
+		return 4
+	}
+	return 0
+}
@@ -0,0 +1,47 @@
+package types
+
+import "slices"
+
+// GroupKey is one generation of an end-to-end encrypted group's key, sealed to the public key of every groupmate it was
+// shared with. Servers store the sealed copies but cannot open them
+type GroupKey struct {
+	Epoch  uint64            `bson:"epoch" json:"epoch"`   // 1 for the group's first key, raised each time the key is replaced
+	Sealed map[string]string `bson:"sealed" json:"sealed"` // copy of the key sealed to each groupmate, by username
+}
+
+// GroupEncryption holds whether a group's posts are end-to-end encrypted, and every key they were encrypted with.
+// The zero value is a group posting in clear
+type GroupEncryption struct {
+	Enabled bool       `bson:"enabled,omitempty" json:"enabled,omitempty"`
+	Keys    []GroupKey `bson:"keys,omitempty" json:"keys,omitempty"` // oldest first, kept so older posts can still be read
+}
+
+// Epoch() returns the generation of the key new posts must be encrypted with, 0 if no key was shared yet
+func (e GroupEncryption) Epoch() uint64 {
+	if len(e.Keys) == 0 {
+		return 0
+	}
+	return e.Keys[len(e.Keys)-1].Epoch
+}
+
+// Holders() returns the users the current key was shared with
+func (e GroupEncryption) Holders() []string {
+	holders := []string{}
+	if len(e.Keys) == 0 {
+		return holders
+	}
+	for username := range e.Keys[len(e.Keys)-1].Sealed {
+		holders = append(holders, username)
+	}
+	slices.Sort(holders)
+	return holders
+}
+
+// what a groupmate needs to read and write an end-to-end encrypted group, returned by /groups/{name}/keys
+type GroupKeyring struct {
+	Enabled    bool              `json:"enabled"`
+	Epoch      uint64            `json:"epoch"`      // generation of the key new posts must be encrypted with, 0 if none yet
+	Keys       map[uint64]string `json:"keys"`       // every key sealed to the groupmate asking, by epoch
+	PublicKeys map[string]string `json:"publicKeys"` // public key of every groupmate, empty for those who have not published one
+	Holders    []string          `json:"holders"`    // groupmates the current key was shared with
+}
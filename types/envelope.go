@@ -0,0 +1,239 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// range of wire protocol versions this build speaks. Bump ProtocolVersion when a message changes shape, and
+// MinProtocolVersion once the old shape is no longer supported
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+// kinds of Envelope
+const (
+	MsgHello     = "hello"     // Hello, first message on every connection
+	MsgHelloAck  = "helloack"  // HelloAck, answer to Hello
+	MsgAuth      = "auth"      // AuthMessage from client to server
+	MsgGossip    = "gossip"    // GossipMessage from server to client or client to client
+	MsgDigest    = "digest"    // GossipDigest from client to client, asking for a GossipDigest reply
+	MsgDigestAck = "digestack" // GossipDigest answering a MsgDigest, or with Final set, answering a MsgDigestAck
+
+	MsgSwimPing    = "swimping"    // SwimMessage from client to client, checking the receiver is alive
+	MsgSwimPingReq = "swimpingreq" // SwimMessage asking the receiver to ping another client
+	MsgSwimAck     = "swimack"     // SwimMessage answering a MsgSwimPing
+
+	MsgRaft       = "raft"       // RaftMessage between servers, or from gateway to a server
+	MsgRaftReply  = "raftreply"  // RaftReply to a RaftMessage
+	MsgRegister   = "register"   // Registration from server to gateway
+	MsgDeregister = "deregister" // Deregistration from server to gateway, on shutdown
+	MsgHeartbeat  = "heartbeat"  // Heartbeat from server to gateway
+	MsgPing       = "ping"       // empty, checks a long-lived connection is still alive
+	MsgPong       = "pong"       // empty reply to MsgPing
+)
+
+// optional features a side of a connection can announce in its Hello. A feature is only used if both sides announce it
+const (
+	CapReplay = "replay" // client wants posts it missed while offline sent when it logs in
+	CapPing   = "ping"   // receiver answers MsgPing with MsgPong
+)
+
+var ErrVersionMismatch = errors.New("no protocol version supported by both sides")
+
+// every message on a TCP connection is wrapped in an envelope, so one port can carry many kinds of message
+type Envelope struct {
+	Type    string          `json:"type"`
+	Version int             `json:"version"` // protocol version payload is encoded in
+	From    string          `json:"from"`    // sender, e.g. username or server hostname
+	Id      uint64          `json:"id"`      // correlation id, a reply carries the id of the message it answers
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Decode() decodes the payload of an envelope into v
+func (e Envelope) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return fmt.Errorf("failed to decode %s payload: %v", e.Type, err)
+	}
+	return nil
+}
+
+// payload of MsgHello, sent by the side that dialed the connection
+type Hello struct {
+	MinVersion   int      `json:"minVersion"`
+	MaxVersion   int      `json:"maxVersion"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// payload of MsgHelloAck, with the version both sides use from now on
+type HelloAck struct {
+	Version      int      `json:"version"`
+	Capabilities []string `json:"capabilities"`
+	Error        string   `json:"error,omitempty"` // set if no version is supported by both sides
+}
+
+// Session is a connection both sides have agreed on a protocol version for
+type Session struct {
+	rw           io.ReadWriter
+	From         string   // this side
+	Peer         string   // other side, as it introduced itself
+	Version      int      // protocol version both sides speak
+	Capabilities []string // capabilities both sides announced
+	maxFrame     int      // largest frame sent or received, MaxFrameSize unless the port needs larger ones
+	nextId       uint64
+}
+
+// StartSession() sends a Hello over a connection this side dialed, and waits for the other side to pick a version.
+// Frames larger than maxFrame are neither sent nor received
+func StartSession(rw io.ReadWriter, from string, capabilities []string, maxFrame int) (*Session, error) {
+	s := &Session{rw: rw, From: from, Version: MinProtocolVersion, maxFrame: maxFrame}
+
+	hello := Hello{
+		MinVersion:   MinProtocolVersion,
+		MaxVersion:   ProtocolVersion,
+		Capabilities: capabilities,
+	}
+
+	if _, err := s.Send(MsgHello, hello); err != nil {
+		return nil, err
+	}
+
+	env, err := s.receive(MsgHelloAck)
+	if err != nil {
+		return nil, err
+	}
+
+	var ack HelloAck
+	if err := env.Decode(&ack); err != nil {
+		return nil, err
+	}
+
+	if ack.Error != "" {
+		return nil, fmt.Errorf("%v: %s", ErrVersionMismatch, ack.Error)
+	}
+	if ack.Version < MinProtocolVersion || ack.Version > ProtocolVersion {
+		return nil, ErrVersionMismatch
+	}
+
+	s.Peer = env.From
+	s.Version = ack.Version
+	s.Capabilities = intersect(capabilities, ack.Capabilities)
+
+	return s, nil
+}
+
+// AcceptSession() waits for the Hello on a connection the other side dialed, and answers with the highest version
+// both sides speak. Frames larger than maxFrame are neither sent nor received, so a peer cannot make this side
+// allocate more
+func AcceptSession(rw io.ReadWriter, from string, capabilities []string, maxFrame int) (*Session, error) {
+	s := &Session{rw: rw, From: from, Version: MinProtocolVersion, maxFrame: maxFrame}
+
+	env, err := s.receive(MsgHello)
+	if err != nil {
+		return nil, err
+	}
+
+	var hello Hello
+	if err := env.Decode(&hello); err != nil {
+		return nil, err
+	}
+
+	version := min(hello.MaxVersion, ProtocolVersion)
+	if version < max(hello.MinVersion, MinProtocolVersion) {
+		reason := fmt.Sprintf("peer speaks versions %d to %d, %s speaks %d to %d", hello.MinVersion, hello.MaxVersion, from, MinProtocolVersion, ProtocolVersion)
+		s.Reply(env, MsgHelloAck, HelloAck{Error: reason})
+		return nil, fmt.Errorf("%v: %s", ErrVersionMismatch, reason)
+	}
+
+	s.Peer = env.From
+	s.Version = version
+	s.Capabilities = intersect(capabilities, hello.Capabilities)
+
+	ack := HelloAck{
+		Version:      version,
+		Capabilities: capabilities,
+	}
+
+	if err := s.Reply(env, MsgHelloAck, ack); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Send() wraps payload in a new envelope and writes it as a frame. Returns the envelope's correlation id
+func (s *Session) Send(msgType string, payload interface{}) (uint64, error) {
+	s.nextId++
+	return s.nextId, s.write(msgType, s.nextId, payload)
+}
+
+// Reply() answers a received envelope, reusing its correlation id
+func (s *Session) Reply(to Envelope, msgType string, payload interface{}) error {
+	return s.write(msgType, to.Id, payload)
+}
+
+// Receive() reads the next envelope. Returns io.EOF if the other side closed the connection between messages
+func (s *Session) Receive() (Envelope, error) {
+	var env Envelope
+	err := ReadFrame(s.rw, &env, s.maxFrame)
+	return env, err
+}
+
+// Supports() checks whether both sides announced a capability
+func (s *Session) Supports(capability string) bool {
+	for _, c := range s.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// write() sends payload in an envelope stamped with the session's version
+func (s *Session) write(msgType string, id uint64, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s payload: %v", msgType, err)
+	}
+
+	env := Envelope{
+		Type:    msgType,
+		Version: s.Version,
+		From:    s.From,
+		Id:      id,
+		Payload: data,
+	}
+
+	return WriteFrame(s.rw, env, s.maxFrame)
+}
+
+// receive() reads the next envelope and checks it is of the expected kind
+func (s *Session) receive(msgType string) (Envelope, error) {
+	env, err := s.Receive()
+	if err != nil {
+		return env, err
+	}
+
+	if env.Type != msgType {
+		return env, fmt.Errorf("expected %s message, got %s", msgType, env.Type)
+	}
+
+	return env, nil
+}
+
+// intersect() returns the elements of a that are also in b
+func intersect(a []string, b []string) []string {
+	result := []string{}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				result = append(result, x)
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// largest frame accepted on connections anyone may open: client logins, gossip and the gateway's registration port
+const MaxFrameSize = 1024 * 1024
+
+// largest frame accepted on the Raft port, which only carries log entries and snapshot chunks between servers, and
+// with TLS only accepts servers and the gateway
+const MaxRaftFrameSize = 16 * 1024 * 1024
+
+var ErrFrameTooLarge = errors.New("frame exceeds maximum size")
+
+// every TCP message is a frame: its length as a 4-byte big-endian integer, followed by that many bytes of JSON. Many
+// frames can be sent one after the other on the same connection
+
+// WriteFrame() encodes v as JSON and writes it to w as a single frame of at most maxSize bytes
+func WriteFrame(w io.Writer, v interface{}, maxSize int) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode frame: %v", err)
+	}
+
+	if len(data) > maxSize {
+		return ErrFrameTooLarge
+	}
+
+	frame := make([]byte, 4+len(data)) // write length and JSON at once, so concurrent writers cannot interleave them
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	_, err = w.Write(frame)
+	return err
+}
+
+// ReadFrame() reads the next frame from r and decodes its JSON into v. Returns io.EOF if r was closed between frames,
+// and ErrFrameTooLarge before reading any further if the frame is larger than maxSize
+func ReadFrame(r io.Reader, v interface{}, maxSize int) error {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if uint64(size) > uint64(maxSize) {
+		return ErrFrameTooLarge
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF // closed in the middle of a frame
+		}
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode frame: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// header() returns the 4-byte length prefix of a frame holding size bytes
+func header(size uint32) []byte {
+	var h [4]byte
+	binary.BigEndian.PutUint32(h[:], size)
+	return h[:]
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	sent := []Hello{
+		{MinVersion: 1, MaxVersion: 1},
+		{MinVersion: 1, MaxVersion: 2, Capabilities: []string{CapReplay, CapPing}},
+		{},
+	}
+
+	for _, hello := range sent {
+		if err := WriteFrame(&buf, hello, MaxFrameSize); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, want := range sent {
+		var got Hello
+		if err := ReadFrame(&buf, &got, MaxFrameSize); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if got.MinVersion != want.MinVersion || got.MaxVersion != want.MaxVersion || !slices.Equal(got.Capabilities, want.Capabilities) {
+			t.Errorf("frame %d: got %+v, want %+v", i, got, want)
+		}
+	}
+
+	var extra Hello
+	if err := ReadFrame(&buf, &extra, MaxFrameSize); err != io.EOF {
+		t.Errorf("reading past the last frame: got %v, want %v", err, io.EOF)
+	}
+}
+
+func TestWriteFrameTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	body := strings.Repeat("x", 100)
+
+	if err := WriteFrame(&buf, body, 50); err != ErrFrameTooLarge {
+		t.Errorf("got %v, want %v", err, ErrFrameTooLarge)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes of a frame that was too large", buf.Len())
+	}
+	if err := WriteFrame(&buf, body, 102); err != nil {
+		t.Errorf("frame of exactly the maximum size: %v", err)
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		maxSize int
+		want    error
+	}{
+		{"closed between frames", nil, MaxFrameSize, io.EOF},
+		{"closed in the header", []byte{0, 0}, MaxFrameSize, io.ErrUnexpectedEOF},
+		{"closed in the body", append(header(10), `{"a"`...), MaxFrameSize, io.ErrUnexpectedEOF},
+		{"larger than maximum", header(MaxRaftFrameSize + 1), MaxRaftFrameSize, ErrFrameTooLarge},
+		{"larger than a smaller maximum", append(header(20), `{}`...), 10, ErrFrameTooLarge},
+	}
+
+	for _, tt := range tests {
+		var v map[string]interface{}
+		if err := ReadFrame(bytes.NewReader(tt.data), &v, tt.maxSize); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	var v map[string]interface{}
+	if err := ReadFrame(bytes.NewReader(append(header(3), "{x}"...)), &v, MaxFrameSize); err == nil {
+		t.Error("invalid JSON: got no error")
+	}
+}
+
+// handshake() sends hello to AcceptSession over an in-memory connection, by hand so tests can announce versions
+// this build does not speak. Returns the HelloAck and the accepting side's session
+func handshake(t *testing.T, hello Hello) (HelloAck, *Session, error) {
+	t.Helper()
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	type result struct {
+		s   *Session
+		err error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		s, err := AcceptSession(b, "server", nil, MaxFrameSize)
+		accepted <- result{s, err}
+	}()
+
+	if err := WriteFrame(a, Envelope{Type: MsgHello, From: "alice", Id: 1, Payload: mustMarshal(t, hello)}, MaxFrameSize); err != nil {
+		t.Fatal(err)
+	}
+
+	var env Envelope
+	if err := ReadFrame(a, &env, MaxFrameSize); err != nil {
+		t.Fatal(err)
+	}
+	var ack HelloAck
+	if err := env.Decode(&ack); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-accepted
+	return ack, r.s, r.err
+}
+
+// mustMarshal() encodes v as JSON, failing the test if it cannot
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSessionHandshake(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	accepted := make(chan *Session, 1)
+	go func() {
+		s, err := AcceptSession(b, "server", []string{CapPing}, MaxFrameSize)
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- s
+	}()
+
+	client, err := StartSession(a, "alice", []string{CapReplay, CapPing}, MaxFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := <-accepted
+	if server == nil {
+		t.FailNow()
+	}
+
+	if client.Peer != "server" || server.Peer != "alice" {
+		t.Errorf("peers: got %q and %q, want server and alice", client.Peer, server.Peer)
+	}
+	if client.Version != ProtocolVersion || server.Version != ProtocolVersion {
+		t.Errorf("versions: got %d and %d, want %d", client.Version, server.Version, ProtocolVersion)
+	}
+	if !client.Supports(CapPing) || client.Supports(CapReplay) || !server.Supports(CapPing) || server.Supports(CapReplay) {
+		t.Errorf("capabilities: got %v and %v, want only %s on both sides", client.Capabilities, server.Capabilities, CapPing)
+	}
+
+	go client.Send(MsgPing, struct{}{})
+	env, err := server.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Type != MsgPing || env.From != "alice" || env.Version != ProtocolVersion {
+		t.Errorf("got %s from %s at version %d, want %s from alice at version %d", env.Type, env.From, env.Version, MsgPing, ProtocolVersion)
+	}
+}
+
+func TestSessionVersionMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		hello Hello
+		want  bool
+	}{
+		{"same versions", Hello{MinVersion: MinProtocolVersion, MaxVersion: ProtocolVersion}, true},
+		{"newer versions too", Hello{MinVersion: MinProtocolVersion, MaxVersion: ProtocolVersion + 1}, true},
+		{"only newer versions", Hello{MinVersion: ProtocolVersion + 1, MaxVersion: ProtocolVersion + 2}, false},
+		{"only older versions", Hello{MinVersion: MinProtocolVersion - 2, MaxVersion: MinProtocolVersion - 1}, false},
+	}
+
+	for _, tt := range tests {
+		ack, server, err := handshake(t, tt.hello)
+		if tt.want {
+			if err != nil || ack.Error != "" {
+				t.Errorf("%s: got errors %v and %q", tt.name, err, ack.Error)
+			} else if ack.Version != ProtocolVersion || server.Version != ProtocolVersion {
+				t.Errorf("%s: agreed on versions %d and %d, want %d", tt.name, ack.Version, server.Version, ProtocolVersion)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), ErrVersionMismatch.Error()) || ack.Error == "" {
+			t.Errorf("%s: got errors %v and %q, want %v on both sides", tt.name, err, ack.Error, ErrVersionMismatch)
+		}
+	}
+}
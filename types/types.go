@@ -1,32 +1,261 @@
 package types
 
+import "time"
+
 type User struct {
-	Username string   `json:"username"`
-	Groups   []string `json:"groups"`
+	Username     string   `json:"username"`
+	Groups       []string `json:"groups"`
+	PasswordHash string   `json:"passwordHash,omitempty" bson:"passwordHash,omitempty"` // bcrypt hash. Empty for users registered before passwords existed
+	PublicKey    string   `json:"publicKey,omitempty" bson:"publicKey,omitempty"`       // key group keys are sealed to, empty until the user's client published one
+}
+
+// session issued to a user who logged in, sent back with every request that acts on the user's behalf
+type UserSession struct {
+	Username string    `json:"username"`
+	Token    string    `json:"token"`
+	Expires  time.Time `json:"expires"`
 }
 
 type Group struct {
-	GroupName  string   `bson:"groupname"`
-	Creator    string   `bson:"creator"`
-	GroupMates []string `bson:"groupmates"`
-	Posts      []Post   `bson:"posts"`
+	GroupName  string          `bson:"groupname"`
+	Creator    string          `bson:"creator"`
+	Owner      string          `bson:"owner"` // only the owner may delete the group or hand it over. Empty means Creator
+	GroupMates []string        `bson:"groupmates"`
+	ACL        GroupACL        `bson:"acl"`        // who may see, join and write to the group
+	Encryption GroupEncryption `bson:"encryption"` // whether posts are end-to-end encrypted, and with which keys
 }
 
+// post written to a group, stored separately from the group itself
 type Post struct {
-	Author string `bson:"author"`
-	Group  string `bson:"group"`
-	Body   string `bson:"body"`
+	Id        uint64    `bson:"id" json:"id"` // PostId() of the post's index in the replicated log, unique and increasing across all groups
+	Author    string    `bson:"author" json:"author"`
+	Group     string    `bson:"group" json:"group"`
+	Body      string    `bson:"body" json:"body"`                             // ciphertext if KeyEpoch is set
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`                   // when the leader accepted the post
+	KeyEpoch  uint64    `bson:"keyEpoch,omitempty" json:"keyEpoch,omitempty"` // generation of the group key Body is encrypted with, 0 if in clear
+}
+
+// ids below FirstPostId are left to posts written before ids existed, which the migration tool numbers from 1 in the
+// order they were written, so they come before every post written since
+const FirstPostId uint64 = 1 << 32
+
+// PostId() returns the id of the post written by the replicated log entry at index
+func PostId(index uint64) uint64 {
+	return FirstPostId + index
+}
+
+// post id of a group up to which a user has received every post, so posts they missed while offline can be sent when
+// they reconnect
+type Offset struct {
+	Username string   `bson:"username" json:"username"`
+	Group    string   `bson:"group" json:"group"`
+	Offset   uint64   `bson:"offset" json:"offset"`
+	Acked    []uint64 `bson:"acked,omitempty" json:"acked,omitempty"` // ids of posts after Offset the user has received, in order
+}
+
+// group without its groupmates and posts, returned when listing all groups
+type GroupSummary struct {
+	GroupName   string `json:"groupname"`
+	Creator     string `json:"creator"`
+	Owner       string `json:"owner"`
+	MemberCount int    `json:"memberCount"`
+	Visibility  string `json:"visibility"`
+	Encrypted   bool   `json:"encrypted,omitempty"` // posts are end-to-end encrypted
+}
+
+// group as a user who may see it sees it, returned for a single group
+type GroupInfo struct {
+	GroupSummary
+	Roles     map[string]string `json:"roles"`               // role of every groupmate
+	Invited   []string          `json:"invited,omitempty"`   // only shown to moderators and the owner
+	Requested []string          `json:"requested,omitempty"` // only shown to moderators and the owner
+}
+
+// page of a group's posts, oldest first
+type PostPage struct {
+	Posts []Post `json:"posts"`
+	Next  uint64 `json:"next,omitempty"` // pass as after to get the next page, 0 if there are no more posts
 }
 
 // message that user sends to server via TCP upon starting up
 type AuthMessage struct {
 	Username string `json:"username"`
 	Port     string `json:"port"`
+	Token    string `json:"token"` // UserSession.Token of the user, so nobody can receive another user's posts
 }
 
 // gossip message sent via TCP from server to client or client to client
 type GossipMessage struct {
-	Id           int      `json:"id"`
-	Body         string   `json:"body"`
-	ConnsToWrite []string `json:"connsToWrite"`
+	Id           uint64         `json:"id"` // Post.Id of the post being gossiped
+	Group        string         `json:"group"`
+	Author       string         `json:"author,omitempty"`
+	Timestamp    time.Time      `json:"timestamp"`
+	Body         string         `json:"body"`
+	KeyEpoch     uint64         `json:"keyEpoch,omitempty"`   // Post.KeyEpoch, so receivers know which group key opens Body
+	GroupMates   []string       `json:"groupMates,omitempty"` // gossip addresses of the groupmates the server seeded the post to
+	Signature    string         `json:"signature,omitempty"`  // server's signature of the fields above, checked by every client
+	ConnsToWrite []string       `json:"connsToWrite"`         // groupmates the receiver may gossip the post to
+	TTL          int            `json:"ttl,omitempty"`        // hops the post may still travel, including to the receiver. 0 if unknown
+	Members      []MemberUpdate `json:"members,omitempty"`    // membership changes piggybacked on the post
+}
+
+// summary of the posts of a group a client holds, exchanged with a random peer so either side recovers posts it missed
+type GossipDigest struct {
+	Group    string          `json:"group"`
+	Port     string          `json:"port"` // port the sender receives gossip on, to answer the digest
+	Ids      []uint64        `json:"ids"`
+	Messages []GossipMessage `json:"messages,omitempty"` // posts the receiver lacks
+	Final    bool            `json:"final,omitempty"`    // last message of the exchange, not to be answered
+	Members  []MemberUpdate  `json:"members,omitempty"`  // membership changes piggybacked on the digest
+}
+
+// states of a client in the membership every client keeps of the others
+const (
+	MemberAlive   = "alive"
+	MemberSuspect = "suspect" // missed a probe, declared dead unless it refutes in time
+	MemberDead    = "dead"
+)
+
+// change to the state of a client, spread among clients by piggybacking it on other messages
+type MemberUpdate struct {
+	Address     string `json:"address"` // where the client receives gossip
+	State       string `json:"state"`
+	Incarnation uint64 `json:"incarnation"` // raised by the client itself to refute being suspected
+}
+
+// probe sent between clients to detect failed clients. A MsgSwimPing is answered with a MsgSwimAck carrying the same
+// Seq. A MsgSwimPingReq asks the receiver to ping Target on the sender's behalf, and relay the ack
+type SwimMessage struct {
+	Seq     uint64         `json:"seq"`
+	Port    string         `json:"port"`             // port the sender receives gossip on, to send the ack to
+	Target  string         `json:"target,omitempty"` // client being probed, as the sender knows its address
+	Members []MemberUpdate `json:"members,omitempty"`
+}
+
+// sent by a server to the gateway when it starts, and again periodically so a restarted gateway relearns it
+type Registration struct {
+	NodeId        string   `json:"nodeId"`        // stays the same across restarts, so a restarted server replaces its old entry
+	HTTPAddress   string   `json:"httpAddress"`   // where the gateway forwards client requests
+	ClientAddress string   `json:"clientAddress"` // where clients log in over TCP
+	RaftAddress   string   `json:"raftAddress"`   // where other servers and the gateway send Raft messages
+	Capabilities  []string `json:"capabilities"`  // capabilities the server offers clients
+}
+
+// servers that are up, as the gateway returns them to clients from /servers
+type Roster struct {
+	Version uint64         `json:"version"` // changes whenever a server comes up, goes down or moves
+	Servers []Registration `json:"servers"`
+}
+
+// sent by a server to the gateway when it shuts down, so it is removed at once instead of once heartbeats stop
+type Deregistration struct {
+	NodeId string `json:"nodeId"`
+}
+
+// sent by every server to the gateway at a fixed rate, so the gateway notices when a server stops responding
+type Heartbeat struct {
+	NodeId   string        `json:"nodeId"`
+	Seq      uint64        `json:"seq"`
+	Interval time.Duration `json:"interval"` // how often the server sends heartbeats
+}
+
+// kinds of RaftMessage exchanged on the leader port
+const (
+	RaftRequestVote     = "requestvote"
+	RaftAppendEntries   = "appendentries"
+	RaftInstallSnapshot = "installsnapshot"
+	RaftLeaderQuery     = "leaderquery"
+)
+
+// entry in the log replicated from the leader to all other servers
+type LogEntry struct {
+	Index   uint64 `json:"index"`
+	Term    uint64 `json:"term"`
+	Command []byte `json:"command"`
+}
+
+// message sent via TCP between servers, or from gateway to a server, on the leader port
+type RaftMessage struct {
+	Type         string     `json:"type"`
+	Term         uint64     `json:"term"`
+	From         string     `json:"from"`
+	LastLogIndex uint64     `json:"lastLogIndex,omitempty"`
+	LastLogTerm  uint64     `json:"lastLogTerm,omitempty"`
+	PrevLogIndex uint64     `json:"prevLogIndex,omitempty"`
+	PrevLogTerm  uint64     `json:"prevLogTerm,omitempty"`
+	Entries      []LogEntry `json:"entries,omitempty"`
+	LeaderCommit uint64     `json:"leaderCommit,omitempty"`
+
+	// state of the DB as of SnapshotIndex, sent to a server rejoining the cluster in chunks. Snapshot holds the bytes
+	// starting at SnapshotOffset, and the last chunk has SnapshotDone set and carries the entries after the snapshot
+	SnapshotIndex  uint64 `json:"snapshotIndex,omitempty"`
+	SnapshotTerm   uint64 `json:"snapshotTerm,omitempty"`
+	SnapshotOffset uint64 `json:"snapshotOffset,omitempty"`
+	SnapshotDone   bool   `json:"snapshotDone,omitempty"`
+	Snapshot       []byte `json:"snapshot,omitempty"`
+}
+
+// reply to a RaftMessage
+type RaftReply struct {
+	Term       uint64 `json:"term"`
+	From       string `json:"from"`
+	Success    bool   `json:"success"`    // vote granted or entries appended
+	MatchIndex uint64 `json:"matchIndex"` // last index known to match the leader's log
+	Leader     string `json:"leader"`     // leader as seen by the replying server
+
+	NeedSnapshot bool `json:"needSnapshot,omitempty"` // server is rejoining and wants a snapshot before any entries, or missed a chunk of one
+}
+
+// copy of the Users, Groups, Posts and Offsets collections transferred to a server rejoining the cluster
+type Snapshot struct {
+	Users   []User   `json:"users"`
+	Groups  []Group  `json:"groups"`
+	Posts   []Post   `json:"posts"`
+	Offsets []Offset `json:"offsets"`
+}
+
+// kinds of Command replicated through the log
+const (
+	OpRegister   = "register"
+	OpClaimUser  = "claimuser"
+	OpJoinGroup  = "joingroup"
+	OpLeaveGroup = "leavegroup"
+	OpWritePost  = "writepost"
+
+	OpCreateGroup       = "creategroup"
+	OpDeleteGroup       = "deletegroup"
+	OpTransferOwnership = "transferownership"
+
+	OpInvite        = "invite"
+	OpRequestJoin   = "requestjoin"
+	OpApproveJoin   = "approvejoin"
+	OpDeclineJoin   = "declinejoin"
+	OpSetRole       = "setrole"
+	OpSetVisibility = "setvisibility"
+
+	OpPublishKey    = "publishkey"
+	OpEncryptGroup  = "encryptgroup"
+	OpShareGroupKey = "sharegroupkey"
+
+	OpAckPost = "ackpost"
+)
+
+// mutation the leader appends to the replicated log, applied in order by every server
+type Command struct {
+	Op           string            `json:"op"`
+	Username     string            `json:"username"`
+	GroupName    string            `json:"groupname,omitempty"`
+	Post         string            `json:"post,omitempty"`
+	NewOwner     string            `json:"newOwner,omitempty"`
+	PostIds      []uint64          `json:"postIds,omitempty"`      // ids of the posts acknowledged
+	Timestamp    time.Time         `json:"timestamp,omitempty"`    // set by the leader so every server stores the same post time
+	PasswordHash string            `json:"passwordHash,omitempty"` // hashed by the leader, so passwords never reach the log
+	Member       string            `json:"member,omitempty"`       // user invited, approved, declined or given a role
+	Role         string            `json:"role,omitempty"`
+	Visibility   string            `json:"visibility,omitempty"`
+	Encrypted    bool              `json:"encrypted,omitempty"` // create the group end-to-end encrypted
+	PublicKey    string            `json:"publicKey,omitempty"`
+	KeyEpoch     uint64            `json:"keyEpoch,omitempty"` // generation of the group key a post is encrypted with, or the key shared is
+	Sealed       map[string]string `json:"sealed,omitempty"`   // group key sealed to each groupmate it is shared with, by username
+	NewKey       bool              `json:"newKey,omitempty"`   // key shared replaces the current one, rather than being a copy of it
 }